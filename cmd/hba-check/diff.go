@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"go_hba_rules/pkg/hba"
+)
+
+// runDiff — `hba-check diff old.conf new.conf`: кто получил, потерял или
+// сменил доступ. Код выхода 1, если доступ расширился.
+func runDiff(args []string) int {
+	fs := flag.NewFlagSet("hba-check diff", flag.ExitOnError)
+	var rolesPath, strengthPath, format string
+	fs.StringVar(&rolesPath, "roles", "", "path to JSON role catalog (for samerole/+group)")
+	fs.StringVar(&strengthPath, "strength", "", "path to JSON overrides of the method strength scale")
+	fs.StringVar(&format, "format", "text", "output format: text or json")
+	fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		fmt.Fprintln(os.Stderr, "usage: hba-check diff [flags] old.conf new.conf")
+		return 2
+	}
+	oldRules, err := loadRules(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	newRules, err := loadRules(fs.Arg(1))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	roles, err := loadRoles(rolesPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	strength, err := loadStrength(strengthPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	diff := hba.DiffAccessWith(oldRules, newRules, hba.Config{Roles: roles, Strength: strength})
+	switch format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(diff); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+	case "text":
+		if len(diff.Regions) == 0 {
+			fmt.Println("no access changes")
+		}
+		for _, r := range diff.Regions {
+			fmt.Printf("region %s:\n", r.Region)
+			for _, c := range r.Changes {
+				mark := " "
+				if c.Broadens {
+					mark = "+"
+				}
+				fmt.Printf("  %s %s\n", mark, c)
+			}
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "unknown -format: %s\n", format)
+		return 2
+	}
+	if diff.Broadens {
+		return 1
+	}
+	return 0
+}
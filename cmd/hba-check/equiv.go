@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"go_hba_rules/pkg/hba"
+)
+
+// runEquiv — `hba-check equiv old.conf new.conf`: доказывает, что рефакторинг
+// не изменил доступ, или печатает контрпримеры.
+func runEquiv(args []string) int {
+	fs := flag.NewFlagSet("hba-check equiv", flag.ExitOnError)
+	var rolesPath, format string
+	fs.StringVar(&rolesPath, "roles", "", "path to JSON role catalog (for samerole/+group)")
+	fs.StringVar(&format, "format", "text", "output format: text or json")
+	fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		fmt.Fprintln(os.Stderr, "usage: hba-check equiv [flags] old.conf new.conf")
+		return 2
+	}
+	oldRules, err := loadRules(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	newRules, err := loadRules(fs.Arg(1))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	roles, err := loadRoles(rolesPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	diffs := hba.Compare(oldRules, newRules, roles)
+	switch format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		report := struct {
+			Equivalent  bool             `json:"equivalent"`
+			Differences []hba.Difference `json:"differences"`
+		}{len(diffs) == 0, diffs}
+		if err := enc.Encode(report); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+	case "text":
+		if len(diffs) == 0 {
+			fmt.Println("equivalent: both files choose the same outcome for every connection")
+		}
+		for _, d := range diffs {
+			fmt.Printf("DIFF %s\n", d)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "unknown -format: %s\n", format)
+		return 2
+	}
+	if len(diffs) > 0 {
+		return 1
+	}
+	return 0
+}
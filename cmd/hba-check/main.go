@@ -1,72 +1,413 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"go_hba_rules/pkg/hba"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "trace":
+			os.Exit(runTrace(os.Args[2:]))
+		case "matrix":
+			os.Exit(runMatrix(os.Args[2:]))
+		case "equiv":
+			os.Exit(runEquiv(os.Args[2:]))
+		case "diff":
+			os.Exit(runDiff(os.Args[2:]))
+		case "minimize":
+			os.Exit(runMinimize(os.Args[2:]))
+		case "reorder":
+			os.Exit(runReorder(os.Args[2:]))
+		case "upgrade":
+			os.Exit(runUpgrade(os.Args[2:]))
+		case "pgconf":
+			os.Exit(runPGConf(os.Args[2:]))
+		}
+	}
+	os.Exit(runCheck(os.Args[1:]))
+}
+
+// runCheck — режим по умолчанию: все проверки по одному pg_hba.conf.
+func runCheck(args []string) int {
+	fs := flag.NewFlagSet("hba-check", flag.ExitOnError)
 	var hbaPath string
 	var identPath string
+	var rolesPath string
+	var strengthPath string
 	var sslOn bool
 	var wideV4 int
 	var wideV6 int
-	flag.StringVar(&hbaPath, "hba", "", "path to pg_hba.conf")
-	flag.StringVar(&identPath, "ident", "", "path to pg_ident.conf")
-	flag.BoolVar(&sslOn, "ssl", true, "set to false if server SSL is off")
-	flag.IntVar(&wideV4, "wide4", 16, "IPv4 prefix threshold for wide networks")
-	flag.IntVar(&wideV6, "wide6", 48, "IPv6 prefix threshold for wide networks")
-	flag.Parse()
+	var format string
+	var enable, disable string
+	var listChecks bool
+	var configPath string
+	var baselinePath, baselineWrite string
+	var pgVersion string
+	var pgconfPath, pgdata string
+	var certExpiryDays int
+	var serverHostname string
+	fs.StringVar(&hbaPath, "hba", "", "path to pg_hba.conf")
+	fs.StringVar(&identPath, "ident", "", "path to pg_ident.conf")
+	fs.StringVar(&rolesPath, "roles", "", "path to JSON role catalog (for samerole/+group)")
+	fs.StringVar(&strengthPath, "strength", "", "path to JSON overrides of the method strength scale")
+	fs.BoolVar(&sslOn, "ssl", true, "set to false if server SSL is off")
+	fs.IntVar(&wideV4, "wide4", 16, "IPv4 prefix threshold for wide networks")
+	fs.IntVar(&wideV6, "wide6", 48, "IPv6 prefix threshold for wide networks")
+	fs.StringVar(&format, "format", "text", "output format: text or json")
+	fs.StringVar(&enable, "enable", "", "comma-separated check codes to run (default: all)")
+	fs.StringVar(&disable, "disable", "", "comma-separated check codes to skip")
+	fs.BoolVar(&listChecks, "list-checks", false, "list registered checks and exit")
+	fs.StringVar(&configPath, "config", "", "path to policy file (default: "+hba.PolicyFileName+" next to -hba or in a parent directory)")
+	fs.StringVar(&pgconfPath, "pgconf", "", "path to postgresql.conf: ssl, hba_file and ident_file are taken from it")
+	fs.StringVar(&pgdata, "pgdata", "", "data directory: find postgresql.conf, pg_hba.conf and pg_ident.conf from the server's own settings")
+	fs.StringVar(&pgVersion, "pg-version", "", "target PostgreSQL major version (enables version checks)")
+	fs.IntVar(&certExpiryDays, "cert-expiry-days", hba.DefaultCertExpiryDays, "warn when a server or CA certificate expires within this many days")
+	fs.StringVar(&serverHostname, "server-hostname", "", "hostname clients use with sslmode=verify-full; checked against the server certificate")
+	fs.StringVar(&baselinePath, "baseline", "", "path to baseline file: known issues do not fail the check")
+	fs.StringVar(&baselineWrite, "baseline-write", "", "write current issues to a baseline file and exit")
+	fs.Parse(args)
+
+	if listChecks {
+		return printChecks(format)
+	}
+	enabled, disabled := splitCodes(enable), splitCodes(disable)
+	if err := hba.DefaultRegistry.Validate(append(enabled, disabled...)); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
 
+	var server *hba.ServerConfig
+	if pgconfPath != "" && pgdata != "" {
+		fmt.Fprintln(os.Stderr, "-pgconf and -pgdata are mutually exclusive")
+		return 2
+	}
+	if pgconfPath != "" || pgdata != "" {
+		var err error
+		if pgdata != "" {
+			server, err = hba.LoadDataDir(pgdata)
+		} else {
+			server, err = hba.LoadPGConf(pgconfPath)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		if hbaPath == "" {
+			hbaPath = server.Get("hba_file").Value
+		}
+		if identPath == "" {
+			identPath = server.Get("ident_file").Value
+		}
+	}
 	if hbaPath == "" {
 		fmt.Fprintln(os.Stderr, "missing -hba")
-		os.Exit(2)
+		return 2
 	}
 	if identPath == "" {
 		identPath = filepath.Join(filepath.Dir(hbaPath), "pg_ident.conf")
 	}
 
-	hbaFile, err := os.Open(hbaPath)
+	rules, includes, err := hba.LoadHBA(hbaPath)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "failed to open hba: %v\n", err)
-		os.Exit(2)
+		fmt.Fprintln(os.Stderr, err)
+		return 2
 	}
-	defer hbaFile.Close()
 
-	rules, err := hba.ParseHBA(hbaFile)
+	ident := hba.IdentMap{}
+	if _, err := os.Stat(identPath); err == nil {
+		if ident, err = hba.LoadIdent(identPath); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+	}
+
+	roles, err := loadRoles(rolesPath)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "failed to parse hba: %v\n", err)
-		os.Exit(2)
+		fmt.Fprintln(os.Stderr, err)
+		return 2
 	}
 
-	ident := hba.IdentMap{}
-	if f, err := os.Open(identPath); err == nil {
-		ident = hba.ParseIdent(f)
-		f.Close()
+	directives, err := hba.LoadDirectives(hbaPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	cfg := hba.Config{
+		SSLOn:      sslOn,
+		Ident:      ident,
+		WideV4:     wideV4,
+		WideV6:     wideV6,
+		Roles:      roles,
+		Enable:     enabled,
+		Disable:    disabled,
+		Includes:   includes,
+		Directives: directives,
+	}
+	policy, err := loadPolicy(configPath, hbaPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	policy.For(hbaPath).Apply(&cfg)
+	for _, a := range cfg.Assertions {
+		if err := a.CheckRoles(cfg.Roles); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+	}
+	// postgresql.conf описывает реальный сервер и важнее политики
+	if server != nil {
+		if err := server.Apply(&cfg); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
 	}
 
-	issues := hba.CheckAll(rules, hba.Config{
-		SSLOn:  sslOn,
-		Ident:  ident,
-		WideV4: wideV4,
-		WideV6: wideV6,
+	// явно заданные флаги важнее политики
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "ssl":
+			cfg.SSLOn = sslOn
+		case "wide4":
+			cfg.WideV4 = wideV4
+		case "wide6":
+			cfg.WideV6 = wideV6
+		case "cert-expiry-days":
+			cfg.CertExpiryDays = certExpiryDays
+		case "server-hostname":
+			cfg.ServerHostname = serverHostname
+		}
 	})
-	for _, is := range issues {
-		fmt.Printf("%s %s line=%d %s\n", is.Severity, is.Code, is.Line, is.Message)
+	if pgVersion != "" {
+		if cfg.PGVersion, err = hba.ParseVersion(pgVersion); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+	}
+	if strengthPath != "" {
+		if cfg.Strength, err = loadStrength(strengthPath); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+	}
+
+	issues := hba.CheckAll(rules, cfg)
+	if baselineWrite != "" {
+		if err := writeBaseline(baselineWrite, hba.NewBaseline(issues, rules)); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		return 0
+	}
+	if baselinePath != "" {
+		baseline, err := loadBaseline(baselinePath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		if stale := baseline.Apply(issues, rules); len(stale) > 0 {
+			fmt.Fprintf(os.Stderr, "baseline: %d known issue(s) no longer occur; refresh with -baseline-write\n", len(stale))
+		}
+	}
+	switch format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		report := checkReport{Issues: issues}
+		if server != nil {
+			report.Settings = server.ServerSettings()
+		}
+		if err := enc.Encode(report); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+	case "text":
+		for _, is := range issues {
+			if is.Hidden() {
+				continue
+			}
+			if is.File != "" {
+				fmt.Printf("%s %s file=%s line=%d %s\n", is.Severity, is.Code, is.File, is.Line, is.Message)
+				continue
+			}
+			fmt.Printf("%s %s line=%d %s\n", is.Severity, is.Code, is.Line, is.Message)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "unknown -format: %s\n", format)
+		return 2
 	}
 
 	if hasError(issues) {
-		os.Exit(1)
+		return 1
+	}
+	return 0
+}
+
+// loadPolicy читает политику из -config или ищет .hba-check.json от каталога
+// проверяемого файла вверх; нет файла — пустая политика.
+func loadPolicy(configPath, hbaPath string) (hba.Policy, error) {
+	if configPath == "" {
+		found, ok := hba.FindPolicy(filepath.Dir(hbaPath))
+		if !ok {
+			return hba.Policy{}, nil
+		}
+		configPath = found
+	}
+	p, err := hba.LoadPolicy(configPath, hba.DefaultRegistry)
+	if err != nil {
+		return hba.Policy{}, fmt.Errorf("failed to load config: %w", err)
+	}
+	return p, nil
+}
+
+// printChecks — `-list-checks`: коды реестра с уровнем и описанием.
+func printChecks(format string) int {
+	codes := hba.DefaultRegistry.Codes()
+	switch format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(struct {
+			Checks []hba.CheckInfo `json:"checks"`
+		}{codes}); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+	case "text":
+		for _, ci := range codes {
+			fmt.Printf("%-28s %-5s %s\n", ci.Code, ci.Severity, ci.Description)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "unknown -format: %s\n", format)
+		return 2
+	}
+	return 0
+}
+
+// splitCodes разбирает список кодов через запятую.
+func splitCodes(s string) []string {
+	var out []string
+	for _, c := range strings.Split(s, ",") {
+		if c = strings.TrimSpace(c); c != "" {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// checkReport — JSON-вывод основного режима. Settings — параметры сервера
+// с источником, если задан -pgconf.
+type checkReport struct {
+	Issues   []hba.Issue   `json:"issues"`
+	Settings []hba.Setting `json:"settings,omitempty"`
+}
+
+// loadRules читает pg_hba.conf вместе с включёнными файлами (hba.LoadHBA);
+// ошибки уже с контекстом для stderr.
+func loadRules(path string) ([]hba.Rule, error) {
+	rules, _, err := hba.LoadHBA(path)
+	return rules, err
+}
+
+// loadSingleFile читает pg_hba.conf для подкоманд, которые переписывают
+// текст файла (minimize, reorder): правила из включённых файлов так не
+// перенести, поэтому файл с include* — ошибка, а не молчаливый пропуск.
+func loadSingleFile(cmd, path string) ([]byte, []hba.Rule, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open hba: %w", err)
+	}
+	includes, err := hba.ParseIncludes(bytes.NewReader(src))
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(includes) > 0 {
+		return nil, nil, fmt.Errorf("%s: line %d: %s does not support %s; inline the included files first",
+			path, includes[0].Line, cmd, includes[0].Kind)
+	}
+	rules, err := hba.ParseHBA(bytes.NewReader(src))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse hba: %w", err)
+	}
+	return src, rules, nil
+}
+
+// loadBaseline читает файл базовой линии.
+func loadBaseline(path string) (hba.Baseline, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return hba.Baseline{}, fmt.Errorf("failed to open baseline: %w", err)
+	}
+	defer f.Close()
+
+	b, err := hba.ParseBaseline(f)
+	if err != nil {
+		return hba.Baseline{}, fmt.Errorf("failed to parse baseline: %w", err)
+	}
+	return b, nil
+}
+
+// writeBaseline сохраняет базовую линию.
+func writeBaseline(path string, b hba.Baseline) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to write baseline: %w", err)
+	}
+	if err := b.Write(f); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write baseline: %w", err)
+	}
+	return f.Close()
+}
+
+// loadRoles читает каталог ролей; пустой путь — пустой каталог.
+func loadRoles(path string) (hba.Roles, error) {
+	if path == "" {
+		return hba.Roles{}, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return hba.Roles{}, fmt.Errorf("failed to open roles: %w", err)
+	}
+	defer f.Close()
+
+	roles, err := hba.ParseRoles(f)
+	if err != nil {
+		return hba.Roles{}, fmt.Errorf("failed to parse roles: %w", err)
+	}
+	return roles, nil
+}
+
+// loadStrength читает переопределения шкалы силы методов; пустой путь — шкала по умолчанию.
+func loadStrength(path string) (hba.Strength, error) {
+	if path == "" {
+		return hba.DefaultStrength(), nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return hba.Strength{}, fmt.Errorf("failed to open strength: %w", err)
+	}
+	defer f.Close()
+
+	st, err := hba.ParseStrength(f)
+	if err != nil {
+		return hba.Strength{}, fmt.Errorf("failed to parse strength: %w", err)
 	}
+	return st, nil
 }
 
 func hasError(issues []hba.Issue) bool {
 	for _, is := range issues {
-		if is.Severity == hba.SeverityError {
+		if is.Severity == hba.SeverityError && !is.Hidden() {
 			return true
 		}
 	}
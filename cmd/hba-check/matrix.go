@@ -0,0 +1,52 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"go_hba_rules/pkg/hba"
+)
+
+// runMatrix — `hba-check matrix`: эффективная матрица доступа для аудита.
+func runMatrix(args []string) int {
+	fs := flag.NewFlagSet("hba-check matrix", flag.ExitOnError)
+	var hbaPath, rolesPath, format string
+	fs.StringVar(&hbaPath, "hba", "", "path to pg_hba.conf")
+	fs.StringVar(&rolesPath, "roles", "", "path to JSON role catalog (for samerole/+group)")
+	fs.StringVar(&format, "format", "csv", "output format: csv, json or md")
+	fs.Parse(args)
+
+	if hbaPath == "" {
+		fmt.Fprintln(os.Stderr, "missing -hba")
+		return 2
+	}
+	rules, err := loadRules(hbaPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	roles, err := loadRoles(rolesPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	m := hba.BuildMatrix(rules, roles)
+	switch format {
+	case "csv":
+		err = m.WriteCSV(os.Stdout)
+	case "json":
+		err = m.WriteJSON(os.Stdout)
+	case "md":
+		err = m.WriteMarkdown(os.Stdout)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown -format: %s\n", format)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	return 0
+}
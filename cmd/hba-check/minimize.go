@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"go_hba_rules/pkg/hba"
+)
+
+// runMinimize — `hba-check minimize`: печатает эквивалентный файл без
+// недостижимых и избыточных правил, со склеенными соседними правилами.
+func runMinimize(args []string) int {
+	fs := flag.NewFlagSet("hba-check minimize", flag.ExitOnError)
+	var hbaPath, rolesPath, outPath, format string
+	fs.StringVar(&hbaPath, "hba", "", "path to pg_hba.conf")
+	fs.StringVar(&rolesPath, "roles", "", "path to JSON role catalog (for samerole/+group)")
+	fs.StringVar(&outPath, "o", "", "write minimized file here instead of stdout")
+	fs.StringVar(&format, "format", "text", "output format: text (the file) or json (file and change log)")
+	fs.Parse(args)
+
+	if hbaPath == "" {
+		fmt.Fprintln(os.Stderr, "missing -hba")
+		return 2
+	}
+	src, rules, err := loadSingleFile("minimize", hbaPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	roles, err := loadRoles(rolesPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	m := hba.Minimize(rules, roles)
+	if !hba.Equivalent(rules, m.Rules, roles) {
+		fmt.Fprintln(os.Stderr, "internal error: minimized rules are not equivalent to the input")
+		return 2
+	}
+	text := m.Render(string(src))
+
+	var out bytes.Buffer
+	switch format {
+	case "json":
+		enc := json.NewEncoder(&out)
+		enc.SetIndent("", "  ")
+		report := struct {
+			RulesBefore int                  `json:"rules_before"`
+			RulesAfter  int                  `json:"rules_after"`
+			Changes     []hba.MinimizeChange `json:"changes"`
+			Config      string               `json:"config"`
+		}{len(rules), len(m.Rules), m.Changes, text}
+		if err := enc.Encode(report); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+	case "text":
+		out.WriteString(text)
+		for _, c := range m.Changes {
+			fmt.Fprintf(os.Stderr, "%s %v: %s\n", c.Kind, c.Lines, c.Message)
+		}
+		fmt.Fprintf(os.Stderr, "rules: %d -> %d\n", len(rules), len(m.Rules))
+	default:
+		fmt.Fprintf(os.Stderr, "unknown -format: %s\n", format)
+		return 2
+	}
+
+	if outPath == "" {
+		os.Stdout.Write(out.Bytes())
+		return 0
+	}
+	if err := os.WriteFile(outPath, out.Bytes(), 0o644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	return 0
+}
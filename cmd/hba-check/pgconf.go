@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"go_hba_rules/pkg/hba"
+)
+
+// runPGConf — `hba-check pgconf`: действующие параметры сервера, важные для
+// pg_hba.conf, и файл:строка, где каждый задан.
+func runPGConf(args []string) int {
+	fs := flag.NewFlagSet("hba-check pgconf", flag.ExitOnError)
+	var pgconfPath, format string
+	fs.StringVar(&pgconfPath, "pgconf", "", "path to postgresql.conf")
+	fs.StringVar(&format, "format", "text", "output format: text or json")
+	fs.Parse(args)
+
+	if pgconfPath == "" {
+		fmt.Fprintln(os.Stderr, "usage: hba-check pgconf -pgconf <postgresql.conf>")
+		return 2
+	}
+	server, err := hba.LoadPGConf(pgconfPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if _, err := server.SSL(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	settings := server.ServerSettings()
+	switch format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		report := struct {
+			Files    []string      `json:"files"`
+			DataDir  string        `json:"data_directory"`
+			Settings []hba.Setting `json:"settings"`
+		}{server.Files, server.DataDir, settings}
+		if err := enc.Encode(report); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+	case "text":
+		for _, s := range settings {
+			fmt.Printf("%s = '%s'  # %s\n", s.Name, s.Value, s.Origin())
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "unknown -format: %s\n", format)
+		return 2
+	}
+	return 0
+}
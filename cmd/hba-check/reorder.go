@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go_hba_rules/pkg/hba"
+)
+
+// runReorder — `hba-check reorder`: предлагает поднять строгие правила над
+// затеняющими их широкими, показывает, чей доступ изменится, и печатает патч.
+func runReorder(args []string) int {
+	fs := flag.NewFlagSet("hba-check reorder", flag.ExitOnError)
+	var hbaPath, rolesPath, strengthPath, format string
+	fs.StringVar(&hbaPath, "hba", "", "path to pg_hba.conf")
+	fs.StringVar(&rolesPath, "roles", "", "path to JSON role catalog (for samerole/+group)")
+	fs.StringVar(&strengthPath, "strength", "", "path to JSON overrides of the method strength scale")
+	fs.StringVar(&format, "format", "text", "output format: text, json or patch")
+	fs.Parse(args)
+
+	if hbaPath == "" {
+		fmt.Fprintln(os.Stderr, "missing -hba")
+		return 2
+	}
+	src, rules, err := loadSingleFile("reorder", hbaPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	roles, err := loadRoles(rolesPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	strength, err := loadStrength(strengthPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	re := hba.SuggestReorder(rules, hba.Config{Roles: roles, Strength: strength})
+	name := patchPath(hbaPath)
+	patch := hba.UnifiedDiff("a/"+name, "b/"+name, string(src), re.Render(string(src)))
+
+	switch format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		report := struct {
+			hba.Reorder
+			Patch string `json:"patch"`
+		}{re, patch}
+		if err := enc.Encode(report); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+	case "patch":
+		fmt.Print(patch)
+	case "text":
+		if len(re.Moves) == 0 && len(re.StillShadowed) == 0 {
+			fmt.Println("no stricter rules are shadowed by broader ones")
+			return 0
+		}
+		for _, mv := range re.Moves {
+			fmt.Println(mv)
+		}
+		for _, line := range re.StillShadowed {
+			fmt.Printf("WARN line %d would stay unreachable even if moved; left in place\n", line)
+		}
+		for _, d := range re.Changes {
+			fmt.Printf("CHANGE %s\n", d)
+		}
+		fmt.Print(patch)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown -format: %s\n", format)
+		return 2
+	}
+	return 0
+}
+
+// patchPath — путь файла для заголовков патча: относительно текущего
+// каталога, если файл внутри него, иначе без ведущего разделителя, чтобы
+// "a/"+path читался `git apply` и `patch -p1`.
+func patchPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		if wd, err := os.Getwd(); err == nil {
+			if rel, err := filepath.Rel(wd, abs); err == nil && filepath.IsLocal(rel) {
+				return filepath.ToSlash(rel)
+			}
+		}
+		path = abs
+	}
+	return strings.TrimLeft(filepath.ToSlash(filepath.Clean(path)), "/")
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+
+	"go_hba_rules/pkg/hba"
+)
+
+// runTrace — `hba-check trace`: показывает, почему каждое правило подошло или нет
+// для заданного подключения.
+func runTrace(args []string) int {
+	fs := flag.NewFlagSet("hba-check trace", flag.ExitOnError)
+	var hbaPath, rolesPath, db, user, addr, transport, format string
+	var replication bool
+	fs.StringVar(&hbaPath, "hba", "", "path to pg_hba.conf")
+	fs.StringVar(&rolesPath, "roles", "", "path to JSON role catalog (for samerole/+group)")
+	fs.StringVar(&db, "db", "", "requested database")
+	fs.StringVar(&user, "user", "", "requested user")
+	fs.StringVar(&addr, "addr", "", "client IP address (not used for local)")
+	fs.StringVar(&transport, "transport", "ssl", "local, ssl, gss or plain")
+	fs.BoolVar(&replication, "replication", false, "physical replication connection (database is ignored)")
+	fs.StringVar(&format, "format", "text", "output format: text or json")
+	fs.Parse(args)
+
+	if hbaPath == "" || user == "" || (db == "" && !replication) {
+		fmt.Fprintln(os.Stderr, "trace requires -hba, -user and -db (or -replication)")
+		return 2
+	}
+	t, err := hba.ParseTransport(transport)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	conn := hba.Connection{Transport: t, Database: db, User: user, Replication: replication}
+	if t != hba.TransportLocal {
+		conn.Addr = net.ParseIP(addr)
+		if conn.Addr == nil {
+			fmt.Fprintf(os.Stderr, "invalid -addr: %q\n", addr)
+			return 2
+		}
+	}
+
+	rules, err := loadRules(hbaPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	roles, err := loadRoles(rolesPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	trace := hba.TraceConnection(rules, conn, roles)
+	switch format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(trace); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+	case "text":
+		fmt.Print(trace.String())
+	default:
+		fmt.Fprintf(os.Stderr, "unknown -format: %s\n", format)
+		return 2
+	}
+	return 0
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"go_hba_rules/pkg/hba"
+)
+
+// runUpgrade — `hba-check upgrade`: что поменять в pg_hba.conf при переходе
+// с одной мажорной версии PostgreSQL на другую.
+func runUpgrade(args []string) int {
+	fs := flag.NewFlagSet("hba-check upgrade", flag.ExitOnError)
+	var hbaPath, fromStr, toStr, format string
+	fs.StringVar(&hbaPath, "hba", "", "path to pg_hba.conf")
+	fs.StringVar(&fromStr, "from", "", "current PostgreSQL major version")
+	fs.StringVar(&toStr, "to", "", "target PostgreSQL major version")
+	fs.StringVar(&format, "format", "text", "output format: text or json")
+	fs.Parse(args)
+
+	if hbaPath == "" || fromStr == "" || toStr == "" {
+		fmt.Fprintln(os.Stderr, "usage: hba-check upgrade -hba <pg_hba.conf> -from <version> -to <version>")
+		return 2
+	}
+	from, err := hba.ParseVersion(fromStr)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	to, err := hba.ParseVersion(toStr)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	rules, includes, err := hba.LoadHBA(hbaPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	items := hba.UpgradeReport(rules, includes, from, to)
+	required := false
+	for _, it := range items {
+		required = required || it.Required
+	}
+	switch format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		report := struct {
+			From  int               `json:"from"`
+			To    int               `json:"to"`
+			Items []hba.UpgradeItem `json:"items"`
+		}{from, to, items}
+		if report.Items == nil {
+			report.Items = []hba.UpgradeItem{}
+		}
+		if err := enc.Encode(report); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+	case "text":
+		if len(items) == 0 {
+			fmt.Printf("No changes needed to move from PostgreSQL %d to %d.\n", from, to)
+		}
+		for _, it := range items {
+			fmt.Println(it)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "unknown -format: %s\n", format)
+		return 2
+	}
+	if required {
+		return 1
+	}
+	return 0
+}
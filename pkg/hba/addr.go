@@ -143,6 +143,22 @@ func (a AddrSet) Covers(b AddrSet) bool {
 	return true
 }
 
+// Contains проверяет, попадает ли конкретный адрес клиента в набор.
+func (a AddrSet) Contains(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	if a.Any {
+		return true
+	}
+	for _, n := range a.Networks {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
 // Intersects проверяет, пересекаются ли диапазоны адресов.
 func (a AddrSet) Intersects(b AddrSet) bool {
 	if a.Any || b.Any {
@@ -0,0 +1,290 @@
+package hba
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+)
+
+// Assertion — утверждение политики доступа, которое проверяется по семантике
+// набора правил (через Space и Simulate), а не по тексту строк:
+//
+//	{"name": "replication only for repl from 10.10.10.0/28",
+//	 "match": {"replication": true},
+//	 "allow": {"users": ["repl"], "addresses": ["10.10.10.0/28"]}}
+//	{"name": "superusers never over the network",
+//	 "match": {"superuser": true, "transports": ["ssl", "gss", "plain"]}, "deny": true}
+//	{"name": "billing only via hostssl + cert",
+//	 "match": {"databases": ["billing"]}, "allow": {"transports": ["ssl"], "methods": ["cert"]}}
+//
+// Match выбирает подключения. Deny — ни одно из них не должно приниматься
+// (доходить до аутентификации); Allow — принятые обязаны подходить под Allow.
+type Assertion struct {
+	Name  string    `json:"name"`
+	Match Selector  `json:"match"`
+	Deny  bool      `json:"deny,omitempty"`
+	Allow *Selector `json:"allow,omitempty"`
+}
+
+// Selector — множество подключений. Пустое поле не ограничивает.
+// Users: имя роли или +роль (члены роли по каталогу). Superuser — по
+// атрибуту из каталога ролей. Addresses не подходят под local.
+// Methods учитывается только в Allow: метод правила, принявшего подключение.
+type Selector struct {
+	Transports  []Transport `json:"transports,omitempty"`
+	Replication *bool       `json:"replication,omitempty"`
+	Databases   []string    `json:"databases,omitempty"`
+	Users       []string    `json:"users,omitempty"`
+	Superuser   *bool       `json:"superuser,omitempty"`
+	Addresses   []string    `json:"addresses,omitempty"`
+	Methods     []string    `json:"methods,omitempty"`
+
+	nets []*net.IPNet
+}
+
+// validate проверяет утверждение и готовит сети селекторов.
+func (a *Assertion) validate() error {
+	if a.Name == "" {
+		return fmt.Errorf("assertion without name")
+	}
+	if a.Deny == (a.Allow != nil) {
+		return fmt.Errorf("assertion %q: exactly one of deny or allow is required", a.Name)
+	}
+	if len(a.Match.Methods) > 0 {
+		return fmt.Errorf("assertion %q: methods are only allowed in allow", a.Name)
+	}
+	if err := a.Match.prepare(); err != nil {
+		return fmt.Errorf("assertion %q: %w", a.Name, err)
+	}
+	if a.Allow != nil {
+		if err := a.Allow.prepare(); err != nil {
+			return fmt.Errorf("assertion %q: %w", a.Name, err)
+		}
+	}
+	return nil
+}
+
+// CheckRoles проверяет утверждение против каталога ролей: superuser в
+// селекторе без единого суперпользователя в каталоге не выбрал бы никого
+// (или всех), и утверждение молча проходило бы.
+func (a Assertion) CheckRoles(roles Roles) error {
+	uses := a.Match.Superuser != nil || a.Allow != nil && a.Allow.Superuser != nil
+	if uses && len(roles.Superusers) == 0 {
+		return fmt.Errorf("assertion %q uses superuser, but the role catalog (-roles) marks no role as superuser", a.Name)
+	}
+	return nil
+}
+
+func (s *Selector) prepare() error {
+	for i, t := range s.Transports {
+		pt, err := ParseTransport(string(t))
+		if err != nil {
+			return err
+		}
+		s.Transports[i] = pt
+	}
+	for i := range s.Databases {
+		s.Databases[i] = strings.ToLower(s.Databases[i])
+	}
+	for i := range s.Users {
+		s.Users[i] = strings.ToLower(s.Users[i])
+	}
+	for i := range s.Methods {
+		s.Methods[i] = strings.ToLower(s.Methods[i])
+	}
+	s.nets = nil
+	for _, tok := range s.Addresses {
+		addr, err := ParseAddr(tok)
+		if err != nil || addr.Special != "" {
+			return fmt.Errorf("invalid address %q", tok)
+		}
+		if addr.Any {
+			addr.Networks = []*net.IPNet{mustCIDR("0.0.0.0/0"), mustCIDR("::/0")}
+		}
+		s.nets = append(s.nets, addr.Networks...)
+	}
+	return nil
+}
+
+// matches — подключение (и результат, для Methods) входит в множество.
+func (s Selector) matches(c Connection, o Outcome, roles Roles) bool {
+	if len(s.Transports) > 0 && !containsTransport(s.Transports, c.Transport) {
+		return false
+	}
+	if s.Replication != nil && *s.Replication != c.Replication {
+		return false
+	}
+	if len(s.Databases) > 0 && (c.Replication || !containsToken(s.Databases, c.Database)) {
+		return false
+	}
+	if len(s.Users) > 0 && !s.matchUser(c.User, roles) {
+		return false
+	}
+	if s.Superuser != nil && *s.Superuser != roles.IsSuperuser(c.User) {
+		return false
+	}
+	if len(s.nets) > 0 {
+		if c.Transport == TransportLocal || !netsContain(s.nets, c.Addr) {
+			return false
+		}
+	}
+	if len(s.Methods) > 0 && !containsToken(s.Methods, o.Method) {
+		return false
+	}
+	return true
+}
+
+func (s Selector) matchUser(user string, roles Roles) bool {
+	for _, tok := range s.Users {
+		if strings.HasPrefix(tok, "+") {
+			if roles.IsMember(user, tok[1:]) {
+				return true
+			}
+		} else if tok == user {
+			return true
+		}
+	}
+	return false
+}
+
+// boundaries — псевдоправила с теми же БД, пользователями и сетями, что и
+// селектор: добавленные в Space, они гарантируют, что каждый класс целиком
+// внутри селектора или целиком вне, и проверки на представителе достаточно.
+func (s Selector) boundaries(roles Roles) []Rule {
+	dbs := s.Databases
+	if len(dbs) == 0 {
+		dbs = []string{"all"}
+	}
+	users := s.Users
+	if s.Superuser != nil {
+		users = append(append([]string(nil), users...), roles.SuperuserNames()...)
+	}
+	if len(users) == 0 {
+		users = []string{"all"}
+	}
+	out := []Rule{{Type: "local", DBs: dbs, Users: users, Method: "trust"}}
+	for _, n := range s.nets {
+		out = append(out, Rule{Type: "host", DBs: dbs, Users: users, Method: "trust",
+			Addr: AddrSet{Networks: []*net.IPNet{n}, HasIPv4: n.IP.To4() != nil, HasIPv6: n.IP.To4() == nil}})
+	}
+	return out
+}
+
+func containsTransport(list []Transport, t Transport) bool {
+	for _, v := range list {
+		if v == t {
+			return true
+		}
+	}
+	return false
+}
+
+func netsContain(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Violation — нарушение утверждения: правило Line принимает подключения,
+// которые утверждение запрещает; Example — одно из них.
+type Violation struct {
+	Assertion string
+	File      string // включённый файл правила, см. Rule.File
+	Line      int
+	Method    string
+	Example   Connection
+}
+
+// CheckAssertion перебирает классы подключений и возвращает по одному
+// нарушению на каждое правило, которое принимает запрещённое подключение.
+// Нарушения упорядочены по строке (для правил из разных файлов — по строке
+// в своём файле).
+func CheckAssertion(rules []Rule, a Assertion, roles Roles) ([]Violation, error) {
+	if a.Allow != nil {
+		allow := *a.Allow
+		a.Allow = &allow
+	}
+	if err := a.validate(); err != nil {
+		return nil, err
+	}
+	if err := a.CheckRoles(roles); err != nil {
+		return nil, err
+	}
+	bounds := a.Match.boundaries(roles)
+	if a.Allow != nil {
+		bounds = append(bounds, a.Allow.boundaries(roles)...)
+	}
+	space := NewSpace(roles, rules, bounds)
+	all := append(append([]Rule(nil), rules...), bounds...)
+
+	byRule := map[ruleKey]*Violation{}
+	for _, cell := range space.Cells() {
+		c := cell.Sample()
+		if !a.Match.matches(c, Outcome{}, roles) {
+			continue
+		}
+		o := Evaluate(rules, c, roles)
+		if !o.Accepts() {
+			continue
+		}
+		if a.Allow != nil && a.Allow.matches(c, o, roles) {
+			continue
+		}
+		k := ruleKey{o.File, o.Line}
+		if _, seen := byRule[k]; !seen {
+			byRule[k] = &Violation{Assertion: a.Name, File: o.File, Line: o.Line, Method: o.Method,
+				Example: readableNames(c, roles, all...)}
+		}
+	}
+	out := make([]Violation, 0, len(byRule))
+	for _, v := range byRule {
+		out = append(out, *v)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Line != out[j].Line {
+			return out[i].Line < out[j].Line
+		}
+		return out[i].File < out[j].File
+	})
+	return out, nil
+}
+
+var infoPolicyViolation = CheckInfo{
+	Code: "policyViolation", Severity: SeverityError,
+	Description: "Rule accepts connections forbidden by an assertion of the access policy.",
+	Rationale:   "Assertions encode security requirements (who may connect, from where, how); they are checked against what the rules actually do, not against their text.",
+	Remediation: "Narrow or reorder the offending rule, or add a reject above it; the example connection shows what gets through.",
+	DocsURL:     docsHBA,
+}
+
+// assertionCheck — утверждения из cfg.Assertions (файл политики).
+type assertionCheck struct{}
+
+func (assertionCheck) Codes() []CheckInfo { return []CheckInfo{infoPolicyViolation} }
+
+func (assertionCheck) Run(ctx *Context) []Issue {
+	var issues []Issue
+	for _, a := range ctx.Config.Assertions {
+		violations, err := CheckAssertion(ctx.Rules, a, ctx.Config.Roles)
+		if err != nil {
+			// непроверяемое утверждение не должно проходить молча
+			issues = append(issues, infoPolicyViolation.NewIssue(0, fmt.Sprintf(
+				"Policy assertion %q cannot be checked: %v.", a.Name, err)))
+			continue
+		}
+		for _, v := range violations {
+			example := v.Example
+			is := infoPolicyViolation.NewIssue(v.Line, fmt.Sprintf(
+				"Policy assertion %q violated: rule accepts %s with %s.", a.Name, example.String(), v.Method))
+			is.File = v.File
+			is.Example = &example
+			issues = append(issues, is)
+		}
+	}
+	sort.SliceStable(issues, func(i, j int) bool { return issues[i].Line < issues[j].Line })
+	return issues
+}
@@ -0,0 +1,141 @@
+package hba
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// BaselineVersion — версия формата файла базовой линии.
+const BaselineVersion = 1
+
+// BaselineEntry — известная находка. Rule и Message — для чтения человеком,
+// сопоставление идёт только по Fingerprint.
+type BaselineEntry struct {
+	Fingerprint string `json:"fingerprint"`
+	Code        string `json:"code"`
+	Rule        string `json:"rule,omitempty"`
+	Message     string `json:"message,omitempty"`
+}
+
+// Baseline — набор известных находок, которые не должны ронять проверку.
+// Одинаковые отпечатки (например, у дублей правил) хранятся столько раз,
+// сколько находок было, и при сопоставлении расходуются по одному.
+type Baseline struct {
+	Version int             `json:"version"`
+	Entries []BaselineEntry `json:"issues"`
+}
+
+// Fingerprint — отпечаток находки, не зависящий от номеров строк: код плюс
+// нормализованный текст правила (FormatRule) и правил из Related. Вставка
+// или удаление строк выше не меняет отпечаток; изменение самого правила —
+// меняет. Для находок не на строке правила (комментарии) берётся сообщение.
+func Fingerprint(is Issue, rules []Rule) string {
+	return fingerprint(is, rulesByLine(rules))
+}
+
+func fingerprint(is Issue, byLine map[ruleKey]Rule) string {
+	h := sha256.New()
+	io.WriteString(h, is.Code+"\n")
+	if r, ok := byLine[ruleKey{is.File, is.Line}]; ok {
+		io.WriteString(h, FormatRule(r)+"\n")
+	} else {
+		io.WriteString(h, is.Message+"\n")
+	}
+	var related []string
+	for i, l := range is.Related {
+		k := ruleKey{line: l}
+		if i < len(is.RelatedFiles) {
+			k.file = is.RelatedFiles[i]
+		}
+		if r, ok := byLine[k]; ok {
+			related = append(related, FormatRule(r))
+		}
+	}
+	sort.Strings(related)
+	for _, s := range related {
+		io.WriteString(h, "related "+s+"\n")
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// ruleKey — место правила: файл (пусто — основной) и строка.
+type ruleKey struct {
+	file string
+	line int
+}
+
+func rulesByLine(rules []Rule) map[ruleKey]Rule {
+	byLine := make(map[ruleKey]Rule, len(rules))
+	for _, r := range rules {
+		byLine[ruleKey{r.File, r.Line}] = r
+	}
+	return byLine
+}
+
+// NewBaseline записывает в базовую линию все неподавленные находки.
+func NewBaseline(issues []Issue, rules []Rule) Baseline {
+	byLine := rulesByLine(rules)
+	b := Baseline{Version: BaselineVersion, Entries: []BaselineEntry{}}
+	for _, is := range issues {
+		if is.Suppressed {
+			continue
+		}
+		e := BaselineEntry{Fingerprint: fingerprint(is, byLine), Code: is.Code, Message: is.Message}
+		if r, ok := byLine[ruleKey{is.File, is.Line}]; ok {
+			e.Rule = FormatRule(r)
+		}
+		b.Entries = append(b.Entries, e)
+	}
+	return b
+}
+
+// ParseBaseline читает файл базовой линии.
+func ParseBaseline(r io.Reader) (Baseline, error) {
+	var b Baseline
+	if err := json.NewDecoder(r).Decode(&b); err != nil {
+		return Baseline{}, err
+	}
+	if b.Version != BaselineVersion {
+		return Baseline{}, fmt.Errorf("unsupported baseline version %d", b.Version)
+	}
+	return b, nil
+}
+
+// Write сохраняет базовую линию в JSON.
+func (b Baseline) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(b)
+}
+
+// Apply помечает находки из базовой линии (Baselined=true) и возвращает
+// записи, которым ничего не соответствует (исправленные находки).
+func (b Baseline) Apply(issues []Issue, rules []Rule) []BaselineEntry {
+	byLine := rulesByLine(rules)
+	left := map[string]int{}
+	for _, e := range b.Entries {
+		left[e.Fingerprint]++
+	}
+	for i := range issues {
+		if issues[i].Suppressed {
+			continue
+		}
+		fp := fingerprint(issues[i], byLine)
+		if left[fp] > 0 {
+			left[fp]--
+			issues[i].Baselined = true
+		}
+	}
+	var stale []BaselineEntry
+	for _, e := range b.Entries {
+		if left[e.Fingerprint] > 0 {
+			left[e.Fingerprint]--
+			stale = append(stale, e)
+		}
+	}
+	return stale
+}
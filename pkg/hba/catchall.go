@@ -0,0 +1,169 @@
+package hba
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// ConnClass — крупный класс подключений, для которого ожидается явный
+// завершающий reject в конце файла.
+type ConnClass string
+
+const (
+	ClassLocal       ConnClass = "local"       // unix-сокет, обычные БД
+	ClassIPv4        ConnClass = "ipv4"        // TCP по IPv4, обычные БД
+	ClassIPv6        ConnClass = "ipv6"        // TCP по IPv6, обычные БД
+	ClassReplication ConnClass = "replication" // физическая репликация, любой транспорт
+)
+
+// ConnClasses — классы в порядке вывода.
+var ConnClasses = []ConnClass{ClassLocal, ClassIPv4, ClassIPv6, ClassReplication}
+
+// classOf относит подключение к крупному классу.
+func classOf(c Connection) ConnClass {
+	switch {
+	case c.Replication:
+		return ClassReplication
+	case c.Transport == TransportLocal:
+		return ClassLocal
+	case c.Addr.To4() != nil:
+		return ClassIPv4
+	default:
+		return ClassIPv6
+	}
+}
+
+// catchAllFix — правило, которое закрывает класс явно. Для репликации
+// local и host закрываются разными строками.
+func catchAllFix(class ConnClass, local bool) string {
+	switch {
+	case class == ClassLocal:
+		return "local all all reject"
+	case class == ClassIPv4:
+		return "host all all 0.0.0.0/0 reject"
+	case class == ClassIPv6:
+		return "host all all ::/0 reject"
+	case local:
+		return "local replication all reject"
+	}
+	return "host replication all all reject"
+}
+
+// CatchAllGap — класс, часть подключений которого не совпадает ни с одним
+// правилом и отвергается только неявно (концом файла). Example — одно из них.
+// Fix — правила, которые достаточно дописать в конец файла.
+type CatchAllGap struct {
+	Class   ConnClass
+	Example Connection
+	Fix     []string
+}
+
+// CatchAllGaps возвращает крупные классы, которые не закрыты явно: какое-то
+// подключение класса доходит до конца файла. Класс, все подключения которого
+// приняты или отвергнуты правилами, не попадает в результат, даже если
+// reject в нём не последний.
+//
+// Полное разбиение (Space) здесь не нужно. Пара имён, не упомянутых в
+// правилах, совпадает с подмножеством правил, совпадающих с любой другой
+// парой, поэтому если до конца файла доходит хоть кто-то, доходит и она.
+// Достаточно разбить адреса по правилам, подходящим этой паре, — анализ
+// линеен по числу правил. Регулярные выражения монотонность нарушают
+// (выражение может подходить чужому имени, но не упомянутому), и для файлов
+// с ними перебираются все представители principalSample.
+func CatchAllGaps(rules []Rule, roles Roles) []CatchAllGap {
+	principals := []Connection{
+		{Database: otherName, User: otherName2},
+		{Database: otherName, User: otherName2, Replication: true},
+	}
+	if hasRegexTokens(rules) {
+		principals = principalConns(roles, rules...)
+	}
+	// граница 0.0.0.0/0 разводит IPv4 и IPv6 по разным адресным классам:
+	// без неё семейства с одинаковым набором правил склеиваются в один
+	v4 := Rule{Type: "host", DBs: []string{"all"}, Users: []string{"all"}, Method: "trust",
+		Addr: AddrSet{Networks: []*net.IPNet{mustCIDR("0.0.0.0/0")}, HasIPv4: true}}
+
+	gaps := map[ConnClass]*CatchAllGap{}
+	fallsThrough := func(relevant []Rule, c Connection) {
+		if _, ok := Simulate(relevant, c, roles); ok {
+			return
+		}
+		class := classOf(c)
+		g, ok := gaps[class]
+		if !ok {
+			g = &CatchAllGap{Class: class, Example: readableNames(c, roles, rules...)}
+			gaps[class] = g
+		}
+		fix := catchAllFix(class, c.Transport == TransportLocal)
+		if !containsToken(g.Fix, fix) {
+			g.Fix = append(g.Fix, fix)
+		}
+	}
+	for _, p := range principals {
+		var relevant []Rule
+		for _, r := range rules {
+			if r.matchPrincipal(p, roles) {
+				relevant = append(relevant, r)
+			}
+		}
+		addrs := addrClasses(append(append([]Rule(nil), relevant...), v4))
+		for _, t := range Transports {
+			c := p
+			c.Transport = t
+			if t == TransportLocal {
+				fallsThrough(relevant, c)
+				continue
+			}
+			for _, a := range addrs {
+				c.Addr = net.IP(a.sample.AsSlice())
+				fallsThrough(relevant, c)
+			}
+		}
+	}
+	var out []CatchAllGap
+	for _, class := range ConnClasses {
+		if g, ok := gaps[class]; ok {
+			out = append(out, *g)
+		}
+	}
+	return out
+}
+
+// hasRegexTokens — в правилах есть регулярные выражения в database/user.
+func hasRegexTokens(rules []Rule) bool {
+	for _, r := range rules {
+		if r.hasRegex() {
+			return true
+		}
+	}
+	return false
+}
+
+var infoMissingCatchAllReject = CheckInfo{
+	Code: "missingCatchAllReject", Severity: SeverityWarn,
+	Description: "Some connections of a class (local, IPv4, IPv6, replication) match no rule and fall to the implicit reject.",
+	Rationale:   "An explicit reject at the end documents that everything else is denied and keeps it denied when rules are appended later (includes, automation).",
+	Remediation: "End the file with a reject for the class, e.g. `host all all 0.0.0.0/0 reject` and `host all all ::/0 reject`.",
+	DocsURL:     docsHBA,
+}
+
+// catchAllCheck — классы без явного завершающего reject. Находка относится
+// к файлу целиком (Line=0), а пример не входит в сообщение: так отпечаток
+// для базовой линии не меняется при правке правил, пока класс не закрыт.
+type catchAllCheck struct{}
+
+func (catchAllCheck) Codes() []CheckInfo { return []CheckInfo{infoMissingCatchAllReject} }
+
+func (catchAllCheck) Run(ctx *Context) []Issue {
+	var issues []Issue
+	for _, g := range CatchAllGaps(ctx.Rules, ctx.Config.Roles) {
+		example := g.Example
+		is := infoMissingCatchAllReject.NewIssue(0, fmt.Sprintf(
+			"No explicit catch-all reject for %s connections: some match no rule and are rejected only implicitly; add `%s` at the end.",
+			g.Class, strings.Join(g.Fix, "` and `")))
+		is.Example = &example
+		issues = append(issues, is)
+	}
+	return issues
+}
@@ -0,0 +1,327 @@
+package hba
+
+import (
+	"bytes"
+	"crypto/dsa"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// DefaultCertExpiryDays — за сколько дней до истечения сертификата
+// выдаётся certExpiring, если Config.CertExpiryDays не задан.
+const DefaultCertExpiryDays = 30
+
+var (
+	infoCertExpired = CheckInfo{
+		Code: "certExpired", Severity: SeverityError,
+		Description: "Server or CA certificate is expired or not yet valid.",
+		Rationale:   "Clients that verify the server (sslmode=verify-ca/verify-full) and client certificate checks fail, so hostssl/cert logins break.",
+		Remediation: "Renew the certificate and reload the server.",
+		DocsURL:     docsSSL,
+	}
+	infoCertExpiring = CheckInfo{
+		Code: "certExpiring", Severity: SeverityWarn,
+		Description: "Server or CA certificate expires soon.",
+		Rationale:   "Once it expires, TLS logins that depend on it start failing.",
+		Remediation: "Renew the certificate before it expires; the warning window is set by -cert-expiry-days.",
+		DocsURL:     docsSSL,
+	}
+	infoCertWeakKey = CheckInfo{
+		Code: "certWeakKey", Severity: SeverityWarn,
+		Description: "Certificate key is too weak (RSA < 2048 bits, EC < 256 bits, DSA).",
+		Rationale:   "Short keys can be factored or broken, which allows impersonating the server or forging client certificates.",
+		Remediation: "Reissue the certificate with an RSA 2048+ or ECDSA P-256+ key.",
+		DocsURL:     docsSSL,
+	}
+	infoCertWeakSignature = CheckInfo{
+		Code: "certWeakSignature", Severity: SeverityWarn,
+		Description: "Certificate is signed with MD5 or SHA-1.",
+		Rationale:   "Collisions for these hashes are practical; modern clients reject such certificates.",
+		Remediation: "Reissue the certificate with a SHA-256 (or stronger) signature.",
+		DocsURL:     docsSSL,
+	}
+	infoCertChainIncomplete = CheckInfo{
+		Code: "certChainIncomplete", Severity: SeverityError,
+		Description: "ssl_cert_file lacks a certificate between the ones it contains.",
+		Rationale:   "The server sends only what is in ssl_cert_file; clients that trust the root cannot build the chain and fail verification.",
+		Remediation: "Append the intermediate certificates to ssl_cert_file after the server certificate.",
+		DocsURL:     docsSSL,
+	}
+	infoCertChainUnverified = CheckInfo{
+		Code: "certChainUnverified", Severity: SeverityInfo,
+		Description: "Issuer of the only certificate in ssl_cert_file is unknown: a private root or a missing intermediate.",
+		Rationale:   "With a private root CA clients verify the server against their own root.crt and the file needs nothing else; if the issuer is an intermediate CA, clients cannot build the chain.",
+		Remediation: "Nothing if the issuer is the root CA clients trust; otherwise append the intermediate certificate to ssl_cert_file.",
+		DocsURL:     docsSSL,
+	}
+	infoCertHostnameMismatch = CheckInfo{
+		Code: "certHostnameMismatch", Severity: SeverityError,
+		Description: "Server certificate does not match the configured server hostname.",
+		Rationale:   "Clients with sslmode=verify-full refuse the connection.",
+		Remediation: "Reissue the certificate with the hostname in subjectAltName, or fix -server-hostname.",
+		DocsURL:     docsSSL,
+	}
+	infoCertInvalid = CheckInfo{
+		Code: "certInvalid", Severity: SeverityError,
+		Description: "ssl_cert_file or ssl_ca_file contains no parsable PEM certificate.",
+		Rationale:   "The server fails to load TLS, so hostssl rules give no access.",
+		Remediation: "Put PEM-encoded certificates (BEGIN CERTIFICATE) into the file.",
+		DocsURL:     docsSSL,
+	}
+)
+
+// ReadCertificates читает все сертификаты PEM-файла по порядку; блоки
+// других типов (например, ключ в том же файле) пропускаются.
+func ReadCertificates(path string) ([]*x509.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var out []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		c, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: certificate %d: %w", path, len(out)+1, err)
+		}
+		out = append(out, c)
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("%s: no PEM certificate found", path)
+	}
+	return out, nil
+}
+
+// certName — короткое имя сертификата для сообщений: CN или весь subject.
+func certName(c *x509.Certificate) string {
+	if c.Subject.CommonName != "" {
+		return "CN=" + c.Subject.CommonName
+	}
+	return c.Subject.String()
+}
+
+func selfSigned(c *x509.Certificate) bool {
+	return bytes.Equal(c.RawIssuer, c.RawSubject) && c.CheckSignatureFrom(c) == nil
+}
+
+func issuedBy(c, issuer *x509.Certificate) bool {
+	return bytes.Equal(c.RawIssuer, issuer.RawSubject) && c.CheckSignatureFrom(issuer) == nil
+}
+
+// weakKey — описание слабого ключа или пусто.
+func weakKey(c *x509.Certificate) string {
+	switch k := c.PublicKey.(type) {
+	case *rsa.PublicKey:
+		if bits := k.N.BitLen(); bits < 2048 {
+			return fmt.Sprintf("RSA %d bits", bits)
+		}
+	case *ecdsa.PublicKey:
+		if bits := k.Curve.Params().BitSize; bits < 256 {
+			return fmt.Sprintf("EC %d bits", bits)
+		}
+	case *dsa.PublicKey:
+		return "DSA"
+	}
+	return ""
+}
+
+func weakSignature(c *x509.Certificate) bool {
+	switch c.SignatureAlgorithm {
+	case x509.MD2WithRSA, x509.MD5WithRSA, x509.SHA1WithRSA, x509.DSAWithSHA1, x509.ECDSAWithSHA1:
+		return true
+	}
+	return false
+}
+
+// chainGap — сертификат, чьего издателя нет ни в цепочке из ssl_cert_file,
+// ни в системном хранилище; nil — цепочка доходит до самоподписанного
+// корня, до известного корня или до промежуточного CA (корень, которым он
+// подписан, клиенты держат у себя в root.crt, сервер его не отправляет).
+// stray — в файле есть сертификаты, не попавшие в цепочку: значит, между
+// ними не хватает звена. Без них издатель единственного сертификата может
+// быть и корнем клиентов, и промежуточным CA — этого по файлу не понять.
+// ssl_ca_file — CA клиентских сертификатов и к цепочке сервера отношения
+// не имеет.
+func chainGap(chain []*x509.Certificate) (gap *x509.Certificate, stray bool) {
+	c := chain[0]
+	used := 1
+	for range chain {
+		if selfSigned(c) {
+			return nil, false
+		}
+		var next *x509.Certificate
+		for _, p := range chain {
+			if p != c && issuedBy(c, p) {
+				next = p
+				break
+			}
+		}
+		if next == nil {
+			break
+		}
+		c = next
+		used++
+	}
+	stray = used < len(chain)
+	if !stray && c != chain[0] && c.IsCA {
+		return nil, false
+	}
+	if pool, err := x509.SystemCertPool(); err == nil {
+		// сроки проверяются отдельно (certExpired), здесь важна только подпись
+		_, err := c.Verify(x509.VerifyOptions{Roots: pool, CurrentTime: c.NotBefore.Add(time.Minute),
+			KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}})
+		if err == nil {
+			return nil, false
+		}
+	}
+	return c, stray
+}
+
+// certMatchesHost — проверка имени как в libpq при sslmode=verify-full:
+// DNS- и IP-имена из subjectAltName, а если DNS-имён нет — CN (с
+// подстановкой «*.» на одну метку).
+func certMatchesHost(c *x509.Certificate, host string) bool {
+	if c.VerifyHostname(host) == nil {
+		return true
+	}
+	if len(c.DNSNames) > 0 || net.ParseIP(host) != nil || c.Subject.CommonName == "" {
+		return false
+	}
+	cn, host := strings.ToLower(c.Subject.CommonName), strings.ToLower(host)
+	if rest, ok := strings.CutPrefix(cn, "*."); ok {
+		label, domain, found := strings.Cut(host, ".")
+		return found && label != "" && domain == rest
+	}
+	return cn == host
+}
+
+// certCheck — сертификаты из ssl_cert_file и ssl_ca_file: сроки, стойкость
+// ключа и подписи, полнота цепочки, имя сервера. Как и tlsConfigCheck,
+// выполняется при прочитанном postgresql.conf и ssl=on; находки привязаны
+// к правилам, которые зависят от сертификата. Нечитаемые файлы уже
+// сообщает tlsFileUnreadable.
+type certCheck struct{}
+
+func (certCheck) Codes() []CheckInfo {
+	return []CheckInfo{infoCertExpired, infoCertExpiring, infoCertWeakKey, infoCertWeakSignature,
+		infoCertChainIncomplete, infoCertChainUnverified, infoCertHostnameMismatch, infoCertInvalid}
+}
+
+func (certCheck) Run(ctx *Context) []Issue {
+	server := ctx.Config.Server
+	if server == nil || !ctx.Config.SSLOn {
+		return nil
+	}
+	deps := tlsDependents(ctx.Rules)
+	if len(deps) == 0 {
+		return nil
+	}
+	now := ctx.Config.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	days := ctx.Config.CertExpiryDays
+	if days == 0 {
+		days = DefaultCertExpiryDays
+	}
+
+	var issues []Issue
+	load := func(name string, deps []Rule, what string) []*x509.Certificate {
+		s := server.Get(name)
+		if s.Value == "" || len(deps) == 0 {
+			return nil
+		}
+		certs, err := ReadCertificates(s.Value)
+		if os.IsNotExist(err) || os.IsPermission(err) {
+			return nil
+		}
+		if err != nil {
+			issues = append(issues, dependentIssue(infoCertInvalid, deps, fmt.Sprintf(
+				"%s (%s): %v; %s on it.", name, s.Origin(), err, dependents(deps, what))))
+			return nil
+		}
+		for _, c := range certs {
+			issues = append(issues, certIssues(c, name, s.Value, now, days, deps, what)...)
+		}
+		return certs
+	}
+
+	chain := load("ssl_cert_file", deps, "hostssl")
+	// ssl_ca_file нужен только правилам с сертификатом клиента и проверяется
+	// сам по себе (сроки, ключ, подпись)
+	load("ssl_ca_file", clientCertDependents(deps), "client certificate")
+	if len(chain) == 0 {
+		return issues
+	}
+	certFile := server.Get("ssl_cert_file").Value
+	if gap, stray := chainGap(chain); gap != nil && stray {
+		issues = append(issues, dependentIssue(infoCertChainIncomplete, deps, fmt.Sprintf(
+			"ssl_cert_file %s: issuer %q of %s is not in the file; clients cannot build the chain; %s on it.",
+			certFile, gap.Issuer.String(), certName(gap), dependents(deps, "hostssl"))))
+	} else if gap != nil {
+		issues = append(issues, dependentIssue(infoCertChainUnverified, deps, fmt.Sprintf(
+			"ssl_cert_file %s contains only %s; its issuer %q is not in the system trust store: clients need it in root.crt, and if it is an intermediate CA, append it to the file; %s on it.",
+			certFile, certName(gap), gap.Issuer.String(), dependents(deps, "hostssl"))))
+	}
+	if host := ctx.Config.ServerHostname; host != "" && !certMatchesHost(chain[0], host) {
+		names := append(append([]string(nil), chain[0].DNSNames...), ipStrings(chain[0].IPAddresses)...)
+		if len(names) == 0 {
+			names = []string{certName(chain[0])}
+		}
+		issues = append(issues, dependentIssue(infoCertHostnameMismatch, deps, fmt.Sprintf(
+			"Server certificate %s does not match %s (names: %s); sslmode=verify-full clients will fail; %s on it.",
+			certFile, host, strings.Join(names, ", "), dependents(deps, "hostssl"))))
+	}
+	return issues
+}
+
+// certIssues — находки по одному сертификату файла name (path).
+func certIssues(c *x509.Certificate, name, path string, now time.Time, days int, deps []Rule, what string) []Issue {
+	var issues []Issue
+	where := fmt.Sprintf("%s in %s %s", certName(c), name, path)
+	tail := dependents(deps, what) + " on it."
+	switch {
+	case now.After(c.NotAfter):
+		issues = append(issues, dependentIssue(infoCertExpired, deps, fmt.Sprintf(
+			"Certificate %s expired on %s; %s", where, c.NotAfter.UTC().Format(time.DateOnly), tail)))
+	case now.Before(c.NotBefore):
+		issues = append(issues, dependentIssue(infoCertExpired, deps, fmt.Sprintf(
+			"Certificate %s is not valid until %s; %s", where, c.NotBefore.UTC().Format(time.DateOnly), tail)))
+	case c.NotAfter.Sub(now) < time.Duration(days)*24*time.Hour:
+		issues = append(issues, dependentIssue(infoCertExpiring, deps, fmt.Sprintf(
+			"Certificate %s expires on %s (in %d days); %s",
+			where, c.NotAfter.UTC().Format(time.DateOnly), int(c.NotAfter.Sub(now).Hours()/24), tail)))
+	}
+	if k := weakKey(c); k != "" {
+		issues = append(issues, dependentIssue(infoCertWeakKey, deps, fmt.Sprintf(
+			"Certificate %s has a weak key (%s); %s", where, k, tail)))
+	}
+	// подпись самоподписанного корня никто не проверяет
+	if weakSignature(c) && !selfSigned(c) {
+		issues = append(issues, dependentIssue(infoCertWeakSignature, deps, fmt.Sprintf(
+			"Certificate %s is signed with %s; %s", where, c.SignatureAlgorithm, tail)))
+	}
+	return issues
+}
+
+func ipStrings(ips []net.IP) []string {
+	out := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		out = append(out, ip.String())
+	}
+	return out
+}
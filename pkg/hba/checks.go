@@ -3,6 +3,7 @@ package hba
 import (
 	"fmt"
 	"strings"
+	"time"
 )
 
 // Config — контекст для проверок (глобальные настройки инстанса).
@@ -12,187 +13,409 @@ type Config struct {
 	Ident  IdentMap // содержимое pg_ident для проверки map
 	WideV4 int      // порог «широкой» сети IPv4 (префикс <=)
 	WideV6 int      // порог «широкой» сети IPv6 (префикс <=)
+	Roles  Roles    // каталог ролей для samerole/+group (может быть пустым)
+	// Strength — шкала силы методов; пустая — DefaultStrength.
+	Strength Strength
+	Enable   []string // если не пусто — выдавать только эти коды
+	Disable  []string // коды, которые не выдавать
+	// Severity — уровень вместо уровня по умолчанию для кода.
+	Severity map[string]Severity
+	// Thresholds — пороги широких сетей по типу правила (вместо WideV4/WideV6).
+	Thresholds map[string]Threshold
+	// PGVersion — целевая мажорная версия PostgreSQL (0 — не задана,
+	// версионные проверки не выполняются).
+	PGVersion int
+	// Includes — директивы include* из файла (ParseIncludes).
+	Includes []Include
+	// Assertions — утверждения политики доступа (policyViolation).
+	Assertions []Assertion
+	// Directives — комментарии hba-check:ignore/disable (LoadDirectives или
+	// ParseDirectives для одного файла).
+	Directives []Directive
+	// Server — параметры postgresql.conf (LoadPGConf); nil — не читался.
+	// SSLOn берётся из него через ServerConfig.Apply.
+	Server *ServerConfig
+	// CertExpiryDays — за сколько дней до истечения сертификата выдавать
+	// certExpiring; 0 — DefaultCertExpiryDays.
+	CertExpiryDays int
+	// ServerHostname — имя, по которому клиенты подключаются с
+	// sslmode=verify-full; пусто — имя в сертификате не проверяется.
+	ServerHostname string
+	// Now — момент, на который проверяются сроки сертификатов; нулевой —
+	// текущее время.
+	Now time.Time
 }
 
-// CheckAll запускает все проверки: простые (по отдельной строке) и перекрытия.
+// wide — пороги широкой сети для типа правила.
+func (c Config) wide(typ string) (int, int) {
+	v4, v6 := c.WideV4, c.WideV6
+	if t, ok := c.Thresholds[typ]; ok {
+		if t.WideV4 != 0 {
+			v4 = t.WideV4
+		}
+		if t.WideV6 != 0 {
+			v6 = t.WideV6
+		}
+	}
+	return v4, v6
+}
+
+// CheckAll запускает все включённые проверки DefaultRegistry: простые
+// (по отдельной строке) и перекрытия.
 func CheckAll(rules []Rule, cfg Config) []Issue {
-	var issues []Issue
-	issues = append(issues, CheckSimpleRules(rules, cfg)...)
-	issues = append(issues, CheckOverlaps(rules)...)
-	return issues
+	return DefaultRegistry.Run(rules, cfg)
 }
 
 // CheckSimpleRules реализует «простые» проверки из readme: небезопасные методы,
-// широкие сети, replication, ident/peer/clientcert и т.д.
+// широкие сети, replication, ident/peer/clientcert и т.д. — все построчные
+// проверки DefaultRegistry без учёта Enable/Disable.
 func CheckSimpleRules(rules []Rule, cfg Config) []Issue {
+	ctx := NewContext(rules, cfg)
 	var issues []Issue
-	if cfg.WideV4 == 0 {
-		cfg.WideV4 = 16
-	}
-	if cfg.WideV6 == 0 {
-		cfg.WideV6 = 48
-	}
 	for _, r := range rules {
-		// trust по сети — прямое отключение аутентификации.
-		if r.IsHost() && r.Method == "trust" {
-			issues = append(issues, Issue{
-				Severity: SeverityError,
-				Code:     "trustNetwork",
-				Line:     r.Line,
-				Message:  "Unsafe: trust for network connections. Any client can log in as any user without a password.",
-			})
-		}
-
-		// method=password: при ssl=off всегда ошибка; при ssl=on ошибка, если не hostssl.
-		if r.Method == "password" {
-			if cfg.SSLOn {
-				if r.Type == "hostssl" {
-					issues = append(issues, Issue{
-						Severity: SeverityWarn,
-						Code:     "passwordWithTLS",
-						Line:     r.Line,
-						Message:  "Password method sends cleartext password. Use scram-sha-256 or stronger.",
-					})
-				} else {
-					issues = append(issues, Issue{
-						Severity: SeverityError,
-						Code:     "passwordNoTLS",
-						Line:     r.Line,
-						Message:  "Unsafe: password method without guaranteed TLS. Use hostssl + scram-sha-256.",
-					})
-				}
-			} else { // ssl=off
-				issues = append(issues, Issue{
-					Severity: SeverityError,
-					Code:     "passwordNoSSL",
-					Line:     r.Line,
-					Message:  "SSL is off; method=password always sends credentials in cleartext.",
-				})
+		for _, c := range DefaultRegistry.checks {
+			if rc, ok := c.(RuleCheck); ok {
+				issues = append(issues, rc.Check(ctx, r)...)
 			}
 		}
+	}
+	return issues
+}
 
-		if cfg.SSLOn {
-			if (r.Type == "host" || r.Type == "hostnossl") && !r.Addr.IsLoopbackOnly() {
-				issues = append(issues, Issue{
-					Severity: SeverityWarn,
-					Code:     "nonTLSPath",
-					Line:     r.Line,
-					Message:  "Non-TLS path exists (host/hostnossl). If TLS is required, switch to hostssl.",
-				})
-			}
-		} else {
-			// ssl=off: любые hostssl правила никогда не сработают.
-			if r.Type == "hostssl" {
-				issues = append(issues, Issue{
-					Severity: SeverityError,
-					Code:     "hostsslNoSSL",
-					Line:     r.Line,
-					Message:  "Server ssl=off: hostssl rule will never match. Enable ssl or change to host with proper security.",
-				})
-			}
-		}
+const (
+	docsHBA      = "https://www.postgresql.org/docs/current/auth-pg-hba-conf.html"
+	docsTrust    = "https://www.postgresql.org/docs/current/auth-trust.html"
+	docsPassword = "https://www.postgresql.org/docs/current/auth-password.html"
+	docsIdent    = "https://www.postgresql.org/docs/current/auth-ident.html"
+	docsPeer     = "https://www.postgresql.org/docs/current/auth-peer.html"
+	docsSSL      = "https://www.postgresql.org/docs/current/ssl-tcp.html"
+	docsCert     = "https://www.postgresql.org/docs/current/auth-cert.html"
+	docsLDAP     = "https://www.postgresql.org/docs/current/auth-ldap.html"
+	docsRADIUS   = "https://www.postgresql.org/docs/current/auth-radius.html"
+	docsPAM      = "https://www.postgresql.org/docs/current/auth-pam.html"
+	docsRepl     = "https://www.postgresql.org/docs/current/warm-standby.html#STREAMING-REPLICATION-AUTHENTICATION"
+)
 
-		// md5 — deprecated, подсказка на миграцию.
-		if r.Method == "md5" {
-			issues = append(issues, Issue{
-				Severity: SeverityWarn,
-				Code:     "md5Deprecated",
-				Line:     r.Line,
-				Message:  "MD5 auth is deprecated. Migrate to scram-sha-256.",
-			})
-		}
+var (
+	infoTrustNetwork = CheckInfo{
+		Code: "trustNetwork", Severity: SeverityError,
+		Description: "Network rule with trust authentication.",
+		Rationale:   "Anyone who can reach the port logs in as any user without a password.",
+		Remediation: "Use scram-sha-256 or cert; keep trust only for local sockets if at all.",
+		DocsURL:     docsTrust,
+	}
+	infoPasswordWithTLS = CheckInfo{
+		Code: "passwordWithTLS", Severity: SeverityWarn,
+		Description: "password method over hostssl.",
+		Rationale:   "The server receives the cleartext password; a compromised server or log leaks it.",
+		Remediation: "Switch to scram-sha-256 or cert.",
+		DocsURL:     docsPassword,
+	}
+	infoPasswordNoTLS = CheckInfo{
+		Code: "passwordNoTLS", Severity: SeverityError,
+		Description: "Cleartext-password method (password, ldap, pam, radius, bsd) without guaranteed encryption.",
+		Rationale:   "With host/hostnossl the client sends the cleartext password, possibly unencrypted.",
+		Remediation: "Use hostssl (or hostgssenc), or switch to scram-sha-256.",
+		DocsURL:     docsPassword,
+	}
+	infoPasswordNoSSL = CheckInfo{
+		Code: "passwordNoSSL", Severity: SeverityError,
+		Description: "Cleartext-password method (password, ldap, pam, radius, bsd) while the server has ssl=off.",
+		Rationale:   "Every password is sent in cleartext over the network.",
+		Remediation: "Enable ssl and use hostssl, or switch to scram-sha-256.",
+		DocsURL:     docsPassword,
+	}
+	infoLDAPNoTLS = CheckInfo{
+		Code: "ldapNoTLS", Severity: SeverityError,
+		Description: "ldap rule that talks to the LDAP server without TLS.",
+		Rationale:   "The server forwards the user's cleartext password to the LDAP server; without ldaptls=1 or ldaps it crosses the network unencrypted.",
+		Remediation: "Add ldaptls=1 or ldapscheme=ldaps (or an ldaps:// ldapurl).",
+		DocsURL:     docsLDAP,
+	}
+	infoNonTLSPath = CheckInfo{
+		Code: "nonTLSPath", Severity: SeverityWarn,
+		Description: "host/hostnossl rule for non-loopback addresses while ssl=on.",
+		Rationale:   "Clients may connect without encryption even though the server supports TLS.",
+		Remediation: "Use hostssl for network clients.",
+		DocsURL:     docsSSL,
+	}
+	infoHostsslNoSSL = CheckInfo{
+		Code: "hostsslNoSSL", Severity: SeverityError,
+		Description: "hostssl rule while the server has ssl=off.",
+		Rationale:   "The rule never matches, so the intended access path does not exist.",
+		Remediation: "Enable ssl or remove the rule.",
+		DocsURL:     docsSSL,
+	}
+	infoMD5Deprecated = CheckInfo{
+		Code: "md5Deprecated", Severity: SeverityWarn,
+		Description: "md5 authentication.",
+		Rationale:   "md5 is deprecated and weak against stolen hashes.",
+		Remediation: "Re-hash passwords with password_encryption=scram-sha-256 and switch the method.",
+		DocsURL:     docsPassword,
+	}
+	infoWideAddress = CheckInfo{
+		Code: "wideAddress", Severity: SeverityWarn,
+		Description: "Address range wider than the configured threshold.",
+		Rationale:   "Wide ranges grant access to far more hosts than usually intended.",
+		Remediation: "Narrow the CIDR to the client subnets that need access.",
+		DocsURL:     docsHBA,
+	}
+	infoAllDbAllUser = CheckInfo{
+		Code: "allDbAllUser", Severity: SeverityWarn,
+		Description: "Rule with database=all and user=all.",
+		Rationale:   "No segmentation between databases and roles.",
+		Remediation: "List the databases and roles (or +groups) that need access.",
+		DocsURL:     docsHBA,
+	}
+	infoReplicationWide = CheckInfo{
+		Code: "replicationWideAccess", Severity: SeverityError,
+		Description: "Replication allowed from a wide network or for all users.",
+		Rationale:   "A replication connection can stream the whole cluster.",
+		Remediation: "Restrict to replica addresses and a dedicated replication role.",
+		DocsURL:     docsRepl,
+	}
+	infoIdentNoMap = CheckInfo{
+		Code: "identNoMap", Severity: SeverityWarn,
+		Description: "ident method without map=.",
+		Rationale:   "Without a map the OS user name must equal the role name, which is rarely intended.",
+		Remediation: "Add map= and the matching pg_ident.conf entries.",
+		DocsURL:     docsIdent,
+	}
+	infoIdentMapMissing = CheckInfo{
+		Code: "identMapMissing", Severity: SeverityError,
+		Description: "ident map is missing from pg_ident.conf.",
+		Rationale:   "The rule cannot authenticate anyone.",
+		Remediation: "Define the map in pg_ident.conf or fix the name.",
+		DocsURL:     docsIdent,
+	}
+	infoPeerNonLocal = CheckInfo{
+		Code: "peerNonLocal", Severity: SeverityError,
+		Description: "peer method in a network rule.",
+		Rationale:   "peer works only over Unix sockets; the server rejects such a file.",
+		Remediation: "Use local for peer or another method for host rules.",
+		DocsURL:     docsPeer,
+	}
+	infoLocalAllAll = CheckInfo{
+		Code: "localAllAll", Severity: SeverityWarn,
+		Description: "local all/all with trust or peer.",
+		Rationale:   "Any local OS user reaches any database.",
+		Remediation: "Limit to specific roles (e.g. postgres) or require a password.",
+		DocsURL:     docsHBA,
+	}
+	infoClientcertNonHostssl = CheckInfo{
+		Code: "clientcertNonHostssl", Severity: SeverityError,
+		Description: "clientcert option outside hostssl.",
+		Rationale:   "The server rejects clientcert on non-SSL rules.",
+		Remediation: "Change the rule to hostssl or drop the option.",
+		DocsURL:     docsCert,
+	}
+	infoClientcertInvalid = CheckInfo{
+		Code: "clientcertInvalid", Severity: SeverityError,
+		Description: "clientcert with a value other than verify-ca or verify-full.",
+		Rationale:   "The server rejects unknown clientcert values.",
+		Remediation: "Use clientcert=verify-full (or verify-ca).",
+		DocsURL:     docsCert,
+	}
+)
 
-		// Широкие сети подсвечиваем, чтобы стянуть диапазон.
-		if r.IsHost() && r.Addr.IsWideWith(cfg.WideV4, cfg.WideV6) {
-			issues = append(issues, Issue{
-				Severity: SeverityWarn,
-				Code:     "wideAddress",
-				Line:     r.Line,
-				Message:  fmt.Sprintf("Address range is too wide: %s.", r.Addr.OrigToken),
-			})
-		}
+func init() {
+	for _, c := range []RuleCheck{
+		{[]CheckInfo{infoTrustNetwork}, checkTrustNetwork},
+		{[]CheckInfo{infoPasswordWithTLS, infoPasswordNoTLS, infoPasswordNoSSL}, checkPassword},
+		{[]CheckInfo{infoLDAPNoTLS}, checkLDAPTLS},
+		{[]CheckInfo{infoNonTLSPath, infoHostsslNoSSL}, checkTLSPath},
+		{[]CheckInfo{infoMD5Deprecated}, checkMD5},
+		{[]CheckInfo{infoWideAddress}, checkWideAddress},
+		{[]CheckInfo{infoAllDbAllUser}, checkAllDbAllUser},
+		{[]CheckInfo{infoReplicationWide}, checkReplicationWide},
+		{[]CheckInfo{infoIdentNoMap, infoIdentMapMissing}, checkIdent},
+		{[]CheckInfo{infoPeerNonLocal}, checkPeerNonLocal},
+		{[]CheckInfo{infoLocalAllAll}, checkLocalAllAll},
+		{[]CheckInfo{infoClientcertNonHostssl, infoClientcertInvalid}, checkClientcert},
+		{[]CheckInfo{infoUnknownOption, infoOptionWrongMethod, infoOptionInvalidValue}, checkOptionNames},
+		{[]CheckInfo{infoLDAPMissingServer, infoLDAPMissingMode, infoLDAPMixedBind, infoLDAPSearchAttrFilter, infoLDAPInvalidURL}, checkLDAPOptions},
+		{[]CheckInfo{infoRADIUSMissingOption, infoRADIUSListMismatch}, checkRADIUSOptions},
+		{[]CheckInfo{infoClientnameInvalid, infoClientcertCertMethod}, checkCertOptions},
+		{[]CheckInfo{infoPAMOptionInvalid}, checkPAMOptions},
+		{[]CheckInfo{infoRegexUnsupported}, checkRegexTokens},
+	} {
+		DefaultRegistry.MustRegister(c)
+	}
+	DefaultRegistry.MustRegister(overlapCheck{})
+	DefaultRegistry.MustRegister(catchAllCheck{})
+	DefaultRegistry.MustRegister(tlsConfigCheck{})
+	DefaultRegistry.MustRegister(certCheck{})
+	DefaultRegistry.MustRegister(versionCheck{})
+	DefaultRegistry.MustRegister(assertionCheck{})
+	DefaultRegistry.MustRegister(suppressionCheck{})
+}
 
-		// all/all — отсутствие сегментации.
-		if containsToken(r.DBs, "all") && containsToken(r.Users, "all") {
-			issues = append(issues, Issue{
-				Severity: SeverityWarn,
-				Code:     "allDbAllUser",
-				Line:     r.Line,
-				Message:  "Overly broad access: database=all and user=all.",
-			})
-		}
+// trust по сети — прямое отключение аутентификации.
+func checkTrustNetwork(ctx *Context, r Rule) []Issue {
+	if r.IsHost() && r.Method == "trust" {
+		return []Issue{infoTrustNetwork.NewIssue(r.Line,
+			"Unsafe: trust for network connections. Any client can log in as any user without a password.")}
+	}
+	return nil
+}
 
-		// replication должна быть максимально узкой.
-		if r.HasDB("replication") && r.Method != "reject" {
-			if r.Addr.IsWideWith(cfg.WideV4, cfg.WideV6) || r.HasUser("all") {
-				issues = append(issues, Issue{
-					Severity: SeverityError,
-					Code:     "replicationWideAccess",
-					Line:     r.Line,
-					Message:  "Replication access from wide network or all users. Restrict to replica IPs and dedicated user.",
-				})
-			}
-		}
+// CleartextMethod — клиент отправляет серверу пароль открытым текстом:
+// password и методы, проверяющие пароль во внешней системе (ldap, pam,
+// radius, bsd). Для них шифрование транспорта обязательно.
+func CleartextMethod(method string) bool {
+	switch method {
+	case "password", "ldap", "pam", "radius", "bsd":
+		return true
+	}
+	return false
+}
 
-		// ident без map — предупреждение; с несуществующим map — ошибка.
-		if r.Method == "ident" {
-			mapName := strings.ToLower(r.Opts["map"])
-			if mapName == "" {
-				issues = append(issues, Issue{
-					Severity: SeverityWarn,
-					Code:     "identNoMap",
-					Line:     r.Line,
-					Message:  "Ident used without map=. Add a map and ensure pg_ident entries exist.",
-				})
-			} else if !cfg.Ident.Has(mapName) {
-				issues = append(issues, Issue{
-					Severity: SeverityError,
-					Code:     "identMapMissing",
-					Line:     r.Line,
-					Message:  "Ident map is missing in pg_ident.",
-				})
-			}
-		}
+// encryptedPath — правило подходит только под подключения, где пароль не
+// идёт по сети открытым текстом: unix-сокет, TLS или GSSAPI-шифрование.
+func encryptedPath(r Rule) bool {
+	return r.Type == "local" || r.Type == "hostssl" || r.Type == "hostgssenc"
+}
 
-		// peer допустим только для local.
-		if r.Method == "peer" && r.Type != "local" {
-			issues = append(issues, Issue{
-				Severity: SeverityError,
-				Code:     "peerNonLocal",
-				Line:     r.Line,
-				Message:  "Peer auth is valid only for local connections.",
-			})
-		}
-		// local trust/peer all/all — слишком общий локальный доступ.
-		if r.Type == "local" && (r.Method == "trust" || r.Method == "peer") && containsToken(r.DBs, "all") && containsToken(r.Users, "all") {
-			issues = append(issues, Issue{
-				Severity: SeverityWarn,
-				Code:     "localAllAll",
-				Line:     r.Line,
-				Message:  "Local all/all with trust or peer is overly broad.",
-			})
-		}
+// Методы с паролем открытым текстом: без TLS пароль можно перехватить,
+// а password даже в TLS отдаёт серверу исходный пароль.
+func checkPassword(ctx *Context, r Rule) []Issue {
+	if !CleartextMethod(r.Method) {
+		return nil
+	}
+	if r.Method == "password" && r.Type == "hostssl" && ctx.Config.SSLOn {
+		return []Issue{infoPasswordWithTLS.NewIssue(r.Line,
+			"Password method sends cleartext password. Use scram-sha-256 or stronger.")}
+	}
+	if r.Type == "local" || r.Type == "hostgssenc" {
+		return nil
+	}
+	if !ctx.Config.SSLOn {
+		return []Issue{infoPasswordNoSSL.NewIssue(r.Line,
+			fmt.Sprintf("SSL is off%s; method=%s always sends credentials in cleartext.", ctx.Config.sslSource(), r.Method))}
+	}
+	if encryptedPath(r) {
+		return nil
+	}
+	return []Issue{infoPasswordNoTLS.NewIssue(r.Line,
+		fmt.Sprintf("Unsafe: %s method without guaranteed TLS. Use hostssl + scram-sha-256.", r.Method))}
+}
+
+// ldap пересылает пароль пользователя LDAP-серверу: без ldaptls=1/ldaps он
+// идёт по сети открытым текстом, даже если клиент подключён по TLS.
+func checkLDAPTLS(ctx *Context, r Rule) []Issue {
+	if r.Method != "ldap" {
+		return nil
+	}
+	if optValue(r.Opts["ldaptls"]) == "1" || optValue(r.Opts["ldapscheme"]) == "ldaps" ||
+		strings.HasPrefix(strings.ToLower(optValue(r.Opts["ldapurl"])), "ldaps://") {
+		return nil
+	}
+	return []Issue{infoLDAPNoTLS.NewIssue(r.Line,
+		"LDAP password is forwarded to the LDAP server without TLS. Add ldaptls=1 or ldapscheme=ldaps.")}
+}
 
-		if v, ok := r.Opts["clientcert"]; ok {
-			if r.Type != "hostssl" {
-				issues = append(issues, Issue{
-					Severity: SeverityError,
-					Code:     "clientcertNonHostssl",
-					Line:     r.Line,
-					Message:  "clientcert is allowed only for hostssl.",
-				})
-			} else {
-				val := strings.ToLower(v)
-				if val != "verify-ca" && val != "verify-full" {
-					issues = append(issues, Issue{
-						Severity: SeverityError,
-						Code:     "clientcertInvalid",
-						Line:     r.Line,
-						Message:  "clientcert must be verify-ca or verify-full.",
-					})
-				}
+// ssl=on: есть путь без TLS; ssl=off: hostssl никогда не сработает.
+func checkTLSPath(ctx *Context, r Rule) []Issue {
+	if ctx.Config.SSLOn {
+		if (r.Type == "host" || r.Type == "hostnossl") && !r.Addr.IsLoopbackOnly() {
+			msg := "Non-TLS path exists (host/hostnossl). If TLS is required, switch to hostssl."
+			if src := ctx.Config.sslSource(); src != "" {
+				msg = fmt.Sprintf("Non-TLS path exists (host/hostnossl) although ssl is on%s. If TLS is required, switch to hostssl.", src)
 			}
+			return []Issue{infoNonTLSPath.NewIssue(r.Line, msg)}
 		}
+		return nil
 	}
-	return issues
+	if r.Type == "hostssl" {
+		return []Issue{infoHostsslNoSSL.NewIssue(r.Line, fmt.Sprintf(
+			"Server ssl=off%s: hostssl rule will never match. Enable ssl or change to host with proper security.", ctx.Config.sslSource()))}
+	}
+	return nil
+}
+
+// md5 — deprecated, подсказка на миграцию.
+func checkMD5(ctx *Context, r Rule) []Issue {
+	if r.Method == "md5" {
+		return []Issue{infoMD5Deprecated.NewIssue(r.Line, "MD5 auth is deprecated. Migrate to scram-sha-256.")}
+	}
+	return nil
+}
+
+// Широкие сети подсвечиваем, чтобы стянуть диапазон.
+func checkWideAddress(ctx *Context, r Rule) []Issue {
+	if r.IsHost() && r.Addr.IsWideWith(ctx.Config.wide(r.Type)) {
+		return []Issue{infoWideAddress.NewIssue(r.Line, fmt.Sprintf("Address range is too wide: %s.", r.Addr.OrigToken))}
+	}
+	return nil
+}
+
+// all/all — отсутствие сегментации.
+func checkAllDbAllUser(ctx *Context, r Rule) []Issue {
+	if containsToken(r.DBs, "all") && containsToken(r.Users, "all") {
+		return []Issue{infoAllDbAllUser.NewIssue(r.Line, "Overly broad access: database=all and user=all.")}
+	}
+	return nil
+}
+
+// replication должна быть максимально узкой.
+func checkReplicationWide(ctx *Context, r Rule) []Issue {
+	if !r.HasDB("replication") || r.Method == "reject" {
+		return nil
+	}
+	if r.Addr.IsWideWith(ctx.Config.wide(r.Type)) || r.HasUser("all") {
+		return []Issue{infoReplicationWide.NewIssue(r.Line,
+			"Replication access from wide network or all users. Restrict to replica IPs and dedicated user.")}
+	}
+	return nil
+}
+
+// ident без map — предупреждение; с несуществующим map — ошибка.
+func checkIdent(ctx *Context, r Rule) []Issue {
+	if r.Method != "ident" {
+		return nil
+	}
+	mapName := strings.ToLower(r.Opts["map"])
+	if mapName == "" {
+		return []Issue{infoIdentNoMap.NewIssue(r.Line,
+			"Ident used without map=. Add a map and ensure pg_ident entries exist.")}
+	}
+	if !ctx.Config.Ident.Has(mapName) {
+		return []Issue{infoIdentMapMissing.NewIssue(r.Line, "Ident map is missing in pg_ident.")}
+	}
+	return nil
+}
+
+// peer допустим только для local.
+func checkPeerNonLocal(ctx *Context, r Rule) []Issue {
+	if r.Method == "peer" && r.Type != "local" {
+		return []Issue{infoPeerNonLocal.NewIssue(r.Line, "Peer auth is valid only for local connections.")}
+	}
+	return nil
+}
+
+// local trust/peer all/all — слишком общий локальный доступ.
+func checkLocalAllAll(ctx *Context, r Rule) []Issue {
+	if r.Type == "local" && (r.Method == "trust" || r.Method == "peer") && containsToken(r.DBs, "all") && containsToken(r.Users, "all") {
+		return []Issue{infoLocalAllAll.NewIssue(r.Line, "Local all/all with trust or peer is overly broad.")}
+	}
+	return nil
+}
+
+func checkClientcert(ctx *Context, r Rule) []Issue {
+	v, ok := r.Opts["clientcert"]
+	if !ok {
+		return nil
+	}
+	if r.Type != "hostssl" {
+		return []Issue{infoClientcertNonHostssl.NewIssue(r.Line, "clientcert is allowed only for hostssl.")}
+	}
+	val := strings.ToLower(v)
+	if ctx.Config.PGVersion > 0 && (val == "1" || val == "0" || val == "no-verify") {
+		// допустимость старых значений зависит от версии — это unsupportedFeature
+		return nil
+	}
+	if val != "verify-ca" && val != "verify-full" {
+		return []Issue{infoClientcertInvalid.NewIssue(r.Line, "clientcert must be verify-ca or verify-full.")}
+	}
+	return nil
 }
@@ -0,0 +1,108 @@
+package hba
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// Difference — класс подключений, для которого два набора правил дают разный
+// результат первого совпадения. Example — конкретное подключение из класса,
+// Old/New — что выберет каждый файл (с номером строки).
+type Difference struct {
+	Transport   Transport  `json:"transport"`
+	Replication bool       `json:"replication"`
+	Databases   []string   `json:"databases"`
+	Users       []string   `json:"users"`
+	Addresses   []string   `json:"addresses,omitempty"`
+	Example     Connection `json:"example"`
+	Old         Outcome    `json:"old"`
+	New         Outcome    `json:"new"`
+}
+
+// Compare проверяет семантическую эквивалентность двух наборов правил: строит
+// общее разбиение (NewSpace) и сравнивает результат для каждого класса.
+// Адресные области одного класса (БД, пользователь) с одинаковой парой
+// результатов склеиваются, так что каждое отличие — минимальный набор
+// контрпримеров с одним представителем. Пустой результат — файлы эквивалентны.
+func Compare(oldRules, newRules []Rule, roles Roles) []Difference {
+	return compare(oldRules, newRules, roles, Outcome.Same)
+}
+
+// compare — Compare с заданным отношением «результаты совпадают».
+func compare(oldRules, newRules []Rule, roles Roles, same func(a, b Outcome) bool) []Difference {
+	space := NewSpace(roles, oldRules, newRules)
+	all := append(append([]Rule{}, oldRules...), newRules...)
+
+	type diffKey struct {
+		transport Transport
+		principal *PrincipalClass
+		old, new  Outcome
+	}
+	var diffs []Difference
+	var prefixes [][]netip.Prefix
+	index := map[diffKey]int{}
+	for _, cell := range space.Cells() {
+		sample := cell.Sample()
+		o := Evaluate(oldRules, sample, roles)
+		n := Evaluate(newRules, sample, roles)
+		if same(o, n) {
+			continue
+		}
+		key := diffKey{cell.Transport, cell.Principal, o, n}
+		k, ok := index[key]
+		if !ok {
+			k = len(diffs)
+			index[key] = k
+			diffs = append(diffs, Difference{
+				Transport:   cell.Transport,
+				Replication: cell.Principal.Replication,
+				Databases:   cell.Principal.Databases,
+				Users:       cell.Principal.Users,
+				Example:     readableNames(sample, roles, all...),
+				Old:         o,
+				New:         n,
+			})
+			prefixes = append(prefixes, nil)
+		}
+		if cell.Addr != nil {
+			prefixes[k] = append(prefixes[k], cell.Addr.Prefixes...)
+		}
+	}
+	for k := range diffs {
+		diffs[k].Addresses = (&AddrClass{Prefixes: mergePrefixes(prefixes[k])}).AddrStrings()
+	}
+	return diffs
+}
+
+// Equivalent — оба набора правил дают одинаковый результат для любого подключения.
+func Equivalent(oldRules, newRules []Rule, roles Roles) bool {
+	return len(Compare(oldRules, newRules, roles)) == 0
+}
+
+// String — строка отчёта: пример подключения, что выбирает каждый файл, и весь класс.
+func (d Difference) String() string {
+	where := "local"
+	if d.Transport != TransportLocal {
+		where = strings.Join(d.Addresses, " ")
+	}
+	db := strings.Join(d.Databases, ",")
+	if d.Replication {
+		db = "(replication)"
+	}
+	return fmt.Sprintf("%s: old %s, new %s (class: %s db=%s user=%s addr=%s)",
+		d.Example, d.Old, d.New, d.Transport, db, strings.Join(d.Users, ","), where)
+}
+
+// String — «line=N method [опции]» (с file= для включённых файлов) или
+// «implicit reject».
+func (o Outcome) String() string {
+	if o.Line == 0 {
+		return "implicit reject"
+	}
+	s := fmt.Sprintf("%s %s", linePos(o.File, o.Line), o.Method)
+	if o.Options != "" {
+		s += " " + o.Options
+	}
+	return s
+}
@@ -0,0 +1,108 @@
+package hba
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ChangeKind — как изменился доступ для класса подключений.
+type ChangeKind string
+
+const (
+	AccessGained  ChangeKind = "gained"  // раньше отвергалось, теперь аутентифицируется
+	AccessLost    ChangeKind = "lost"    // раньше аутентифицировалось, теперь отвергается
+	AccessChanged ChangeKind = "changed" // аутентифицируется, но другим методом/опциями
+)
+
+// AccessChange — изменение доступа для одного класса подключений.
+// Broadens — изменение расширяет доступ: новый доступ или более слабый метод.
+type AccessChange struct {
+	Kind     ChangeKind `json:"kind"`
+	Broadens bool       `json:"broadens"`
+	Difference
+}
+
+// AccessRegion — изменения, сгруппированные по области адресов
+// («local» для Unix-сокета).
+type AccessRegion struct {
+	Region  string         `json:"region"`
+	Changes []AccessChange `json:"changes"`
+}
+
+// AccessDiff — семантический дифф доступа между двумя версиями файла.
+type AccessDiff struct {
+	Broadens bool           `json:"broadens"`
+	Regions  []AccessRegion `json:"regions"`
+}
+
+// DiffAccess классифицирует отличия Compare на полученный, потерянный и
+// изменённый доступ и группирует их по областям адресов. Ослабление метода
+// оценивается по шкале DefaultStrength.
+func DiffAccess(oldRules, newRules []Rule, roles Roles) AccessDiff {
+	return DiffAccessWith(oldRules, newRules, Config{Roles: roles})
+}
+
+// DiffAccessWith — то же, что DiffAccess, с каталогом ролей и шкалой силы из cfg.
+func DiffAccessWith(oldRules, newRules []Rule, cfg Config) AccessDiff {
+	st := cfg.strength()
+	// пустой массив, а не null: потребителям JSON не нужно его отдельно проверять
+	out := AccessDiff{Regions: []AccessRegion{}}
+	index := map[string]int{}
+	for _, d := range Compare(oldRules, newRules, cfg.Roles) {
+		ch := AccessChange{Difference: d}
+		switch {
+		case !d.Old.Accepts():
+			ch.Kind, ch.Broadens = AccessGained, true
+		case !d.New.Accepts():
+			ch.Kind = AccessLost
+		default:
+			ch.Kind = AccessChanged
+			ch.Broadens = st.weakerOutcome(d.New, d.Old)
+		}
+		out.Broadens = out.Broadens || ch.Broadens
+
+		region := d.region()
+		k, ok := index[region]
+		if !ok {
+			k = len(out.Regions)
+			index[region] = k
+			out.Regions = append(out.Regions, AccessRegion{Region: region})
+		}
+		out.Regions[k].Changes = append(out.Regions[k].Changes, ch)
+	}
+	sort.SliceStable(out.Regions, func(i, j int) bool {
+		return out.Regions[i].Region < out.Regions[j].Region
+	})
+	return out
+}
+
+func (d Difference) region() string {
+	if d.Transport == TransportLocal {
+		return "local"
+	}
+	return strings.Join(d.Addresses, " ")
+}
+
+// String — «gained: user app from 10.2.0.0/16 to db billing (ssl): reject -> trust».
+func (c AccessChange) String() string {
+	db := strings.Join(c.Databases, ",")
+	if c.Replication {
+		db = "(replication)"
+	}
+	return fmt.Sprintf("%s: user %s from %s to db %s (%s): %s -> %s; example %s",
+		c.Kind, strings.Join(c.Users, ","), c.region(), db, c.Transport,
+		c.Old.short(), c.New.short(), c.Example)
+}
+
+// short — метод с опциями и строкой в скобках: «trust (line 3)».
+func (o Outcome) short() string {
+	if o.Line == 0 {
+		return "implicit reject"
+	}
+	m := o.Method
+	if o.Options != "" {
+		m += " " + o.Options
+	}
+	return fmt.Sprintf("%s (%s)", m, Rule{File: o.File, Line: o.Line}.ref())
+}
@@ -0,0 +1,149 @@
+package hba
+
+import (
+	"net"
+	"net/netip"
+	"strings"
+)
+
+// counterexample подбирает конкретное подключение, которое подходит и под upper,
+// и под lower, и при этом реально доходит до upper (ни одно правило из above —
+// всё, что выше upper, — его не перехватывает). Это доказательство находки
+// о перекрытии: подключение, предназначенное нижнему правилу, забирает верхнее.
+// Если upper сам недостижим для общей области, возвращается любое общее
+// подключение — оно всё равно показывает пересечение.
+func counterexample(above []Rule, upper, lower Rule, roles Roles) *Connection {
+	var fallback *Connection
+	for _, c := range overlapCandidates(upper, lower, roles) {
+		if !upper.Matches(c, roles) || !lower.Matches(c, roles) {
+			continue
+		}
+		if _, caught := Simulate(above, c, roles); !caught {
+			c := readableNames(c, roles, upper, lower)
+			return &c
+		}
+		if fallback == nil {
+			c := readableNames(c, roles, upper, lower)
+			fallback = &c
+		}
+	}
+	return fallback
+}
+
+// overlapCandidates перечисляет подключения из общей области двух правил:
+// транспорты, допустимые обоими типами, × адреса на границах и внутри
+// пересекающихся сетей × представители (БД, пользователь).
+func overlapCandidates(a, b Rule, roles Roles) []Connection {
+	var transports []Transport
+	for _, t := range Transports {
+		if typeAllowsTransport(a.Type, t) && typeAllowsTransport(b.Type, t) {
+			transports = append(transports, t)
+		}
+	}
+	addrs := overlapAddrs(a, b)
+	var out []Connection
+	for _, p := range principalConns(roles, a, b) {
+		for _, t := range transports {
+			if t == TransportLocal {
+				c := p
+				c.Transport = t
+				out = append(out, c)
+				continue
+			}
+			for _, ip := range addrs {
+				c := p
+				c.Transport = t
+				c.Addr = ip
+				out = append(out, c)
+			}
+		}
+	}
+	return out
+}
+
+var (
+	docAddr4 = netip.MustParseAddr("192.0.2.10")   // TEST-NET-1, RFC 5737
+	docAddr6 = netip.MustParseAddr("2001:db8::10") // RFC 3849
+)
+
+// overlapAddrs — адреса-кандидаты в пересечении адресов двух правил.
+func overlapAddrs(a, b Rule) []net.IP {
+	var nets []*net.IPNet
+	switch {
+	case a.Addr.Any && b.Addr.Any:
+		nets = []*net.IPNet{mustCIDR("0.0.0.0/0"), mustCIDR("::/0")}
+	case a.Addr.Any:
+		nets = b.Addr.Networks
+	case b.Addr.Any:
+		nets = a.Addr.Networks
+	default:
+		for _, an := range a.Addr.Networks {
+			for _, bn := range b.Addr.Networks {
+				if !sameFamily(an, bn) || !cidrOverlaps(an, bn) {
+					continue
+				}
+				if cidrContains(an, bn) {
+					nets = append(nets, bn)
+				} else {
+					nets = append(nets, an)
+				}
+			}
+		}
+	}
+	var out []net.IP
+	for _, n := range nets {
+		p, ok := toPrefix(n)
+		if !ok {
+			continue
+		}
+		first := p.Addr()
+		last := lastAddr(p)
+		cands := []netip.Addr{first, last}
+		if p.Bits() < first.BitLen()-1 {
+			// адрес хоста выглядит правдоподобнее адреса сети
+			cands = []netip.Addr{first.Next(), last.Prev(), first, last}
+		}
+		// в очень широких сетях берём документационный адрес, а не 0.0.0.1
+		for _, doc := range []netip.Addr{docAddr4, docAddr6} {
+			if p.Bits() <= 8 && p.Contains(doc) {
+				cands = append([]netip.Addr{doc}, cands...)
+			}
+		}
+		for _, c := range cands {
+			out = append(out, net.IP(c.AsSlice()))
+		}
+	}
+	return out
+}
+
+// readableNames заменяет синтетические имена представителей на читаемые,
+// которые не встречаются в правилах (и поэтому ведут себя так же).
+func readableNames(c Connection, roles Roles, rs ...Rule) Connection {
+	used := map[string]bool{}
+	for _, name := range roles.Names() {
+		used[name] = true
+	}
+	for _, r := range rs {
+		for _, tok := range append(append([]string{}, r.DBs...), r.Users...) {
+			used[strings.TrimPrefix(tok, "+")] = true
+		}
+	}
+	fresh := func(base string) string {
+		name := base
+		for i := 2; used[name]; i++ {
+			name = base + strings.Repeat("_", i-1)
+		}
+		return name
+	}
+	rename := map[string]string{otherName: fresh("example"), otherName2: fresh("example_user")}
+	if v, ok := rename[c.Database]; ok {
+		c.Database = v
+	}
+	if v, ok := rename[c.User]; ok {
+		c.User = v
+	}
+	if c.Replication {
+		c.Database = "replication"
+	}
+	return c
+}
@@ -0,0 +1,157 @@
+package hba
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// LoadHBA читает pg_hba.conf и переходит по директивам include,
+// include_if_exists и include_dir, как PostgreSQL 16+: правила включённого
+// файла встают на место директивы, относительные пути считаются от каталога
+// файла с директивой, include_dir берёт файлы *.conf по имени. Правила
+// основного файла получают File == "", включённых — путь к своему файлу.
+// Вместе с правилами возвращаются все директивы include* (и вложенные).
+func LoadHBA(path string) ([]Rule, []Include, error) {
+	f, err := loadHBAFile(path, "", 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	return f.rules, f.includes, nil
+}
+
+// LoadDirectives читает комментарии hba-check: из pg_hba.conf и включённых
+// в него файлов (тот же обход, что у LoadHBA). Директивы включённого файла
+// получают Directive.File и действуют только на его правила.
+func LoadDirectives(path string) ([]Directive, error) {
+	f, err := loadHBAFile(path, "", 0)
+	if err != nil {
+		return nil, err
+	}
+	return f.directives, nil
+}
+
+// hbaFiles — результат обхода pg_hba.conf с включёнными файлами.
+type hbaFiles struct {
+	rules      []Rule
+	includes   []Include
+	directives []Directive
+}
+
+func loadHBAFile(path, file string, depth int) (hbaFiles, error) {
+	var out hbaFiles
+	data, err := readIncluded(path, depth)
+	if err != nil {
+		return out, err
+	}
+	rules, err := ParseHBA(bytes.NewReader(data))
+	if err != nil {
+		return out, fmt.Errorf("failed to parse hba %s: %w", path, err)
+	}
+	includes, err := ParseIncludes(bytes.NewReader(data))
+	if err != nil {
+		return out, err
+	}
+	directives, err := ParseDirectives(bytes.NewReader(data))
+	if err != nil {
+		return out, fmt.Errorf("failed to parse hba-check comments in %s: %w", path, err)
+	}
+	for _, d := range directives {
+		d.File = file
+		out.directives = append(out.directives, d)
+	}
+	next := 0
+	for _, in := range includes {
+		in.File = file
+		out.includes = append(out.includes, in)
+		for ; next < len(rules) && rules[next].Line < in.Line; next++ {
+			rules[next].File = file
+			out.rules = append(out.rules, rules[next])
+		}
+		targets, err := includeTargets(path, in)
+		if err != nil {
+			return out, err
+		}
+		for _, target := range targets {
+			sub, err := loadHBAFile(target, target, depth+1)
+			if err != nil {
+				return out, err
+			}
+			out.rules = append(out.rules, sub.rules...)
+			out.includes = append(out.includes, sub.includes...)
+			out.directives = append(out.directives, sub.directives...)
+		}
+	}
+	for ; next < len(rules); next++ {
+		rules[next].File = file
+		out.rules = append(out.rules, rules[next])
+	}
+	return out, nil
+}
+
+// LoadIdent читает pg_ident.conf вместе с включёнными файлами (PostgreSQL 16+).
+func LoadIdent(path string) (IdentMap, error) {
+	m := IdentMap{Maps: map[string]bool{}}
+	if err := loadIdentFile(m, path, 0); err != nil {
+		return IdentMap{}, err
+	}
+	return m, nil
+}
+
+func loadIdentFile(m IdentMap, path string, depth int) error {
+	data, err := readIncluded(path, depth)
+	if err != nil {
+		return err
+	}
+	for name := range ParseIdent(bytes.NewReader(data)).Maps {
+		m.Maps[name] = true
+	}
+	includes, err := ParseIncludes(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	for _, in := range includes {
+		targets, err := includeTargets(path, in)
+		if err != nil {
+			return err
+		}
+		for _, target := range targets {
+			if err := loadIdentFile(m, target, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// readIncluded читает файл с проверкой глубины вложенности.
+func readIncluded(path string, depth int) ([]byte, error) {
+	if depth > maxConfDepth {
+		return nil, fmt.Errorf("%s: include nesting is deeper than %d levels", path, maxConfDepth)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	return data, nil
+}
+
+// includeTargets — файлы, которые подключает директива из файла from:
+// include_if_exists без файла ничего не подключает.
+func includeTargets(from string, in Include) ([]string, error) {
+	target := resolvePath(filepath.Dir(from), in.Path)
+	switch in.Kind {
+	case "include_if_exists":
+		if _, err := os.Stat(target); os.IsNotExist(err) {
+			return nil, nil
+		}
+	case "include_dir":
+		files, err := confDir(target)
+		if err != nil {
+			return nil, fmt.Errorf("%s: line %d: %w", from, in.Line, err)
+		}
+		return files, nil
+	}
+	return []string{target}, nil
+}
@@ -0,0 +1,213 @@
+package hba
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Transport — способ, которым клиент дошёл до сервера: unix-сокет или TCP
+// с конкретным видом шифрования. От него зависит, какие типы правил применимы.
+type Transport string
+
+const (
+	TransportLocal Transport = "local" // unix-сокет
+	TransportSSL   Transport = "ssl"   // TCP + TLS
+	TransportGSS   Transport = "gss"   // TCP + GSSAPI-шифрование
+	TransportPlain Transport = "plain" // TCP без шифрования
+)
+
+// ParseTransport разбирает имя транспорта из CLI/конфигов.
+func ParseTransport(s string) (Transport, error) {
+	switch t := Transport(strings.ToLower(strings.TrimSpace(s))); t {
+	case TransportLocal, TransportSSL, TransportGSS, TransportPlain:
+		return t, nil
+	}
+	return "", fmt.Errorf("unknown transport: %s", s)
+}
+
+// Connection — конкретная попытка подключения, которую сверяем с правилами.
+// Addr игнорируется для local. Replication — физическая репликация
+// (walsender без БД): отдельный класс подключений, под него подходит только
+// ключевое слово replication, а all — нет. Логическая репликация идёт как
+// обычное подключение к БД.
+type Connection struct {
+	Transport   Transport `json:"transport"`
+	Database    string    `json:"database"`
+	User        string    `json:"user"`
+	Addr        net.IP    `json:"addr,omitempty"`
+	Replication bool      `json:"replication,omitempty"`
+}
+
+func (c Connection) String() string {
+	db := "db=" + c.Database
+	if c.Replication {
+		db = "replication"
+	}
+	if c.Transport == TransportLocal {
+		return fmt.Sprintf("local %s user=%s", db, c.User)
+	}
+	return fmt.Sprintf("%s %s user=%s addr=%s", c.Transport, db, c.User, c.Addr)
+}
+
+// Criterion — критерий правила, по которому подключение не прошло.
+// Порядок проверки повторяет check_hba() в PostgreSQL.
+type Criterion string
+
+const (
+	CriterionType       Criterion = "type"
+	CriterionEncryption Criterion = "encryption"
+	CriterionAddress    Criterion = "address"
+	CriterionDatabase   Criterion = "database"
+	CriterionUser       Criterion = "user"
+)
+
+// Matches сообщает, подходит ли подключение под правило.
+// roles нужен для samerole/samegroup и +group.
+func (r Rule) Matches(c Connection, roles Roles) bool {
+	return r.mismatch(c, roles) == ""
+}
+
+// mismatch возвращает первый не прошедший критерий или "" если правило подходит.
+// Это единое ядро сопоставления: на нём построены симуляция, трассировка и
+// все семантические анализы.
+func (r Rule) mismatch(c Connection, roles Roles) Criterion {
+	if r.IsLocal() != (c.Transport == TransportLocal) || (!r.IsLocal() && !r.IsHost()) {
+		return CriterionType
+	}
+	if !typeAllowsTransport(r.Type, c.Transport) {
+		return CriterionEncryption
+	}
+	if r.IsHost() && !r.Addr.Contains(c.Addr) {
+		return CriterionAddress
+	}
+	if !r.matchDB(c, roles) {
+		return CriterionDatabase
+	}
+	if !r.matchUser(c.User, roles) {
+		return CriterionUser
+	}
+	return ""
+}
+
+// typeAllowsTransport — какие виды шифрования пропускает тип правила.
+func typeAllowsTransport(typ string, t Transport) bool {
+	switch typ {
+	case "local":
+		return t == TransportLocal
+	case "host":
+		return t != TransportLocal
+	case "hostssl":
+		return t == TransportSSL
+	case "hostnossl":
+		return t == TransportGSS || t == TransportPlain
+	case "hostgssenc":
+		return t == TransportGSS
+	case "hostnogssenc":
+		return t == TransportSSL || t == TransportPlain
+	}
+	return false
+}
+
+// typesIntersect — есть транспорт, который пропускают оба типа правил.
+func typesIntersect(a, b string) bool {
+	for _, t := range Transports {
+		if typeAllowsTransport(a, t) && typeAllowsTransport(b, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// typeCovers — каждый транспорт, который пропускает lower, пропускает и upper:
+// host покрывает hostssl, но hostssl не покрывает host (plain и GSS проходят).
+func typeCovers(upper, lower string) bool {
+	for _, t := range Transports {
+		if typeAllowsTransport(lower, t) && !typeAllowsTransport(upper, t) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchDB повторяет check_db(): физическая репликация видит только replication;
+// для обычных подключений sameuser — имя БД равно пользователю,
+// samerole/samegroup — пользователь входит в роль с именем БД.
+func (r Rule) matchDB(c Connection, roles Roles) bool {
+	if c.Replication {
+		return containsToken(r.DBs, "replication")
+	}
+	db := strings.ToLower(c.Database)
+	user := strings.ToLower(c.User)
+	for _, tok := range r.DBs {
+		switch tok {
+		case "replication":
+			// ключевое слово, обычной БД с таким именем не соответствует
+		case "all":
+			return true
+		case "sameuser":
+			if db == user {
+				return true
+			}
+		case "samerole", "samegroup":
+			if roles.IsMember(user, db) {
+				return true
+			}
+		default:
+			if tok == db || isRegexToken(tok) && matchRegexToken(tok, db) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchUser повторяет check_role(): +group — членство в роли.
+func (r Rule) matchUser(user string, roles Roles) bool {
+	user = strings.ToLower(user)
+	for _, tok := range r.Users {
+		switch {
+		case tok == "all" || tok == user:
+			return true
+		case strings.HasPrefix(tok, "+") && roles.IsMember(user, tok[1:]):
+			return true
+		case isRegexToken(tok) && matchRegexToken(tok, user):
+			return true
+		}
+	}
+	return false
+}
+
+// explain формирует человекочитаемую причину несовпадения по критерию.
+func (r Rule) explain(c Connection, crit Criterion) string {
+	switch crit {
+	case CriterionType:
+		if c.Transport == TransportLocal {
+			return fmt.Sprintf("%s rule does not match unix-socket connections", r.Type)
+		}
+		return fmt.Sprintf("%s rule does not match TCP connections", r.Type)
+	case CriterionEncryption:
+		return fmt.Sprintf("%s rule does not match %s transport", r.Type, c.Transport)
+	case CriterionAddress:
+		return fmt.Sprintf("client address %s is outside %s", c.Addr, r.Addr.OrigToken)
+	case CriterionDatabase:
+		if c.Replication {
+			return fmt.Sprintf("replication connection matches only the replication keyword, not %s", strings.Join(r.DBs, ","))
+		}
+		return fmt.Sprintf("database %q not in %s", c.Database, strings.Join(r.DBs, ","))
+	case CriterionUser:
+		return fmt.Sprintf("user %q not in %s", c.User, strings.Join(r.Users, ","))
+	}
+	return ""
+}
+
+// Simulate возвращает первое подходящее правило, как его выбрал бы сервер.
+// false означает неявный reject: ни одно правило не подошло.
+func Simulate(rules []Rule, c Connection, roles Roles) (Rule, bool) {
+	for _, r := range rules {
+		if r.Matches(c, roles) {
+			return r, true
+		}
+	}
+	return Rule{}, false
+}
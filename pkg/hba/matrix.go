@@ -0,0 +1,133 @@
+package hba
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// MatrixRow — одна строка матрицы доступа: класс подключений и метод,
+// который к нему реально применится (первое совпадение).
+type MatrixRow struct {
+	Transport   Transport `json:"transport"`
+	Replication bool      `json:"replication"`
+	Databases   []string  `json:"databases"`
+	Users       []string  `json:"users"`
+	Addresses   []string  `json:"addresses,omitempty"` // пусто для local
+	Outcome
+}
+
+// Matrix — эффективная матрица доступа по всем классам эквивалентности.
+type Matrix struct {
+	Rows []MatrixRow `json:"rows"`
+}
+
+// BuildMatrix разбивает пространство подключений по правилам (NewSpace),
+// считает первое совпадение для каждого класса и склеивает адресные области
+// с одинаковым результатом в одну строку.
+func BuildMatrix(rules []Rule, roles Roles) Matrix {
+	space := NewSpace(roles, rules)
+	var m Matrix
+	type rowKey struct {
+		transport Transport
+		principal *PrincipalClass
+		outcome   Outcome
+	}
+	index := map[rowKey]int{}
+	var prefixes [][]netip.Prefix
+	for _, cell := range space.Cells() {
+		out := Evaluate(rules, cell.Sample(), roles)
+		p := cell.Principal
+		key := rowKey{cell.Transport, p, out}
+		k, ok := index[key]
+		if !ok {
+			k = len(m.Rows)
+			index[key] = k
+			m.Rows = append(m.Rows, MatrixRow{
+				Transport:   cell.Transport,
+				Replication: p.Replication,
+				Databases:   p.Databases,
+				Users:       p.Users,
+				Outcome:     out,
+			})
+			prefixes = append(prefixes, nil)
+		}
+		if cell.Addr != nil {
+			prefixes[k] = append(prefixes[k], cell.Addr.Prefixes...)
+		}
+	}
+	for k := range m.Rows {
+		m.Rows[k].Addresses = (&AddrClass{Prefixes: mergePrefixes(prefixes[k])}).AddrStrings()
+	}
+	return m
+}
+
+var matrixHeader = []string{"transport", "replication", "databases", "users", "addresses", "line", "method", "options"}
+
+func (r MatrixRow) fields() []string {
+	addrs := strings.Join(r.Addresses, " ")
+	if r.Transport == TransportLocal {
+		addrs = "local"
+	}
+	return []string{
+		string(r.Transport),
+		strconv.FormatBool(r.Replication),
+		strings.Join(r.Databases, " "),
+		strings.Join(r.Users, " "),
+		addrs,
+		r.lineField(),
+		r.Method,
+		r.Options,
+	}
+}
+
+// lineField — номер строки; для правила из включённого файла — «файл:строка».
+func (r MatrixRow) lineField() string {
+	if r.File != "" {
+		return r.File + ":" + strconv.Itoa(r.Line)
+	}
+	return strconv.Itoa(r.Line)
+}
+
+// WriteCSV выгружает матрицу в CSV (заголовок + строка на класс).
+func (m Matrix) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(matrixHeader); err != nil {
+		return err
+	}
+	for _, r := range m.Rows {
+		if err := cw.Write(r.fields()); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteJSON выгружает матрицу в JSON.
+func (m Matrix) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(m)
+}
+
+// WriteMarkdown выгружает матрицу таблицей Markdown для отчётов аудиторам.
+func (m Matrix) WriteMarkdown(w io.Writer) error {
+	if _, err := fmt.Fprintf(w, "| %s |\n|%s\n", strings.Join(matrixHeader, " | "), strings.Repeat("---|", len(matrixHeader))); err != nil {
+		return err
+	}
+	for _, r := range m.Rows {
+		cells := r.fields()
+		for i, c := range cells {
+			cells[i] = strings.ReplaceAll(c, "|", `\|`)
+		}
+		if _, err := fmt.Fprintf(w, "| %s |\n", strings.Join(cells, " | ")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,337 @@
+package hba
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"sort"
+	"strings"
+)
+
+// MinimizeChange — одно преобразование минимизатора. Lines — исходные строки,
+// которых оно касается (для слияния — все склеенные правила).
+type MinimizeChange struct {
+	Kind    string `json:"kind"` // unreachable, redundant, mergedNetworks, mergedDatabases, mergedUsers
+	Lines   []int  `json:"lines"`
+	Message string `json:"message"`
+}
+
+// MinimizeResult — минимизированный набор правил и журнал преобразований.
+// origins[i] — исходные строки, из которых получилось Rules[i].
+type MinimizeResult struct {
+	Rules   []Rule
+	Changes []MinimizeChange
+	origins [][]int
+}
+
+// Minimize убирает недостижимые и избыточные правила и склеивает соседние
+// правила с одинаковым результатом (смежные CIDR, списки БД/пользователей).
+// Каждый шаг принимается, только если Compare не находит ни одного отличия,
+// так что результат эквивалентен исходному в семантике симулятора.
+// samenet симулятор считает «любым адресом»; чтобы не выкинуть правило,
+// которое на реальном сервере достижимо, шаг проверяется ещё и в
+// предположении, что samenet не совпадает ни с чем.
+func Minimize(rules []Rule, roles Roles) MinimizeResult {
+	m := MinimizeResult{Rules: append([]Rule(nil), rules...)}
+	for _, r := range rules {
+		m.origins = append(m.origins, []int{r.Line})
+	}
+	for changed := true; changed; {
+		changed = m.removeUnreachable(roles)
+		changed = m.removeRedundant(roles) || changed
+		changed = m.mergeAdjacent(roles) || changed
+	}
+	return m
+}
+
+// removeUnreachable выкидывает правила, которые не выбираются первыми ни для
+// одного класса подключений.
+func (m *MinimizeResult) removeUnreachable(roles Roles) bool {
+	reached := map[int]bool{}
+	for _, cell := range NewSpace(roles, m.Rules).Cells() {
+		reached[Evaluate(m.Rules, cell.Sample(), roles).Line] = true
+	}
+	changed := false
+	for i := len(m.Rules) - 1; i >= 0; i-- {
+		if reached[m.Rules[i].Line] {
+			continue
+		}
+		lines, ok := m.tryRemove(i, roles)
+		if !ok {
+			continue
+		}
+		m.Changes = append(m.Changes, MinimizeChange{
+			Kind:    "unreachable",
+			Lines:   lines,
+			Message: "rule is never the first match for any connection",
+		})
+		changed = true
+	}
+	return changed
+}
+
+// removeRedundant выкидывает правила, без которых подключения доходят до
+// правил ниже с тем же результатом. Идём снизу, чтобы из двух одинаковых
+// правил оставалось верхнее.
+func (m *MinimizeResult) removeRedundant(roles Roles) bool {
+	changed := false
+	for i := len(m.Rules) - 1; i >= 0; i-- {
+		lines, ok := m.tryRemove(i, roles)
+		if !ok {
+			continue
+		}
+		m.Changes = append(m.Changes, MinimizeChange{
+			Kind:    "redundant",
+			Lines:   lines,
+			Message: "connections fall through to later rules with the same outcome",
+		})
+		changed = true
+	}
+	return changed
+}
+
+// tryRemove удаляет правило i, если это не меняет результат ни для одного
+// подключения; возвращает исходные строки удалённого правила.
+func (m *MinimizeResult) tryRemove(i int, roles Roles) ([]int, bool) {
+	next := append(append([]Rule(nil), m.Rules[:i]...), m.Rules[i+1:]...)
+	if !minimizeEquivalent(m.Rules, next, roles) {
+		return nil, false
+	}
+	lines := m.origins[i]
+	m.Rules = next
+	m.origins = append(m.origins[:i], m.origins[i+1:]...)
+	return lines, true
+}
+
+// mergeAdjacent склеивает соседние правила с одинаковыми типом, методом и
+// опциями, если объединение выражается одной строкой.
+func (m *MinimizeResult) mergeAdjacent(roles Roles) bool {
+	changed := false
+	for i := 0; i+1 < len(m.Rules); {
+		merged, kind, ok := mergeRules(m.Rules[i], m.Rules[i+1])
+		if !ok {
+			i++
+			continue
+		}
+		next := append(append([]Rule(nil), m.Rules[:i]...), merged)
+		next = append(next, m.Rules[i+2:]...)
+		if !minimizeEquivalent(m.Rules, next, roles) {
+			i++
+			continue
+		}
+		lines := append(append([]int(nil), m.origins[i]...), m.origins[i+1]...)
+		m.Changes = append(m.Changes, MinimizeChange{
+			Kind:    kind,
+			Lines:   lines,
+			Message: fmt.Sprintf("merged into: %s", merged.Raw),
+		})
+		m.Rules = next
+		m.origins[i] = lines
+		m.origins = append(m.origins[:i+1], m.origins[i+2:]...)
+		changed = true
+	}
+	return changed
+}
+
+// mergeRules строит правило, совпадающее ровно с объединением a и b.
+func mergeRules(a, b Rule) (Rule, string, bool) {
+	if a.Type != b.Type || a.Method != b.Method || !optsEqual(a.Opts, b.Opts) {
+		return Rule{}, "", false
+	}
+	sameDBs := sameTokens(a.DBs, b.DBs)
+	sameUsers := sameTokens(a.Users, b.Users)
+	sameAddr := sameAddrSet(a.Addr, b.Addr)
+
+	merged := a
+	var kind string
+	switch {
+	case sameDBs && sameUsers && a.IsHost():
+		p, ok := mergeNetworks(a.Addr, b.Addr)
+		if !ok {
+			return Rule{}, "", false
+		}
+		merged.Addr = AddrSet{
+			Networks:  []*net.IPNet{{IP: p.Addr().AsSlice(), Mask: net.CIDRMask(p.Bits(), p.Addr().BitLen())}},
+			HasIPv4:   p.Addr().Is4(),
+			HasIPv6:   p.Addr().Is6(),
+			OrigToken: p.String(),
+		}
+		kind = "mergedNetworks"
+	case sameAddr && sameUsers:
+		merged.DBs = unionTokens(a.DBs, b.DBs)
+		kind = "mergedDatabases"
+	case sameAddr && sameDBs:
+		merged.Users = unionTokens(a.Users, b.Users)
+		kind = "mergedUsers"
+	default:
+		return Rule{}, "", false
+	}
+	merged.Raw = FormatRule(merged)
+	return merged, kind, true
+}
+
+// mergeNetworks — одна сеть, покрывающая ровно обе сети (смежные половины
+// или вложенные). samehost/samenet/all не склеиваем.
+func mergeNetworks(a, b AddrSet) (netip.Prefix, bool) {
+	if a.Any || b.Any || a.Special != "" || b.Special != "" || len(a.Networks) != 1 || len(b.Networks) != 1 {
+		return netip.Prefix{}, false
+	}
+	pa, okA := toPrefix(a.Networks[0])
+	pb, okB := toPrefix(b.Networks[0])
+	if !okA || !okB {
+		return netip.Prefix{}, false
+	}
+	merged := mergePrefixes([]netip.Prefix{pa, pb})
+	if len(merged) != 1 {
+		return netip.Prefix{}, false
+	}
+	return merged[0], true
+}
+
+// sameAddrSet — одинаковая адресная часть (с точностью до записи токена).
+func sameAddrSet(a, b AddrSet) bool {
+	if a.Any != b.Any || a.Special != b.Special || len(a.Networks) != len(b.Networks) {
+		return false
+	}
+	for i := range a.Networks {
+		pa, okA := toPrefix(a.Networks[i])
+		pb, okB := toPrefix(b.Networks[i])
+		if !okA || !okB || pa != pb {
+			return false
+		}
+	}
+	return true
+}
+
+func sameTokens(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	x := append([]string(nil), a...)
+	y := append([]string(nil), b...)
+	sort.Strings(x)
+	sort.Strings(y)
+	for i := range x {
+		if x[i] != y[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func unionTokens(a, b []string) []string {
+	out := append([]string(nil), a...)
+	for _, tok := range b {
+		if !containsToken(out, tok) {
+			out = append(out, tok)
+		}
+	}
+	return out
+}
+
+// minimizeEquivalent — эквивалентность в двух крайних трактовках samenet.
+// Явный reject не приравнивается к неявному: завершающее «reject всем»
+// ставят намеренно, минимизатор его не трогает.
+func minimizeEquivalent(a, b []Rule, roles Roles) bool {
+	return len(compare(a, b, roles, sameExplicit)) == 0 &&
+		len(compare(withoutSamenet(a), withoutSamenet(b), roles, sameExplicit)) == 0
+}
+
+func sameExplicit(a, b Outcome) bool {
+	return a.Same(b) && (a.Line == 0) == (b.Line == 0)
+}
+
+func withoutSamenet(rules []Rule) []Rule {
+	out := make([]Rule, 0, len(rules))
+	for _, r := range rules {
+		if r.Addr.Special != "samenet" {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// FormatRule печатает правило строкой pg_hba.conf (опции — по алфавиту).
+func FormatRule(r Rule) string {
+	fields := []string{r.Type, strings.Join(r.DBs, ","), strings.Join(r.Users, ",")}
+	if r.IsHost() {
+		fields = append(fields, r.Addr.OrigToken)
+	}
+	fields = append(fields, r.Method)
+	if opts := formatOptions(r.Opts); opts != "" {
+		fields = append(fields, opts)
+	}
+	return strings.Join(fields, " ")
+}
+
+// Render собирает текст минимизированного файла из исходного: выжившие
+// правила остаются как были (с комментариями над ними и в конце строки),
+// склеенные печатаются заново, а комментарии всех склеенных правил
+// сохраняются над новой строкой. Комментарии удалённых правил уходят вместе
+// с ними; шапка файла (всё до первого правила) и хвост после последнего
+// сохраняются.
+func (m MinimizeResult) Render(source string) string {
+	lines := strings.Split(strings.TrimSuffix(source, "\n"), "\n")
+	isRule := make([]bool, len(lines)+1)
+	for _, r := range m.allOrigins() {
+		if r >= 1 && r <= len(lines) {
+			isRule[r] = true
+		}
+	}
+	// preamble[L] — строки без правил непосредственно над правилом L
+	preamble := map[int][]string{}
+	var pending []string
+	var header []string
+	first := true
+	for i, l := range lines {
+		if !isRule[i+1] {
+			pending = append(pending, l)
+			continue
+		}
+		if first {
+			header, first = pending, false
+		} else {
+			preamble[i+1] = pending
+		}
+		pending = nil
+	}
+
+	var out []string
+	out = append(out, header...)
+	for k, r := range m.Rules {
+		origins := m.origins[k]
+		if len(origins) == 1 {
+			out = append(out, preamble[origins[0]]...)
+			out = append(out, lines[origins[0]-1])
+			continue
+		}
+		for _, o := range origins {
+			out = append(out, preamble[o]...)
+			if c := inlineComment(lines[o-1]); c != "" {
+				out = append(out, c)
+			}
+		}
+		out = append(out, r.Raw)
+	}
+	out = append(out, pending...)
+	return strings.Join(out, "\n") + "\n"
+}
+
+// allOrigins — строки всех исходных правил, включая удалённые.
+func (m MinimizeResult) allOrigins() []int {
+	var out []int
+	for _, o := range m.origins {
+		out = append(out, o...)
+	}
+	for _, c := range m.Changes {
+		out = append(out, c.Lines...)
+	}
+	return out
+}
+
+func inlineComment(raw string) string {
+	if i := strings.Index(raw, "#"); i >= 0 {
+		return raw[i:]
+	}
+	return ""
+}
@@ -0,0 +1,361 @@
+package hba
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// optionMethods — для каких методов допустима опция (как в parse_hba_auth_opt
+// PostgreSQL). nil — для любого метода (ограничения по типу правила
+// проверяются отдельно).
+var optionMethods = map[string][]string{
+	"map":                 {"ident", "peer", "gss", "sspi", "cert"},
+	"clientcert":          nil,
+	"clientname":          nil,
+	"include_realm":       {"gss", "sspi"},
+	"krb_realm":           {"gss", "sspi"},
+	"compat_realm":        {"sspi"},
+	"upn_username":        {"sspi"},
+	"pamservice":          {"pam"},
+	"pam_use_hostname":    {"pam"},
+	"ldapurl":             {"ldap"},
+	"ldapserver":          {"ldap"},
+	"ldapport":            {"ldap"},
+	"ldapscheme":          {"ldap"},
+	"ldaptls":             {"ldap"},
+	"ldapbinddn":          {"ldap"},
+	"ldapbindpasswd":      {"ldap"},
+	"ldapbasedn":          {"ldap"},
+	"ldapsearchattribute": {"ldap"},
+	"ldapsearchfilter":    {"ldap"},
+	"ldapprefix":          {"ldap"},
+	"ldapsuffix":          {"ldap"},
+	"radiusserver":        {"radius"},
+	"radiusservers":       {"radius"},
+	"radiussecret":        {"radius"},
+	"radiussecrets":       {"radius"},
+	"radiusport":          {"radius"},
+	"radiusports":         {"radius"},
+	"radiusidentifier":    {"radius"},
+	"radiusidentifiers":   {"radius"},
+}
+
+var (
+	infoUnknownOption = CheckInfo{
+		Code: "unknownOption", Severity: SeverityError,
+		Description: "Unrecognized authentication option.",
+		Rationale:   "PostgreSQL refuses to load pg_hba.conf with an unknown option, so a reload keeps the old rules.",
+		Remediation: "Fix the option name or remove it.",
+		DocsURL:     docsHBA,
+	}
+	infoOptionWrongMethod = CheckInfo{
+		Code: "optionWrongMethod", Severity: SeverityError,
+		Description: "Authentication option used with a method that does not support it.",
+		Rationale:   "PostgreSQL rejects the line (e.g. ldapserver with scram-sha-256), so the file fails to load.",
+		Remediation: "Remove the option or use the method it belongs to.",
+		DocsURL:     docsHBA,
+	}
+	infoOptionInvalidValue = CheckInfo{
+		Code: "optionInvalidValue", Severity: SeverityError,
+		Description: "Option value is malformed (port, boolean flag or ldapscheme).",
+		Rationale:   "A malformed value is either rejected at load time or silently treated as off.",
+		Remediation: "Use a port number 1-65535, 0/1 for flags, ldap or ldaps for ldapscheme.",
+		DocsURL:     docsHBA,
+	}
+	infoLDAPMissingServer = CheckInfo{
+		Code: "ldapMissingServer", Severity: SeverityError,
+		Description: "ldap rule without ldapserver or ldapurl.",
+		Rationale:   "PostgreSQL requires an LDAP server for the ldap method and rejects the line.",
+		Remediation: "Add ldapserver= or ldapurl=.",
+		DocsURL:     docsLDAP,
+	}
+	infoLDAPMissingMode = CheckInfo{
+		Code: "ldapMissingMode", Severity: SeverityError,
+		Description: "ldap rule with neither simple bind (ldapprefix/ldapsuffix) nor search+bind (ldapbasedn).",
+		Rationale:   "PostgreSQL cannot tell how to build the DN to bind as and rejects the line.",
+		Remediation: "Add ldapprefix/ldapsuffix for simple bind or ldapbasedn for search+bind.",
+		DocsURL:     docsLDAP,
+	}
+	infoLDAPMixedBind = CheckInfo{
+		Code: "ldapMixedBind", Severity: SeverityError,
+		Description: "ldapprefix/ldapsuffix mixed with search+bind options.",
+		Rationale:   "Simple bind and search+bind are mutually exclusive; PostgreSQL rejects the combination.",
+		Remediation: "Keep either ldapprefix/ldapsuffix or ldapbasedn/ldapbinddn/ldapbindpasswd/ldapsearchattribute/ldapsearchfilter/ldapurl.",
+		DocsURL:     docsLDAP,
+	}
+	infoLDAPSearchAttrFilter = CheckInfo{
+		Code: "ldapSearchAttrFilter", Severity: SeverityError,
+		Description: "ldapsearchattribute together with ldapsearchfilter.",
+		Rationale:   "Only one way to search for the user is allowed; PostgreSQL rejects the line.",
+		Remediation: "Use ldapsearchfilter alone (it can express the attribute).",
+		DocsURL:     docsLDAP,
+	}
+	infoLDAPInvalidURL = CheckInfo{
+		Code: "ldapInvalidURL", Severity: SeverityError,
+		Description: "ldapurl is not a valid ldap:// or ldaps:// URL.",
+		Rationale:   "An unparsable URL makes the line fail to load.",
+		Remediation: "Use ldap[s]://host[:port]/basedn[?attribute[?scope[?filter]]].",
+		DocsURL:     docsLDAP,
+	}
+	infoRADIUSMissingOption = CheckInfo{
+		Code: "radiusMissingOption", Severity: SeverityError,
+		Description: "radius rule without radiusservers or radiussecrets.",
+		Rationale:   "PostgreSQL requires both for the radius method and rejects the line.",
+		Remediation: "Add radiusservers= and radiussecrets=.",
+		DocsURL:     docsRADIUS,
+	}
+	infoRADIUSListMismatch = CheckInfo{
+		Code: "radiusListMismatch", Severity: SeverityError,
+		Description: "radiussecrets/radiusports/radiusidentifiers list length does not match radiusservers.",
+		Rationale:   "Each list must have one element or one per server; PostgreSQL rejects other lengths.",
+		Remediation: "Give one value for all servers or exactly one per server.",
+		DocsURL:     docsRADIUS,
+	}
+	infoClientnameInvalid = CheckInfo{
+		Code: "clientnameInvalid", Severity: SeverityError,
+		Description: "clientname is not CN or DN, or used outside hostssl.",
+		Rationale:   "PostgreSQL accepts only CN or DN and only for hostssl rows; otherwise the file fails to load.",
+		Remediation: "Use clientname=CN (default) or clientname=DN on a hostssl rule.",
+		DocsURL:     docsCert,
+	}
+	infoClientcertCertMethod = CheckInfo{
+		Code: "clientcertCertMethod", Severity: SeverityError,
+		Description: "cert method with clientcert other than verify-full.",
+		Rationale:   "The cert method always verifies the full certificate; PostgreSQL rejects a weaker clientcert.",
+		Remediation: "Drop clientcert or set clientcert=verify-full.",
+		DocsURL:     docsCert,
+	}
+	infoPAMOptionInvalid = CheckInfo{
+		Code: "pamOptionInvalid", Severity: SeverityError,
+		Description: "pamservice is empty or not a plain PAM service name.",
+		Rationale:   "The service name is a file under /etc/pam.d; paths or empty names make every login fail.",
+		Remediation: "Use the name of a PAM service, e.g. pamservice=postgresql.",
+		DocsURL:     docsPAM,
+	}
+)
+
+// optValue — значение опции без кавычек.
+func optValue(v string) string {
+	if len(v) >= 2 && v[0] == '"' && v[len(v)-1] == '"' {
+		return v[1 : len(v)-1]
+	}
+	return v
+}
+
+// optList — значение-список через запятую (radiusservers и т. п.).
+func optList(v string) []string {
+	var out []string
+	for _, p := range strings.Split(optValue(v), ",") {
+		out = append(out, strings.TrimSpace(optValue(strings.TrimSpace(p))))
+	}
+	return out
+}
+
+// sortedKeys — ключи опций по алфавиту, чтобы находки шли стабильно.
+func sortedKeys(opts map[string]string) []string {
+	keys := make([]string, 0, len(opts))
+	for k := range opts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func validPort(v string) bool {
+	n, err := strconv.Atoi(v)
+	return err == nil && n >= 1 && n <= 65535
+}
+
+// имена опций: неизвестные, не для этого метода, значения портов и флагов.
+func checkOptionNames(ctx *Context, r Rule) []Issue {
+	var issues []Issue
+	for _, k := range sortedKeys(r.Opts) {
+		methods, known := optionMethods[k]
+		if !known {
+			issues = append(issues, infoUnknownOption.NewIssue(r.Line,
+				fmt.Sprintf("Unknown authentication option %s.", k)))
+			continue
+		}
+		if methods != nil && !containsToken(methods, r.Method) {
+			issues = append(issues, infoOptionWrongMethod.NewIssue(r.Line,
+				fmt.Sprintf("Option %s is valid only for %s, not %s.", k, strings.Join(methods, "/"), r.Method)))
+			continue
+		}
+		v := optValue(r.Opts[k])
+		bad := false
+		switch k {
+		case "ldapport":
+			bad = !validPort(v)
+		case "radiusport", "radiusports":
+			for _, p := range optList(r.Opts[k]) {
+				bad = bad || !validPort(p)
+			}
+		case "ldaptls", "include_realm", "compat_realm", "upn_username", "pam_use_hostname":
+			bad = v != "0" && v != "1"
+		case "ldapscheme":
+			bad = v != "ldap" && v != "ldaps"
+		}
+		if bad {
+			issues = append(issues, infoOptionInvalidValue.NewIssue(r.Line,
+				fmt.Sprintf("Invalid value for %s: %s.", k, r.Opts[k])))
+		}
+	}
+	return issues
+}
+
+// ldap: сервер, режим (simple bind или search+bind), их несовместимость, ldapurl.
+func checkLDAPOptions(ctx *Context, r Rule) []Issue {
+	if r.Method != "ldap" {
+		return nil
+	}
+	has := func(k string) bool { _, ok := r.Opts[k]; return ok }
+	var issues []Issue
+	basedn := has("ldapbasedn")
+	if raw, ok := r.Opts["ldapurl"]; ok {
+		u, err := parseLDAPURL(optValue(raw))
+		if err != nil {
+			issues = append(issues, infoLDAPInvalidURL.NewIssue(r.Line,
+				fmt.Sprintf("Invalid ldapurl %s: %v.", raw, err)))
+		} else {
+			basedn = basedn || u.basedn
+		}
+	}
+	if !has("ldapserver") && !has("ldapurl") {
+		issues = append(issues, infoLDAPMissingServer.NewIssue(r.Line,
+			"LDAP server not specified: add ldapserver or ldapurl."))
+	}
+	simple := has("ldapprefix") || has("ldapsuffix")
+	if simple {
+		var search []string
+		for _, k := range []string{"ldapbasedn", "ldapbinddn", "ldapbindpasswd", "ldapsearchattribute", "ldapsearchfilter", "ldapurl"} {
+			if has(k) {
+				search = append(search, k)
+			}
+		}
+		if len(search) > 0 {
+			issues = append(issues, infoLDAPMixedBind.NewIssue(r.Line,
+				fmt.Sprintf("ldapprefix/ldapsuffix (simple bind) cannot be combined with %s (search+bind).", strings.Join(search, ", "))))
+		}
+	} else if !basedn {
+		issues = append(issues, infoLDAPMissingMode.NewIssue(r.Line,
+			"LDAP needs ldapbasedn (search+bind) or ldapprefix/ldapsuffix (simple bind)."))
+	}
+	if has("ldapsearchattribute") && has("ldapsearchfilter") {
+		issues = append(issues, infoLDAPSearchAttrFilter.NewIssue(r.Line,
+			"ldapsearchattribute and ldapsearchfilter cannot be used together."))
+	}
+	return issues
+}
+
+type ldapURL struct {
+	basedn bool
+}
+
+// parseLDAPURL разбирает ldap[s]://host[:port]/basedn[?attribute[?scope[?filter]]].
+func parseLDAPURL(s string) (ldapURL, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return ldapURL{}, err
+	}
+	if u.Scheme != "ldap" && u.Scheme != "ldaps" {
+		return ldapURL{}, fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return ldapURL{}, fmt.Errorf("missing host")
+	}
+	if p := u.Port(); p != "" && !validPort(p) {
+		return ldapURL{}, fmt.Errorf("invalid port %q", p)
+	}
+	parts := strings.Split(u.RawQuery, "?")
+	if len(parts) > 3 {
+		return ldapURL{}, fmt.Errorf("extensions are not supported")
+	}
+	if len(parts) > 1 {
+		switch parts[1] {
+		case "", "base", "one", "sub":
+		default:
+			return ldapURL{}, fmt.Errorf("invalid scope %q", parts[1])
+		}
+	}
+	return ldapURL{basedn: strings.TrimPrefix(u.Path, "/") != ""}, nil
+}
+
+// radius: обязательные серверы и секреты, согласованные длины списков.
+func checkRADIUSOptions(ctx *Context, r Rule) []Issue {
+	if r.Method != "radius" {
+		return nil
+	}
+	list := func(keys ...string) ([]string, bool) {
+		for _, k := range keys {
+			if v, ok := r.Opts[k]; ok {
+				return optList(v), true
+			}
+		}
+		return nil, false
+	}
+	servers, hasServers := list("radiusservers", "radiusserver")
+	secrets, hasSecrets := list("radiussecrets", "radiussecret")
+	var missing []string
+	if !hasServers {
+		missing = append(missing, "radiusservers")
+	}
+	if !hasSecrets {
+		missing = append(missing, "radiussecrets")
+	}
+	if len(missing) > 0 {
+		return []Issue{infoRADIUSMissingOption.NewIssue(r.Line,
+			fmt.Sprintf("RADIUS requires %s.", strings.Join(missing, " and ")))}
+	}
+	var issues []Issue
+	check := func(name string, vals []string) {
+		if len(vals) > 1 && len(vals) != len(servers) {
+			issues = append(issues, infoRADIUSListMismatch.NewIssue(r.Line,
+				fmt.Sprintf("The number of %s (%d) must be 1 or the same as the number of radiusservers (%d).", name, len(vals), len(servers))))
+		}
+	}
+	check("radiussecrets", secrets)
+	if ports, ok := list("radiusports", "radiusport"); ok {
+		check("radiusports", ports)
+	}
+	if ids, ok := list("radiusidentifiers", "radiusidentifier"); ok {
+		check("radiusidentifiers", ids)
+	}
+	return issues
+}
+
+// cert: clientname=CN|DN только в hostssl, у метода cert — только verify-full.
+func checkCertOptions(ctx *Context, r Rule) []Issue {
+	var issues []Issue
+	if v, ok := r.Opts["clientname"]; ok {
+		switch {
+		case r.Type != "hostssl":
+			issues = append(issues, infoClientnameInvalid.NewIssue(r.Line, "clientname is allowed only for hostssl."))
+		case optValue(v) != "CN" && optValue(v) != "DN":
+			issues = append(issues, infoClientnameInvalid.NewIssue(r.Line,
+				fmt.Sprintf("clientname must be CN or DN, got %s.", v)))
+		}
+	}
+	if v, ok := r.Opts["clientcert"]; ok && r.Method == "cert" && r.Type == "hostssl" &&
+		strings.ToLower(optValue(v)) != "verify-full" {
+		issues = append(issues, infoClientcertCertMethod.NewIssue(r.Line,
+			"clientcert only accepts verify-full with cert authentication."))
+	}
+	return issues
+}
+
+// pam: pamservice — имя службы в /etc/pam.d, не путь.
+func checkPAMOptions(ctx *Context, r Rule) []Issue {
+	v, ok := r.Opts["pamservice"]
+	if !ok || r.Method != "pam" {
+		return nil
+	}
+	name := optValue(v)
+	if name == "" || strings.ContainsAny(name, "/ \t") {
+		return []Issue{infoPAMOptionInvalid.NewIssue(r.Line,
+			fmt.Sprintf("pamservice must be a PAM service name, got %s.", v))}
+	}
+	return nil
+}
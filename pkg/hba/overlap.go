@@ -1,63 +1,336 @@
 package hba
 
-import "fmt"
+import (
+	"fmt"
+	"net"
+	"strings"
+)
 
 // CheckOverlaps проверяет перекрытия правил в порядке файла и помечает затенённые.
-// Упрощения: не анализируем спец-значения sameuser/samerole, но ловим частые кейсы:
-// ранний reject, host перекрывает hostssl, более широкое менее строгое правило, дубликаты.
+// Каталог ролей не используется: samerole/+group сводятся к членству роли в самой себе.
 func CheckOverlaps(rules []Rule) []Issue {
-	var issues []Issue
-	for j := 0; j < len(rules); j++ {
-		rj := rules[j]
-		for i := 0; i < j; i++ {
+	return CheckOverlapsWith(rules, Config{})
+}
+
+// CheckOverlapsWith — то же, что CheckOverlaps, но с контекстом инстанса (каталог ролей).
+// Ловим частые кейсы: ранний reject, host перекрывает hostssl, более широкое менее
+// строгое правило, дубликаты. БД и пользователи сравниваются по семантике
+// (sameuser/samerole/+group), а не как строки.
+//
+// Верхние правила для сравнения подбираются через overlapIndex, поэтому на
+// больших сгенерированных файлах анализ близок к линейному; порядок и состав
+// находок такие же, как у полного попарного перебора.
+func CheckOverlapsWith(rules []Rule, cfg Config) []Issue {
+	cfg.Strength = cfg.strength()
+	var issues, replIssues []Issue
+	idx := newOverlapIndex()
+	for j, rj := range rules {
+		replReported := !rj.HasDB("replication")
+		var partial []int
+		for _, i := range idx.candidates(rj) {
 			ri := rules[i]
-			if !compatibleType(ri.Type, rj.Type) {
+			if !typesIntersect(ri.Type, rj.Type) {
 				continue
 			}
-			if ri.Type == "local" && rj.Type == "local" {
-				// ok
+			pairIssues, isPartial := overlapPair(ri, rj, cfg)
+			if len(pairIssues) > 0 {
+				ex := counterexample(rules[:i], ri, rj, cfg.Roles)
+				for _, is := range pairIssues {
+					issues = append(issues, is.withExample(ex))
+				}
 			}
-			if !ri.Addr.Covers(rj.Addr) && !ri.Addr.Intersects(rj.Addr) {
-				continue
+			if isPartial && outcomeDiffers(ri, rj) {
+				partial = append(partial, i)
 			}
-			if !dbCovers(ri.DBs, rj.DBs) && !dbIntersects(ri.DBs, rj.DBs) {
-				continue
+			if !replReported {
+				if is, ok := replicationNotCoveredByAll(ri, rj, cfg); ok {
+					ex := counterexample(rules[:j], rj, rj, cfg.Roles)
+					replIssues = append(replIssues, is.withExample(ex))
+					replReported = true
+				}
 			}
-			if !userCovers(ri.Users, rj.Users) && !userIntersects(ri.Users, rj.Users) {
-				continue
+		}
+		if len(partial) > 0 {
+			uppers := make([]Rule, len(partial))
+			for k, i := range partial {
+				uppers[k] = rules[i]
+			}
+			is := partialOverlapIssue(uppers, rj, cfg)
+			// правила выше — по индексу: после include номера строк повторяются
+			for _, i := range partial {
+				if ex := counterexample(rules[:i], rules[i], rj, cfg.Roles); ex != nil {
+					is = is.withExample(ex)
+					break
+				}
 			}
+			issues = append(issues, is)
+		}
+		idx.add(j, rj)
+	}
+	return append(issues, replIssues...)
+}
 
-			covers := ri.Addr.Covers(rj.Addr) && dbCovers(ri.DBs, rj.DBs) && userCovers(ri.Users, rj.Users) && optsNotStricter(ri.Opts, rj.Opts)
-			intersects := ri.Addr.Intersects(rj.Addr) && dbIntersects(ri.DBs, rj.DBs) && userIntersects(ri.Users, rj.Users)
+// overlapCheck — анализ перекрытий как проверка реестра. Все коды считаются
+// одним проходом (Context.Overlaps), выключенные отфильтровывает Registry.
+type overlapCheck struct{}
 
-			if covers {
-				issues = append(issues, overlapIssues(ri, rj)...)
-				continue
+func (overlapCheck) Run(ctx *Context) []Issue { return ctx.Overlaps() }
+
+func (overlapCheck) Codes() []CheckInfo {
+	return []CheckInfo{
+		{
+			Code: "shadowedByReject", Severity: SeverityError,
+			Description: "Rule is fully covered by an earlier reject.",
+			Rationale:   "The rule never applies; the intended access silently does not exist.",
+			Remediation: "Move the rule above the reject or narrow the reject.",
+			DocsURL:     docsHBA,
+		},
+		{
+			Code: "shadowedByHost", Severity: SeverityWarn,
+			Description: "hostssl/hostnossl rule is covered by an earlier host rule.",
+			Rationale:   "host matches both TLS and non-TLS connections, so the typed rule is never reached.",
+			Remediation: "Put the hostssl/hostnossl rule first or narrow the host rule.",
+			DocsURL:     docsHBA,
+		},
+		{
+			Code: "overlyBroadRule", Severity: SeverityWarn,
+			Description: "Broader, weaker rule shadows a stricter rule below.",
+			Rationale:   "Connections meant for the stricter rule authenticate with the weaker method.",
+			Remediation: "Move the stricter rule up (see `hba-check reorder`) or narrow the broad rule.",
+			DocsURL:     docsHBA,
+		},
+		{
+			Code: "shadowedByBroadRule", Severity: SeverityWarn,
+			Description: "Stricter rule is shadowed by a broader, weaker rule above.",
+			Rationale:   "The stricter method is never used.",
+			Remediation: "Move this rule above the broad rule (see `hba-check reorder`).",
+			DocsURL:     docsHBA,
+		},
+		{
+			Code: "redundantRule", Severity: SeverityInfo,
+			Description: "Rule is fully covered by an earlier rule with the same method and options.",
+			Rationale:   "Dead lines make the file harder to review.",
+			Remediation: "Remove the rule (see `hba-check minimize`).",
+			DocsURL:     docsHBA,
+		},
+		{
+			Code: "shadowedRule", Severity: SeverityWarn,
+			Description: "Rule is fully covered by an earlier rule with a different outcome.",
+			Rationale:   "The rule never applies; its method is dead configuration.",
+			Remediation: "Remove the rule or reorder it above the covering rule.",
+			DocsURL:     docsHBA,
+		},
+		{
+			Code: "partialOverlap", Severity: SeverityWarn,
+			Description: "Rule partially overlaps earlier rules that choose a different outcome.",
+			Rationale:   "Part of the rule's connections get another method; the effective policy differs from what the line says.",
+			Remediation: "Split or reorder the rules so the intersection is handled explicitly.",
+			DocsURL:     docsHBA,
+		},
+		{
+			Code: "replicationNotCoveredByAll", Severity: SeverityWarn,
+			Description: "Replication rule sits below a database=all rule that does not match replication.",
+			Rationale:   "database=all never matches physical replication, so the rule still applies contrary to appearances.",
+			Remediation: "Add an explicit replication rule where the intent is to block or handle replication.",
+			DocsURL:     docsRepl,
+		},
+	}
+}
+
+// overlapPair сравнивает верхнее правило ri с нижним rj. Полное покрытие сразу
+// превращается в находки; частичное пересечение возвращается флагом, чтобы
+// вызывающий собрал все такие пары по нижнему правилу в одну находку.
+func overlapPair(ri, rj Rule, cfg Config) ([]Issue, bool) {
+	if !ri.Addr.Covers(rj.Addr) && !ri.Addr.Intersects(rj.Addr) {
+		return nil, false
+	}
+	if !principalsIntersect(ri, rj, cfg.Roles) {
+		return nil, false
+	}
+
+	covers := typeCovers(ri.Type, rj.Type) && ri.Addr.Covers(rj.Addr) && principalsCover(ri, rj, cfg.Roles) && cfg.Strength.optsNotStricter(ri.Opts, rj.Opts)
+	if covers {
+		return overlapIssues(ri, rj, cfg.Strength), false
+	}
+	return nil, ri.Addr.Intersects(rj.Addr)
+}
+
+// outcomeDiffers — пересечение важно, только если в общей области правила дают
+// разный результат: другой метод (в т.ч. reject против accept) или другие опции.
+// Если результат одинаков, порядок правил ни на что не влияет.
+func outcomeDiffers(a, b Rule) bool {
+	return a.Method != b.Method || !optsEqual(a.Opts, b.Opts)
+}
+
+// partialOverlapIssue собирает все верхние правила, частично пересекающиеся с
+// lower и дающие другой результат, в одну находку с точной областью пересечения.
+func partialOverlapIssue(uppers []Rule, lower Rule, cfg Config) Issue {
+	parts := make([]string, 0, len(uppers))
+	related := make([]int, 0, len(uppers))
+	var files []string
+	for _, u := range uppers {
+		related = append(related, u.Line)
+		files = append(files, u.File)
+		parts = append(parts, fmt.Sprintf("%s [db=%s user=%s addr=%s method=%s]",
+			u.ref(),
+			strings.Join(tokenIntersection(u.DBs, lower.DBs, cfg.Roles, false), ","),
+			strings.Join(tokenIntersection(u.Users, lower.Users, cfg.Roles, true), ","),
+			strings.Join(addrIntersection(u, lower), ","),
+			methodWithOpts(u)))
+	}
+	noun := "line"
+	if len(uppers) > 1 {
+		noun = "lines"
+	}
+	is := Issue{
+		Severity: SeverityWarn,
+		Code:     "partialOverlap",
+		File:     lower.File,
+		Line:     lower.Line,
+		Related:  related,
+		Message: fmt.Sprintf("Rule partially overlaps with earlier %s choosing a different outcome than %s: %s.",
+			noun, methodWithOpts(lower), strings.Join(parts, "; ")),
+	}
+	for _, f := range files {
+		if f != "" {
+			is.RelatedFiles = files
+			break
+		}
+	}
+	return is
+}
+
+func methodWithOpts(r Rule) string {
+	if opts := formatOptions(r.Opts); opts != "" {
+		return r.Method + " " + opts
+	}
+	return r.Method
+}
+
+// tokenIntersection описывает общие БД (или пользователей) двух списков:
+// all уступает конкретному списку другой стороны, литералы пересекаются
+// напрямую, а sameuser/samerole/+group пропускают литералы, которые могут
+// под них подойти.
+func tokenIntersection(a, b []string, roles Roles, users bool) []string {
+	if containsToken(a, "all") && !containsToken(b, "replication") {
+		return b
+	}
+	if containsToken(b, "all") && !containsToken(a, "replication") {
+		return a
+	}
+	var out []string
+	add := func(tok string) {
+		if !containsToken(out, tok) {
+			out = append(out, tok)
+		}
+	}
+	for _, x := range a {
+		for _, y := range b {
+			switch {
+			case x == y:
+				add(x)
+			case tokenAdmits(x, y, roles, users):
+				add(y)
+			case tokenAdmits(y, x, roles, users):
+				add(x)
 			}
-			if intersects {
-				issues = append(issues, Issue{
-					Severity: SeverityWarn,
-					Code:     "partialOverlap",
-					Line:     rj.Line,
-					Message:  fmt.Sprintf("Rule partially overlaps with line %d.", ri.Line),
-				})
+		}
+	}
+	return out
+}
+
+// tokenAdmits: может ли специальный токен wild совпасть с литералом lit.
+func tokenAdmits(wild, lit string, roles Roles, users bool) bool {
+	if lit == "replication" || strings.HasPrefix(lit, "+") || lit == "all" {
+		return false
+	}
+	if users {
+		return strings.HasPrefix(wild, "+") && roles.IsMember(lit, wild[1:])
+	}
+	switch wild {
+	case "sameuser", "samerole", "samegroup":
+		return lit != "sameuser" && lit != "samerole" && lit != "samegroup"
+	}
+	return false
+}
+
+// addrIntersection — общие сети двух правил (более узкая из каждой пересекающейся пары).
+func addrIntersection(a, b Rule) []string {
+	if !a.IsHost() {
+		return []string{"local"}
+	}
+	if a.Addr.Any && b.Addr.Any {
+		return []string{"all"}
+	}
+	if a.Addr.Any {
+		return networkStrings(b.Addr.Networks)
+	}
+	if b.Addr.Any {
+		return networkStrings(a.Addr.Networks)
+	}
+	var out []string
+	for _, an := range a.Addr.Networks {
+		for _, bn := range b.Addr.Networks {
+			if !sameFamily(an, bn) || !cidrOverlaps(an, bn) {
 				continue
 			}
+			if cidrContains(an, bn) {
+				out = append(out, networkStrings([]*net.IPNet{bn})...)
+			} else {
+				out = append(out, networkStrings([]*net.IPNet{an})...)
+			}
 		}
 	}
-	return issues
+	return out
+}
+
+func networkStrings(nets []*net.IPNet) []string {
+	out := make([]string, 0, len(nets))
+	for _, n := range nets {
+		if p, ok := toPrefix(n); ok {
+			out = append(out, p.String())
+		}
+	}
+	return out
+}
+
+// replicationNotCoveredByAll ловит replication-правило под правилом с database=all,
+// которое покрыло бы его по типу, адресу и пользователям. all не совпадает с
+// физической репликацией, поэтому такое replication-правило всё равно достижимо —
+// чаще всего автор ожидал обратного (например, «reject всё» выше).
+func replicationNotCoveredByAll(ri, rj Rule, cfg Config) (Issue, bool) {
+	if !ri.HasDB("all") || ri.HasDB("replication") || !ri.Addr.Covers(rj.Addr) {
+		return Issue{}, false
+	}
+	asRepl := ri
+	asRepl.DBs = []string{"replication"}
+	if !principalsCover(asRepl, rj, cfg.Roles) {
+		return Issue{}, false
+	}
+	verb := "handle"
+	if ri.Method == "reject" {
+		verb = "block"
+	}
+	return Issue{
+		Severity: SeverityWarn,
+		Code:     "replicationNotCoveredByAll",
+		File:     rj.File,
+		Line:     rj.Line,
+		Message:  fmt.Sprintf("database=all at %s does not %s replication connections; this rule still applies.", ri.ref(), verb),
+	}, true
 }
 
 // overlapIssues формирует список предупреждений/ошибок для пары (верхнее, нижнее) правил,
-// когда верхнее полностью покрывает нижнее.
-func overlapIssues(upper Rule, lower Rule) []Issue {
+// когда верхнее полностью покрывает нижнее. «Слабее» — по шкале st.
+func overlapIssues(upper Rule, lower Rule, st Strength) []Issue {
 	var issues []Issue
 	if upper.Method == "reject" && lower.Method != "reject" {
 		issues = append(issues, Issue{
 			Severity: SeverityError,
 			Code:     "shadowedByReject",
+			File:     lower.File,
 			Line:     lower.Line,
-			Message:  fmt.Sprintf("Rule is shadowed by reject at line %d.", upper.Line),
+			Message:  fmt.Sprintf("Rule is shadowed by reject at %s.", upper.ref()),
 		})
 		return issues
 	}
@@ -66,23 +339,26 @@ func overlapIssues(upper Rule, lower Rule) []Issue {
 		issues = append(issues, Issue{
 			Severity: SeverityWarn,
 			Code:     "shadowedByHost",
+			File:     lower.File,
 			Line:     lower.Line,
-			Message:  fmt.Sprintf("host rule at line %d shadows this rule.", upper.Line),
+			Message:  fmt.Sprintf("host rule at %s shadows this rule.", upper.ref()),
 		})
 	}
 
-	if isWeaker(upper.Method, lower.Method) {
+	if st.Weaker(upper, lower) {
 		issues = append(issues, Issue{
 			Severity: SeverityWarn,
 			Code:     "overlyBroadRule",
+			File:     upper.File,
 			Line:     upper.Line,
-			Message:  fmt.Sprintf("Broad rule shadows stricter rule at line %d.", lower.Line),
+			Message:  fmt.Sprintf("Broad rule shadows stricter rule at %s.", lower.ref()),
 		})
 		issues = append(issues, Issue{
 			Severity: SeverityWarn,
 			Code:     "shadowedByBroadRule",
+			File:     lower.File,
 			Line:     lower.Line,
-			Message:  fmt.Sprintf("Rule is shadowed by broader rule at line %d.", upper.Line),
+			Message:  fmt.Sprintf("Rule is shadowed by broader rule at %s.", upper.ref()),
 		})
 		return issues
 	}
@@ -91,8 +367,9 @@ func overlapIssues(upper Rule, lower Rule) []Issue {
 		issues = append(issues, Issue{
 			Severity: SeverityInfo,
 			Code:     "redundantRule",
+			File:     lower.File,
 			Line:     lower.Line,
-			Message:  fmt.Sprintf("Rule is redundant due to line %d.", upper.Line),
+			Message:  fmt.Sprintf("Rule is redundant due to %s.", upper.ref()),
 		})
 		return issues
 	}
@@ -100,92 +377,13 @@ func overlapIssues(upper Rule, lower Rule) []Issue {
 	issues = append(issues, Issue{
 		Severity: SeverityWarn,
 		Code:     "shadowedRule",
+		File:     lower.File,
 		Line:     lower.Line,
-		Message:  fmt.Sprintf("Rule is fully shadowed by line %d.", upper.Line),
+		Message:  fmt.Sprintf("Rule is fully shadowed by %s.", upper.ref()),
 	})
 	return issues
 }
 
-func compatibleType(a, b string) bool {
-	if a == b {
-		return true
-	}
-	// host считается супером для hostssl/hostnossl/...
-	if a == "host" && (b == "host" || b == "hostssl" || b == "hostnossl" || b == "hostgssenc" || b == "hostnogssenc") {
-		return true
-	}
-	if b == "host" && (a == "host" || a == "hostssl" || a == "hostnossl" || a == "hostgssenc" || a == "hostnogssenc") {
-		return true
-	}
-	return false
-}
-
-func dbCovers(a, b []string) bool {
-	if containsToken(a, "all") {
-		return true
-	}
-	if containsToken(b, "all") {
-		return false
-	}
-	for _, v := range b {
-		if !containsToken(a, v) {
-			return false
-		}
-	}
-	return true
-}
-
-func dbIntersects(a, b []string) bool {
-	if containsToken(a, "all") || containsToken(b, "all") {
-		return true
-	}
-	for _, v := range a {
-		if containsToken(b, v) {
-			return true
-		}
-	}
-	return false
-}
-
-func userCovers(a, b []string) bool {
-	if containsToken(a, "all") {
-		return true
-	}
-	if containsToken(b, "all") {
-		return false
-	}
-	for _, v := range b {
-		if !containsToken(a, v) {
-			return false
-		}
-	}
-	return true
-}
-
-func userIntersects(a, b []string) bool {
-	if containsToken(a, "all") || containsToken(b, "all") {
-		return true
-	}
-	for _, v := range a {
-		if containsToken(b, v) {
-			return true
-		}
-	}
-	return false
-}
-
-func optsNotStricter(a, b map[string]string) bool {
-	// Проверяем, что набор опций верхнего правила не строже нижнего.
-	// Если верхнее требует что-то (clientcert=verify-full), а нижнее — нет,
-	// то верхнее не считается перекрывающим (возвращаем false).
-	for k, v := range a {
-		if bv, ok := b[k]; !ok || bv != v {
-			return false
-		}
-	}
-	return true
-}
-
 func optsEqual(a, b map[string]string) bool {
 	if len(a) != len(b) {
 		return false
@@ -197,28 +395,3 @@ func optsEqual(a, b map[string]string) bool {
 	}
 	return true
 }
-
-func isWeaker(upper, lower string) bool {
-	// Очень грубая шкала «слабых»/«сильных» методов для подсветки перекрытия.
-	// Если нужно точнее, расширяем списки или вводим веса.
-	weak := map[string]bool{
-		"trust":    true,
-		"md5":      true,
-		"password": true,
-	}
-	strong := map[string]bool{
-		"scram-sha-256": true,
-		"cert":          true,
-		"gss":           true,
-		"sspi":          true,
-		"ldap":          true,
-		"pam":           true,
-		"radius":        true,
-		"peer":          true,
-		"ident":         true,
-	}
-	if weak[upper] && strong[lower] {
-		return true
-	}
-	return false
-}
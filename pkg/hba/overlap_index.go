@@ -0,0 +1,276 @@
+package hba
+
+import (
+	"net/netip"
+	"sort"
+	"strings"
+)
+
+// overlapIndex — индексы по уже просмотренным правилам (строки выше текущей),
+// чтобы для очередного правила перебирать не все верхние правила, а только
+// кандидатов на пересечение. Каждое измерение (тип, адрес, БД, пользователь)
+// даёт свой список кандидатов; берём самый короткий, а точную проверку делает
+// CheckOverlapsWith. Индексы консервативны: кандидат может не пересекаться,
+// но пересекающееся правило никогда не теряется.
+type overlapIndex struct {
+	byType  map[string][]int // точный тип правила
+	anyAddr []int            // правила без конкретной сети: all, samenet, local
+	v4, v6  *prefixNode      // префиксные деревья сетей по семействам
+	dbTok   map[string][]int // литеральные БД (и replication)
+	dbWild  []int            // all/sameuser/samerole/samegroup и /regex — совпадают с чем угодно
+	usrTok  map[string][]int // литеральные пользователи
+	usrWild []int            // all, +group и /regex
+	total   int
+
+	seen  []int // отметки для дедупликации кандидатов
+	stamp int
+}
+
+// prefixNode — узел бинарного префиксного дерева. rules — правила, чья сеть
+// заканчивается ровно в этом узле; count — сколько сетей во всём поддереве.
+type prefixNode struct {
+	child [2]*prefixNode
+	rules []int
+	count int
+}
+
+func newOverlapIndex() *overlapIndex {
+	return &overlapIndex{
+		byType: map[string][]int{},
+		v4:     &prefixNode{},
+		v6:     &prefixNode{},
+		dbTok:  map[string][]int{},
+		usrTok: map[string][]int{},
+	}
+}
+
+// add добавляет правило с индексом i (правила добавляются по порядку файла).
+func (x *overlapIndex) add(i int, r Rule) {
+	x.total++
+	x.seen = append(x.seen, 0)
+	x.byType[r.Type] = append(x.byType[r.Type], i)
+
+	if p, ok := rulePrefixes(r); ok {
+		for _, pfx := range p {
+			x.tree(pfx).insert(pfx, i)
+		}
+	} else {
+		x.anyAddr = append(x.anyAddr, i)
+	}
+
+	if dbWildcard(r.DBs) {
+		x.dbWild = append(x.dbWild, i)
+	} else {
+		for _, tok := range r.DBs {
+			x.dbTok[tok] = append(x.dbTok[tok], i)
+		}
+	}
+	if userWildcard(r.Users) {
+		x.usrWild = append(x.usrWild, i)
+	} else {
+		for _, tok := range r.Users {
+			x.usrTok[tok] = append(x.usrTok[tok], i)
+		}
+	}
+}
+
+// candidates возвращает отсортированные индексы верхних правил, которые могут
+// пересекаться с r. Выбирается самое избирательное измерение.
+func (x *overlapIndex) candidates(r Rule) []int {
+	best := x.total
+	var pick func() []int
+
+	consider := func(n int, f func() []int) {
+		if n < best {
+			best = n
+			pick = f
+		}
+	}
+
+	// типы, у которых есть общий с r транспорт
+	var types []string
+	typeN := 0
+	for typ, list := range x.byType {
+		if typesIntersect(typ, r.Type) {
+			types = append(types, typ)
+			typeN += len(list)
+		}
+	}
+	consider(typeN, func() []int {
+		var out []int
+		for _, typ := range types {
+			out = append(out, x.byType[typ]...)
+		}
+		return out
+	})
+
+	if prefixes, ok := rulePrefixes(r); ok {
+		n := len(x.anyAddr)
+		for _, p := range prefixes {
+			n += x.tree(p).estimate(p)
+		}
+		consider(n, func() []int {
+			out := append([]int(nil), x.anyAddr...)
+			for _, p := range prefixes {
+				out = x.tree(p).collect(p, out)
+			}
+			return out
+		})
+	}
+
+	if !dbWildcard(r.DBs) {
+		n := len(x.dbWild)
+		for _, tok := range r.DBs {
+			n += len(x.dbTok[tok])
+		}
+		consider(n, func() []int {
+			out := append([]int(nil), x.dbWild...)
+			for _, tok := range r.DBs {
+				out = append(out, x.dbTok[tok]...)
+			}
+			return out
+		})
+	}
+
+	if !userWildcard(r.Users) {
+		n := len(x.usrWild)
+		for _, tok := range r.Users {
+			n += len(x.usrTok[tok])
+		}
+		consider(n, func() []int {
+			out := append([]int(nil), x.usrWild...)
+			for _, tok := range r.Users {
+				out = append(out, x.usrTok[tok]...)
+			}
+			return out
+		})
+	}
+
+	var list []int
+	if pick == nil {
+		list = make([]int, x.total)
+		for i := range list {
+			list[i] = i
+		}
+		return list
+	}
+	list = pick()
+	x.stamp++
+	out := list[:0]
+	for _, i := range list {
+		if x.seen[i] != x.stamp {
+			x.seen[i] = x.stamp
+			out = append(out, i)
+		}
+	}
+	sort.Ints(out)
+	return out
+}
+
+func (x *overlapIndex) tree(p netip.Prefix) *prefixNode {
+	if p.Addr().Is4() {
+		return x.v4
+	}
+	return x.v6
+}
+
+func (n *prefixNode) insert(p netip.Prefix, i int) {
+	addr := p.Addr().AsSlice()
+	n.count++
+	for b := 0; b < p.Bits(); b++ {
+		bit := addr[b/8] >> (7 - b%8) & 1
+		if n.child[bit] == nil {
+			n.child[bit] = &prefixNode{}
+		}
+		n = n.child[bit]
+		n.count++
+	}
+	n.rules = append(n.rules, i)
+}
+
+// walk проходит путь префикса p: visit для каждого предка (включая узел p);
+// возвращает узел p или nil, если такого пути в дереве нет.
+func (n *prefixNode) walk(p netip.Prefix, visit func(*prefixNode)) *prefixNode {
+	addr := p.Addr().AsSlice()
+	for b := 0; ; b++ {
+		visit(n)
+		if b == p.Bits() {
+			return n
+		}
+		n = n.child[addr[b/8]>>(7-b%8)&1]
+		if n == nil {
+			return nil
+		}
+	}
+}
+
+// estimate — верхняя оценка числа кандидатов: предки плюс поддерево.
+func (n *prefixNode) estimate(p netip.Prefix) int {
+	total := 0
+	end := n.walk(p, func(a *prefixNode) { total += len(a.rules) })
+	if end != nil {
+		total += end.count - len(end.rules)
+	}
+	return total
+}
+
+// collect добавляет правила-предки (сети шире p) и потомков (сети внутри p).
+func (n *prefixNode) collect(p netip.Prefix, out []int) []int {
+	end := n.walk(p, func(a *prefixNode) { out = append(out, a.rules...) })
+	if end != nil {
+		for _, c := range end.child {
+			out = c.subtree(out)
+		}
+	}
+	return out
+}
+
+func (n *prefixNode) subtree(out []int) []int {
+	if n == nil {
+		return out
+	}
+	out = append(out, n.rules...)
+	for _, c := range n.child {
+		out = c.subtree(out)
+	}
+	return out
+}
+
+// rulePrefixes — конкретные сети правила; false, если адрес «любой»
+// (all/samenet) или это local.
+func rulePrefixes(r Rule) ([]netip.Prefix, bool) {
+	if !r.IsHost() || r.Addr.Any || len(r.Addr.Networks) == 0 {
+		return nil, false
+	}
+	out := make([]netip.Prefix, 0, len(r.Addr.Networks))
+	for _, n := range r.Addr.Networks {
+		p, ok := toPrefix(n)
+		if !ok {
+			return nil, false
+		}
+		out = append(out, p)
+	}
+	return out, true
+}
+
+func dbWildcard(dbs []string) bool {
+	for _, tok := range dbs {
+		switch tok {
+		case "all", "sameuser", "samerole", "samegroup":
+			return true
+		}
+		if isRegexToken(tok) {
+			return true
+		}
+	}
+	return false
+}
+
+func userWildcard(users []string) bool {
+	for _, tok := range users {
+		if tok == "all" || strings.HasPrefix(tok, "+") || isRegexToken(tok) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package hba
+
+import "os"
+
+// ownedByRoot — владелец файла неизвестен вне unix.
+func ownedByRoot(st os.FileInfo) (bool, bool) {
+	return false, false
+}
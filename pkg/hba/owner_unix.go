@@ -0,0 +1,17 @@
+//go:build unix
+
+package hba
+
+import (
+	"os"
+	"syscall"
+)
+
+// ownedByRoot — владелец файла root; второй результат — владелец известен.
+func ownedByRoot(st os.FileInfo) (bool, bool) {
+	sys, ok := st.Sys().(*syscall.Stat_t)
+	if !ok {
+		return false, false
+	}
+	return sys.Uid == 0, true
+}
@@ -10,6 +10,9 @@ import (
 // ParseHBA читает pg_hba.conf-подобный поток, отбрасывает комментарии/пустые строки
 // и возвращает нормализованный список правил. Минимальные валидации: количество полей,
 // корректность адреса для host*, распознавание метода и опций.
+// Строки include/include_if_exists/include_dir (PostgreSQL 16+) правилами не
+// являются и пропускаются — их возвращает ParseIncludes. Чтобы получить
+// правила, которые видит сервер, файл с include* читается через LoadHBA.
 // Задача функции — не «строгий парсер postgres», а быстрый и безопасный разбор для статанализа.
 func ParseHBA(r io.Reader) ([]Rule, error) {
 	var rules []Rule
@@ -23,6 +26,9 @@ func ParseHBA(r io.Reader) ([]Rule, error) {
 			continue
 		}
 		fields := strings.Fields(line)
+		if isInclude(fields) {
+			continue
+		}
 		if len(fields) < 4 {
 			return nil, fmt.Errorf("line %d: not enough fields", lineNo)
 		}
@@ -73,12 +79,53 @@ func stripComment(line string) string {
 	return line
 }
 
-// parseList разбирает поля database/user, разделённые запятой, приводит к lowercase.
+// Include — директива включения другого файла (PostgreSQL 16+).
+type Include struct {
+	File string `json:"file,omitempty"` // файл с директивой, если она во включённом файле
+	Line int    `json:"line"`
+	Kind string `json:"kind"` // include, include_if_exists, include_dir
+	Path string `json:"path"`
+}
+
+func isInclude(fields []string) bool {
+	if len(fields) != 2 {
+		return false
+	}
+	switch strings.ToLower(fields[0]) {
+	case "include", "include_if_exists", "include_dir":
+		return true
+	}
+	return false
+}
+
+// ParseIncludes возвращает директивы include* в порядке файла.
+func ParseIncludes(r io.Reader) ([]Include, error) {
+	var out []Include
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		fields := strings.Fields(stripComment(scanner.Text()))
+		if isInclude(fields) {
+			out = append(out, Include{Line: lineNo, Kind: strings.ToLower(fields[0]), Path: strings.Trim(fields[1], `"`)})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// parseList разбирает поля database/user, разделённые запятой, приводит к
+// lowercase. Регулярные выражения (/..., PostgreSQL 16+) регистр сохраняют.
 func parseList(s string) []string {
 	parts := strings.Split(s, ",")
 	out := make([]string, 0, len(parts))
 	for _, p := range parts {
-		p = strings.TrimSpace(strings.ToLower(p))
+		p = strings.TrimSpace(p)
+		if !isRegexToken(p) {
+			p = strings.ToLower(p)
+		}
 		if p == "" {
 			continue
 		}
@@ -0,0 +1,157 @@
+package hba
+
+import (
+	"fmt"
+	"strings"
+)
+
+// UnifiedDiff печатает разницу двух текстов в формате unified diff
+// (3 строки контекста), пригодном для `patch -p1` / `git apply`.
+// Пустая строка — тексты совпадают.
+func UnifiedDiff(oldName, newName, a, b string) string {
+	al := splitLines(a)
+	bl := splitLines(b)
+	ops := diffLines(al, bl)
+
+	const context = 3
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", oldName, newName)
+	changed := false
+	for start := 0; start < len(ops); {
+		// ищем следующее изменение
+		for start < len(ops) && ops[start].kind == ' ' {
+			start++
+		}
+		if start == len(ops) {
+			break
+		}
+		changed = true
+		lo := max(start-context, 0)
+		// расширяем ханк, пока между изменениями не больше 2*context строк контекста
+		hi := start
+		for k := start; k < len(ops); k++ {
+			if ops[k].kind != ' ' {
+				hi = k
+				continue
+			}
+			if k-hi > 2*context {
+				break
+			}
+		}
+		end := min(hi+context+1, len(ops))
+
+		aStart, bStart := ops[lo].a, ops[lo].b
+		aLen, bLen := 0, 0
+		for _, op := range ops[lo:end] {
+			if op.kind != '+' {
+				aLen++
+			}
+			if op.kind != '-' {
+				bLen++
+			}
+		}
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n", hunkRange(aStart, aLen), hunkRange(bStart, bLen))
+		for _, op := range ops[lo:end] {
+			fmt.Fprintf(&sb, "%c%s\n", op.kind, op.text)
+		}
+		start = end
+	}
+	if !changed {
+		return ""
+	}
+	return sb.String()
+}
+
+func hunkRange(start, n int) string {
+	if n == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if n == 1 {
+		return fmt.Sprint(start + 1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, n)
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// diffOp — строка диффа: ' ' общая, '-' только в старом, '+' только в новом.
+// a, b — сколько строк старого/нового текста предшествует операции.
+type diffOp struct {
+	kind rune
+	text string
+	a, b int
+}
+
+// diffLines — кратчайший скрипт правки по алгоритму Майерса, O((N+M)·D).
+// Для перестановок правил D мало, так что и большие файлы считаются быстро.
+func diffLines(a, b []string) []diffOp {
+	n, m := len(a), len(b)
+	offset := n + m
+	v := make([]int, 2*offset+2)
+	var trace [][]int
+	for d := 0; d <= n+m; d++ {
+		trace = append(trace, append([]int(nil), v...))
+		done := false
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				done = true
+				break
+			}
+		}
+		if done {
+			break
+		}
+	}
+
+	// обратный проход по сохранённым фронтам
+	var ops []diffOp
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+			ops = append(ops, diffOp{' ', a[x], x, y})
+		}
+		if d == 0 {
+			break
+		}
+		if x == prevX {
+			y--
+			ops = append(ops, diffOp{'+', b[y], x, y})
+		} else {
+			x--
+			ops = append(ops, diffOp{'-', a[x], x, y})
+		}
+	}
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
@@ -0,0 +1,408 @@
+package hba
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Setting — параметр postgresql.conf и место, где задано действующее
+// значение. File == "" — параметр нигде не задан, Value — значение по
+// умолчанию.
+type Setting struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+	File  string `json:"file,omitempty"`
+	Line  int    `json:"line,omitempty"`
+}
+
+// Origin — «файл:строка» или «default» для вывода.
+func (s Setting) Origin() string {
+	if s.File == "" {
+		return "default"
+	}
+	return fmt.Sprintf("%s:%d", s.File, s.Line)
+}
+
+// AutoConfFileName — файл ALTER SYSTEM в каталоге данных; читается после
+// postgresql.conf и переопределяет его.
+const AutoConfFileName = "postgresql.auto.conf"
+
+// maxConfDepth — предел вложенности include, как в PostgreSQL.
+const maxConfDepth = 10
+
+// ServerSettingNames — параметры сервера, которые влияют на анализ pg_hba.conf.
+var ServerSettingNames = []string{
+	"ssl", "ssl_min_protocol_version", "ssl_ciphers", "ssl_cert_file", "ssl_key_file", "ssl_ca_file",
+	"hba_file", "ident_file", "listen_addresses", "password_encryption",
+	"unix_socket_directories", "unix_socket_group", "unix_socket_permissions",
+}
+
+// serverDefaults — значения по умолчанию PostgreSQL. hba_file и ident_file
+// по умолчанию лежат рядом с postgresql.conf, см. ServerConfig.Get.
+var serverDefaults = map[string]string{
+	"ssl":                      "off",
+	"ssl_min_protocol_version": "TLSv1.2",
+	"ssl_ciphers":              "HIGH:MEDIUM:+3DES:!aNULL",
+	"ssl_cert_file":            "server.crt",
+	"ssl_key_file":             "server.key",
+	"ssl_ca_file":              "",
+	"listen_addresses":         "localhost",
+	"password_encryption":      "scram-sha-256",
+	"unix_socket_directories":  "/tmp",
+	"unix_socket_group":        "",
+	"unix_socket_permissions":  "0777",
+}
+
+// ServerConfig — действующие параметры сервера после чтения postgresql.conf
+// со всеми include и postgresql.auto.conf. Для каждого параметра хранится
+// последнее присваивание, как при загрузке конфигурации в PostgreSQL.
+type ServerConfig struct {
+	Path     string             // основной файл (config_file)
+	DataDir  string             // каталог данных: data_directory или каталог Path
+	Files    []string           // прочитанные файлы в порядке чтения
+	Settings map[string]Setting // по имени в нижнем регистре
+	Version  int                // мажорная версия из PG_VERSION каталога данных; 0 — неизвестна
+}
+
+// ParsePGConf разбирает один файл формата postgresql.conf без перехода по
+// include: директивы include* возвращаются как параметры с такими именами.
+// file — имя для Setting.File и сообщений об ошибках.
+func ParsePGConf(r io.Reader, file string) ([]Setting, error) {
+	var out []Setting
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		s, ok, err := parseConfLine(scanner.Text())
+		if err != nil {
+			return nil, fmt.Errorf("%s: line %d: %w", file, lineNo, err)
+		}
+		if ok {
+			s.File, s.Line = file, lineNo
+			out = append(out, s)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// parseConfLine разбирает строку «имя [=] значение [# комментарий]».
+// Значение — слово до пробела или '#', либо строка в одинарных кавычках
+// (кавычка внутри удваивается или экранируется обратной косой чертой).
+func parseConfLine(line string) (Setting, bool, error) {
+	rest := strings.TrimLeft(line, " \t")
+	if rest == "" || rest[0] == '#' {
+		return Setting{}, false, nil
+	}
+	n := 0
+	for n < len(rest) && isConfNameChar(rest[n], n == 0) {
+		n++
+	}
+	if n == 0 {
+		return Setting{}, false, fmt.Errorf("syntax error near %q", rest)
+	}
+	s := Setting{Name: strings.ToLower(rest[:n])}
+	rest = strings.TrimLeft(rest[n:], " \t")
+	if strings.HasPrefix(rest, "=") {
+		rest = strings.TrimLeft(rest[1:], " \t")
+	}
+	switch {
+	case rest == "" || rest[0] == '#':
+		return Setting{}, false, fmt.Errorf("missing value for %q", s.Name)
+	case rest[0] == '\'':
+		v, tail, err := unquoteConf(rest)
+		if err != nil {
+			return Setting{}, false, fmt.Errorf("%s: %w", s.Name, err)
+		}
+		s.Value, rest = v, tail
+	default:
+		end := strings.IndexAny(rest, " \t#")
+		if end < 0 {
+			end = len(rest)
+		}
+		s.Value, rest = rest[:end], rest[end:]
+	}
+	if rest = strings.TrimLeft(rest, " \t"); rest != "" && rest[0] != '#' {
+		return Setting{}, false, fmt.Errorf("syntax error near %q", rest)
+	}
+	return s, true, nil
+}
+
+func isConfNameChar(c byte, first bool) bool {
+	switch {
+	case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '_':
+		return true
+	case c >= '0' && c <= '9', c == '.', c == '-':
+		return !first
+	}
+	return false
+}
+
+// unquoteConf читает строку в одинарных кавычках с начала s и возвращает
+// значение и остаток строки.
+func unquoteConf(s string) (string, string, error) {
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\'' && i+1 < len(s) && s[i+1] == '\'':
+			b.WriteByte('\'')
+			i++
+		case c == '\'':
+			return b.String(), s[i+1:], nil
+		case c == '\\' && i+1 < len(s):
+			i++
+			switch s[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			case 'b':
+				b.WriteByte('\b')
+			case 'f':
+				b.WriteByte('\f')
+			default:
+				b.WriteByte(s[i])
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", "", fmt.Errorf("unterminated quoted string")
+}
+
+// LoadPGConf читает postgresql.conf, переходя по include, include_if_exists
+// и include_dir (относительные пути — от каталога файла с директивой,
+// include_dir — файлы *.conf по имени), затем postgresql.auto.conf из
+// каталога данных. Каталог данных — data_directory или каталог path.
+func LoadPGConf(path string) (*ServerConfig, error) {
+	return loadPGConf(path, filepath.Dir(path))
+}
+
+// loadPGConf — LoadPGConf с каталогом данных по умолчанию dataDir (-D сервера).
+func loadPGConf(path, dataDir string) (*ServerConfig, error) {
+	c := &ServerConfig{Path: path, Settings: map[string]Setting{}}
+	if err := c.load(path, 0, false); err != nil {
+		return nil, err
+	}
+	c.DataDir = dataDir
+	if s, ok := c.Settings["data_directory"]; ok && s.Value != "" {
+		c.DataDir = resolvePath(filepath.Dir(s.File), s.Value)
+	}
+	if err := c.load(filepath.Join(c.DataDir, AutoConfFileName), 0, true); err != nil {
+		return nil, err
+	}
+	c.Version = readPGVersion(c.DataDir)
+	return c, nil
+}
+
+// load читает файл и применяет его параметры; optional — отсутствие файла
+// не ошибка (include_if_exists, postgresql.auto.conf).
+func (c *ServerConfig) load(path string, depth int, optional bool) error {
+	if depth > maxConfDepth {
+		return fmt.Errorf("%s: include nesting is deeper than %d levels", path, maxConfDepth)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		if optional && os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to open config: %w", err)
+	}
+	settings, err := ParsePGConf(f, path)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("failed to parse config: %w", err)
+	}
+	c.Files = append(c.Files, path)
+	dir := filepath.Dir(path)
+	for _, s := range settings {
+		switch s.Name {
+		case "include", "include_if_exists":
+			if err := c.load(resolvePath(dir, s.Value), depth+1, s.Name == "include_if_exists"); err != nil {
+				return err
+			}
+		case "include_dir":
+			files, err := confDir(resolvePath(dir, s.Value))
+			if err != nil {
+				return fmt.Errorf("%s: line %d: %w", s.File, s.Line, err)
+			}
+			for _, file := range files {
+				if err := c.load(file, depth+1, false); err != nil {
+					return err
+				}
+			}
+		default:
+			c.Settings[s.Name] = s
+		}
+	}
+	return nil
+}
+
+// resolvePath — путь из параметра относительно каталога dir.
+func resolvePath(dir, p string) string {
+	if filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(dir, p)
+}
+
+// confDir — файлы *.conf каталога по имени, без скрытых.
+func confDir(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || strings.HasPrefix(name, ".") || !strings.HasSuffix(name, ".conf") {
+			continue
+		}
+		out = append(out, filepath.Join(dir, name))
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// Get — действующее значение параметра: последнее присваивание или значение
+// по умолчанию (File == ""). Пути hba_file, ident_file и ssl_*_file
+// возвращаются абсолютными или относительными к текущему каталогу:
+// относительный путь в параметре отсчитывается от каталога данных, как у сервера.
+func (c *ServerConfig) Get(name string) Setting {
+	name = strings.ToLower(name)
+	s, ok := c.Settings[name]
+	if !ok {
+		s = Setting{Name: name, Value: serverDefaults[name]}
+	}
+	switch name {
+	case "hba_file", "ident_file":
+		if !ok {
+			base := "pg_hba.conf"
+			if name == "ident_file" {
+				base = "pg_ident.conf"
+			}
+			s.Value = filepath.Join(filepath.Dir(c.Path), base)
+		} else {
+			s.Value = resolvePath(c.DataDir, s.Value)
+		}
+	case "ssl_cert_file", "ssl_key_file", "ssl_ca_file":
+		if s.Value != "" {
+			s.Value = resolvePath(c.DataDir, s.Value)
+		}
+	}
+	return s
+}
+
+// ServerSettings — параметры ServerSettingNames в этом порядке.
+func (c *ServerConfig) ServerSettings() []Setting {
+	out := make([]Setting, 0, len(ServerSettingNames))
+	for _, name := range ServerSettingNames {
+		out = append(out, c.Get(name))
+	}
+	return out
+}
+
+// SSL — значение ssl как булево.
+func (c *ServerConfig) SSL() (bool, error) {
+	s := c.Get("ssl")
+	v, ok := parseConfBool(s.Value)
+	if !ok {
+		return false, fmt.Errorf("%s: invalid boolean for ssl: %q", s.Origin(), s.Value)
+	}
+	return v, nil
+}
+
+// ListenAddresses — адреса из listen_addresses; пустой список — только
+// unix-сокеты, "*" — все интерфейсы.
+func (c *ServerConfig) ListenAddresses() []string {
+	return splitConfList(c.Get("listen_addresses").Value)
+}
+
+// UnixSocketDirectories — каталоги unix-сокетов; пустой список — сокетов нет.
+func (c *ServerConfig) UnixSocketDirectories() []string {
+	return splitConfList(c.Get("unix_socket_directories").Value)
+}
+
+// PasswordEncryption — алгоритм хранения новых паролей. Старые значения
+// on/true (до PostgreSQL 14) означают md5.
+func (c *ServerConfig) PasswordEncryption() string {
+	v := strings.ToLower(c.Get("password_encryption").Value)
+	if b, ok := parseConfBool(v); ok && b {
+		return "md5"
+	}
+	return v
+}
+
+// Apply переносит параметры сервера в Config: ssl, версию (если известна)
+// и сам ServerConfig (для ссылок на источник в сообщениях). Флаги CLI
+// применяются после Apply.
+func (c *ServerConfig) Apply(cfg *Config) error {
+	ssl, err := c.SSL()
+	if err != nil {
+		return err
+	}
+	cfg.SSLOn = ssl
+	if c.Version != 0 {
+		cfg.PGVersion = c.Version
+	}
+	cfg.Server = c
+	return nil
+}
+
+// parseConfBool — булево значение в записи PostgreSQL: on/off, true/false,
+// yes/no, 1/0 и однозначные префиксы.
+func parseConfBool(v string) (bool, bool) {
+	v = strings.ToLower(strings.TrimSpace(v))
+	switch {
+	case v == "1" || v == "on":
+		return true, true
+	case v == "0" || len(v) >= 2 && strings.HasPrefix("off", v):
+		return false, true
+	}
+	for _, w := range []string{"true", "yes"} {
+		if v != "" && strings.HasPrefix(w, v) {
+			return true, true
+		}
+	}
+	for _, w := range []string{"false", "no"} {
+		if v != "" && strings.HasPrefix(w, v) {
+			return false, true
+		}
+	}
+	return false, false
+}
+
+func splitConfList(v string) []string {
+	var out []string
+	for _, p := range strings.Split(v, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// sslSource — откуда взят ssl, для сообщений проверок: " (set at файл:строка)"
+// или пусто, если postgresql.conf не читался или значение переопределено флагом.
+func (c Config) sslSource() string {
+	if c.Server == nil {
+		return ""
+	}
+	if v, err := c.Server.SSL(); err != nil || v != c.SSLOn {
+		return ""
+	}
+	s := c.Server.Get("ssl")
+	if s.File == "" {
+		return " (default; not set in postgresql.conf)"
+	}
+	return fmt.Sprintf(" (set at %s)", s.Origin())
+}
@@ -0,0 +1,81 @@
+package hba
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DebianConfRoot — корень конфигурации кластеров в раскладке Debian/Ubuntu
+// (postgresql-common): данные в /var/lib/postgresql/<версия>/<кластер>,
+// конфигурация в /etc/postgresql/<версия>/<кластер>.
+var DebianConfRoot = "/etc/postgresql"
+
+// DiscoverPGConf находит postgresql.conf кластера по каталогу данных:
+//  1. config_file из postmaster.opts (командная строка последнего запуска);
+//  2. postgresql.conf в самом каталоге данных;
+//  3. DebianConfRoot/<версия>/<кластер>/postgresql.conf.
+func DiscoverPGConf(pgdata string) (string, error) {
+	if path, ok := postmasterConfigFile(pgdata); ok && fileExists(path) {
+		return path, nil
+	}
+	if path := filepath.Join(pgdata, "postgresql.conf"); fileExists(path) {
+		return path, nil
+	}
+	abs, err := filepath.Abs(pgdata)
+	if err == nil {
+		cluster, version := filepath.Base(abs), filepath.Base(filepath.Dir(abs))
+		if path := filepath.Join(DebianConfRoot, version, cluster, "postgresql.conf"); fileExists(path) {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("no postgresql.conf found for data directory %s", pgdata)
+}
+
+// postmasterConfigFile — config_file из postmaster.opts, например
+//
+//	/usr/lib/postgresql/16/bin/postgres "-D" "/var/lib/postgresql/16/main" "-c" "config_file=/etc/postgresql/16/main/postgresql.conf"
+func postmasterConfigFile(pgdata string) (string, bool) {
+	data, err := os.ReadFile(filepath.Join(pgdata, "postmaster.opts"))
+	if err != nil {
+		return "", false
+	}
+	for _, arg := range strings.Fields(string(data)) {
+		arg = strings.Trim(arg, `"'`)
+		if v, ok := strings.CutPrefix(arg, "config_file="); ok && v != "" {
+			return resolvePath(pgdata, v), true
+		}
+	}
+	return "", false
+}
+
+func fileExists(path string) bool {
+	st, err := os.Stat(path)
+	return err == nil && !st.IsDir()
+}
+
+// LoadDataDir находит и читает конфигурацию кластера по каталогу данных
+// (DiscoverPGConf + LoadPGConf). Каталог данных — pgdata, если
+// data_directory не задан; PG_VERSION из него даёт ServerConfig.Version.
+func LoadDataDir(pgdata string) (*ServerConfig, error) {
+	path, err := DiscoverPGConf(pgdata)
+	if err != nil {
+		return nil, err
+	}
+	return loadPGConf(path, pgdata)
+}
+
+// readPGVersion — мажорная версия из файла PG_VERSION каталога данных;
+// 0 — файла нет или он нечитаем.
+func readPGVersion(dataDir string) int {
+	data, err := os.ReadFile(filepath.Join(dataDir, "PG_VERSION"))
+	if err != nil {
+		return 0
+	}
+	v, err := ParseVersion(string(data))
+	if err != nil {
+		return 0
+	}
+	return v
+}
@@ -0,0 +1,311 @@
+package hba
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// PolicyFileName — имя файла политики, который ищется вверх по дереву каталогов.
+const PolicyFileName = ".hba-check.json"
+
+// Threshold — пороги «широкой» сети (префикс <=); 0 — не задан.
+type Threshold struct {
+	WideV4 int `json:"wide4,omitempty"`
+	WideV6 int `json:"wide6,omitempty"`
+}
+
+// PolicySettings — настройки строгости: уровни по кодам, выключенные коды,
+// пороги по типам подключений ("default" — для всех типов), шкала силы,
+// утверждения политики доступа, параметры проверки сертификатов.
+type PolicySettings struct {
+	SSL            *bool                `json:"ssl,omitempty"`
+	PGVersion      int                  `json:"pg_version,omitempty"`
+	CertExpiryDays int                  `json:"cert_expiry_days,omitempty"`
+	ServerHostname string               `json:"server_hostname,omitempty"`
+	Severity       map[string]Severity  `json:"severity,omitempty"`
+	Disable        []string             `json:"disable,omitempty"`
+	Thresholds     map[string]Threshold `json:"thresholds,omitempty"`
+	Strength       Strength             `json:"strength,omitempty"`
+	Assertions     []Assertion          `json:"assertions,omitempty"`
+}
+
+// PolicyOverride — настройки для файлов, подходящих под Paths. Шаблоны
+// считаются от каталога файла политики; `**` — любое число каталогов,
+// шаблон без `/` сравнивается с именем файла на любой глубине.
+type PolicyOverride struct {
+	Paths []string `json:"paths"`
+	PolicySettings
+}
+
+// Policy — содержимое .hba-check.json:
+//
+//	{
+//	  "severity": {"md5Deprecated": "ERROR"},
+//	  "disable": ["localAllAll"],
+//	  "thresholds": {"default": {"wide4": 16}, "hostssl": {"wide4": 12}},
+//	  "overrides": [{"paths": ["dev/**"], "disable": ["trustNetwork"]}]
+//	}
+type Policy struct {
+	PolicySettings
+	Overrides []PolicyOverride `json:"overrides,omitempty"`
+	Dir       string           `json:"-"` // каталог файла политики
+}
+
+// ParsePolicy читает политику и проверяет коды и уровни по реестру.
+func ParsePolicy(r io.Reader, reg *Registry) (Policy, error) {
+	var p Policy
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&p); err != nil {
+		return Policy{}, err
+	}
+	if err := p.PolicySettings.normalize(reg); err != nil {
+		return Policy{}, err
+	}
+	for i := range p.Overrides {
+		if len(p.Overrides[i].Paths) == 0 {
+			return Policy{}, fmt.Errorf("override %d: empty paths", i+1)
+		}
+		if err := p.Overrides[i].PolicySettings.normalize(reg); err != nil {
+			return Policy{}, fmt.Errorf("override %d: %w", i+1, err)
+		}
+	}
+	return p, nil
+}
+
+func (s *PolicySettings) normalize(reg *Registry) error {
+	if s.PGVersion != 0 {
+		if _, err := ParseVersion(strconv.Itoa(s.PGVersion)); err != nil {
+			return err
+		}
+	}
+	if s.CertExpiryDays < 0 {
+		return fmt.Errorf("cert_expiry_days must not be negative: %d", s.CertExpiryDays)
+	}
+	if err := reg.Validate(s.Disable); err != nil {
+		return err
+	}
+	for code, sev := range s.Severity {
+		if _, ok := reg.Lookup(code); !ok {
+			return fmt.Errorf("unknown check code: %s", code)
+		}
+		switch up := Severity(strings.ToUpper(string(sev))); up {
+		case SeverityError, SeverityWarn, SeverityInfo:
+			s.Severity[code] = up
+		default:
+			return fmt.Errorf("%s: unknown severity %q", code, sev)
+		}
+	}
+	for typ := range s.Thresholds {
+		switch typ {
+		case "default", "host", "hostssl", "hostnossl", "hostgssenc", "hostnogssenc":
+		default:
+			return fmt.Errorf("thresholds: unknown connection type %q", typ)
+		}
+	}
+	for i := range s.Assertions {
+		if err := s.Assertions[i].validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadPolicy читает файл политики.
+func LoadPolicy(file string, reg *Registry) (Policy, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return Policy{}, err
+	}
+	defer f.Close()
+	p, err := ParsePolicy(f, reg)
+	if err != nil {
+		return Policy{}, fmt.Errorf("%s: %w", file, err)
+	}
+	p.Dir = filepath.Dir(file)
+	return p, nil
+}
+
+// FindPolicy ищет .hba-check.json в каталоге dir и выше, до корня.
+func FindPolicy(dir string) (string, bool) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", false
+	}
+	for {
+		candidate := filepath.Join(dir, PolicyFileName)
+		if st, err := os.Stat(candidate); err == nil && !st.IsDir() {
+			return candidate, true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+// For — настройки для проверяемого файла: общие плюс все подходящие
+// переопределения по порядку (последнее побеждает).
+func (p Policy) For(file string) PolicySettings {
+	out := p.PolicySettings.clone()
+	rel := file
+	if abs, err := filepath.Abs(file); err == nil && p.Dir != "" {
+		if dir, err := filepath.Abs(p.Dir); err == nil {
+			if r, err := filepath.Rel(dir, abs); err == nil {
+				rel = r
+			}
+		}
+	}
+	rel = filepath.ToSlash(rel)
+	for _, o := range p.Overrides {
+		for _, pat := range o.Paths {
+			if matchPath(pat, rel) {
+				out = out.merge(o.PolicySettings)
+				break
+			}
+		}
+	}
+	return out
+}
+
+func (s PolicySettings) clone() PolicySettings {
+	return PolicySettings{}.merge(s)
+}
+
+// merge накладывает top на s: уровни и пороги по ключам, выключенные коды
+// и утверждения объединяются, шкала силы дополняется.
+func (s PolicySettings) merge(top PolicySettings) PolicySettings {
+	out := PolicySettings{
+		SSL:            s.SSL,
+		PGVersion:      s.PGVersion,
+		CertExpiryDays: s.CertExpiryDays,
+		ServerHostname: s.ServerHostname,
+		Severity:       map[string]Severity{},
+		Disable:        append([]string(nil), s.Disable...),
+		Thresholds:     map[string]Threshold{},
+		Strength:       s.Strength,
+		Assertions:     append([]Assertion(nil), s.Assertions...),
+	}
+	if top.SSL != nil {
+		out.SSL = top.SSL
+	}
+	if top.PGVersion != 0 {
+		out.PGVersion = top.PGVersion
+	}
+	if top.CertExpiryDays != 0 {
+		out.CertExpiryDays = top.CertExpiryDays
+	}
+	if top.ServerHostname != "" {
+		out.ServerHostname = top.ServerHostname
+	}
+	for k, v := range s.Severity {
+		out.Severity[k] = v
+	}
+	for k, v := range top.Severity {
+		out.Severity[k] = v
+	}
+	for _, c := range top.Disable {
+		if !containsToken(out.Disable, c) {
+			out.Disable = append(out.Disable, c)
+		}
+	}
+	for k, v := range s.Thresholds {
+		out.Thresholds[k] = v
+	}
+	for k, v := range top.Thresholds {
+		cur := out.Thresholds[k]
+		if v.WideV4 != 0 {
+			cur.WideV4 = v.WideV4
+		}
+		if v.WideV6 != 0 {
+			cur.WideV6 = v.WideV6
+		}
+		out.Thresholds[k] = cur
+	}
+	if top.Strength.Methods != nil || top.Strength.Options != nil || top.Strength.Types != nil {
+		out.Strength = s.Strength.With(top.Strength)
+	}
+	out.Assertions = append(out.Assertions, top.Assertions...)
+	return out
+}
+
+// Apply переносит настройки политики в Config. Значения, уже заданные явно
+// (флагами CLI), вызывающий применяет после Apply.
+func (s PolicySettings) Apply(cfg *Config) {
+	if s.SSL != nil {
+		cfg.SSLOn = *s.SSL
+	}
+	if s.PGVersion != 0 {
+		cfg.PGVersion = s.PGVersion
+	}
+	if s.CertExpiryDays != 0 {
+		cfg.CertExpiryDays = s.CertExpiryDays
+	}
+	if s.ServerHostname != "" {
+		cfg.ServerHostname = s.ServerHostname
+	}
+	if len(s.Severity) > 0 {
+		cfg.Severity = s.Severity
+	}
+	cfg.Disable = append(cfg.Disable, s.Disable...)
+	if d, ok := s.Thresholds["default"]; ok {
+		if d.WideV4 != 0 {
+			cfg.WideV4 = d.WideV4
+		}
+		if d.WideV6 != 0 {
+			cfg.WideV6 = d.WideV6
+		}
+	}
+	for typ, t := range s.Thresholds {
+		if typ == "default" {
+			continue
+		}
+		if cfg.Thresholds == nil {
+			cfg.Thresholds = map[string]Threshold{}
+		}
+		cfg.Thresholds[typ] = t
+	}
+	if s.Strength.Methods != nil || s.Strength.Options != nil || s.Strength.Types != nil {
+		cfg.Strength = DefaultStrength().With(s.Strength)
+	}
+	cfg.Assertions = append(cfg.Assertions, s.Assertions...)
+}
+
+// matchPath сопоставляет путь с шаблоном: сегменты через path.Match,
+// `**` — ноль или больше сегментов; шаблон без `/` — по имени файла.
+func matchPath(pattern, rel string) bool {
+	pattern = strings.TrimPrefix(filepath.ToSlash(pattern), "./")
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(rel))
+		return ok
+	}
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(rel, "/"))
+}
+
+func matchSegments(pat, segs []string) bool {
+	for len(pat) > 0 {
+		if pat[0] == "**" {
+			for i := 0; i <= len(segs); i++ {
+				if matchSegments(pat[1:], segs[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segs) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pat[0], segs[0]); !ok {
+			return false
+		}
+		pat, segs = pat[1:], segs[1:]
+	}
+	return len(segs) == 0
+}
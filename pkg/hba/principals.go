@@ -0,0 +1,120 @@
+package hba
+
+import (
+	"sort"
+	"strings"
+)
+
+// Покрытие и пересечение по паре (database, user) считаем не по строкам, а по
+// семантике сопоставления: sameuser связывает БД с пользователем, samerole и
+// +group зависят от членства в ролях. Поэтому берём конечный набор
+// представителей — все имена, упомянутые в правилах и каталоге, плюс «чужие»
+// имена, которых нигде нет, — и прогоняем их через matchDB/matchUser.
+// Без регулярных выражений любое неупомянутое имя ведёт себя так же, как
+// чужое, так что выборка точна. С ними неупомянутые имена различаются
+// набором выражений, под которые подходят; на каждое достижимое сочетание
+// выражений берётся своё имя (regexRegions), и выборка остаётся точной,
+// пока обход не упрётся в regexMaxStates.
+// Физическая репликация — отдельное измерение: для неё имя БД не важно.
+
+const (
+	otherName  = "\x00other"  // имя, не упомянутое ни в одном правиле
+	otherName2 = "\x00other2" // второе такое имя, чтобы sameuser видел db != user
+)
+
+// principalSample собирает представителей для БД и пользователей.
+func principalSample(roles Roles, rs ...Rule) (dbs, users []string) {
+	set := map[string]bool{}
+	var regexes []string
+	needRoles := false
+	for _, r := range rs {
+		for _, tok := range r.DBs {
+			switch {
+			case tok == "all" || tok == "sameuser" || tok == "replication":
+			case tok == "samerole" || tok == "samegroup":
+				needRoles = true
+			case isRegexToken(tok):
+				regexes = append(regexes, tok)
+			default:
+				set[tok] = true
+			}
+		}
+		for _, tok := range r.Users {
+			switch {
+			case tok == "all":
+			case isRegexToken(tok):
+				regexes = append(regexes, tok)
+			case strings.HasPrefix(tok, "+"):
+				set[tok[1:]] = true
+				needRoles = true
+			default:
+				set[tok] = true
+			}
+		}
+	}
+	if needRoles {
+		for _, name := range roles.Names() {
+			set[name] = true
+		}
+	}
+	if len(regexes) > 0 {
+		// имя сочетания, совпавшее с литералом, заменяем вторым: литерал
+		// может отличаться от прочих имён сочетания по другим токенам
+		for _, names := range regexRegions(regexes) {
+			for _, name := range names {
+				if !set[name] {
+					set[name] = true
+					break
+				}
+			}
+		}
+	}
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	dbs = append(dbs, names...)
+	users = append(users, names...)
+	dbs = append(dbs, otherName)
+	users = append(users, otherName2, otherName)
+	return dbs, users
+}
+
+// principalConns перечисляет представителей (db, user, replication) как подключения
+// без транспорта и адреса — их проверяют отдельно.
+func principalConns(roles Roles, rs ...Rule) []Connection {
+	dbs, users := principalSample(roles, rs...)
+	var out []Connection
+	for _, user := range users {
+		for _, db := range dbs {
+			out = append(out, Connection{Database: db, User: user})
+		}
+		out = append(out, Connection{Database: otherName, User: user, Replication: true})
+	}
+	return out
+}
+
+func (r Rule) matchPrincipal(c Connection, roles Roles) bool {
+	return r.matchDB(c, roles) && r.matchUser(c.User, roles)
+}
+
+// principalsCover: каждая пара (db, user), подходящая под lower, подходит и под upper.
+func principalsCover(upper, lower Rule, roles Roles) bool {
+	for _, c := range principalConns(roles, upper, lower) {
+		if lower.matchPrincipal(c, roles) && !upper.matchPrincipal(c, roles) {
+			return false
+		}
+	}
+	return true
+}
+
+// principalsIntersect: существует пара (db, user), подходящая под оба правила.
+func principalsIntersect(a, b Rule, roles Roles) bool {
+	for _, c := range principalConns(roles, a, b) {
+		if a.matchPrincipal(c, roles) && b.matchPrincipal(c, roles) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,350 @@
+package hba
+
+import (
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Токен БД или пользователя, начинающийся с '/', — регулярное выражение
+// (PostgreSQL 16+): остаток строки сопоставляется с именем как есть, без
+// неявных ^ и $.
+
+var regexCache sync.Map // токен -> *regexp.Regexp (nil — некорректное выражение)
+
+func isRegexToken(tok string) bool {
+	return strings.HasPrefix(tok, "/")
+}
+
+// tokenRegexp компилирует выражение токена. PostgreSQL разбирает выражения
+// своим движком (ARE), где есть lookahead и обратные ссылки; выражение,
+// которое RE2 не компилирует, в анализе не совпадает ни с чем, и о нём
+// сообщает regexUnsupported.
+func tokenRegexp(tok string) *regexp.Regexp {
+	if v, ok := regexCache.Load(tok); ok {
+		re, _ := v.(*regexp.Regexp)
+		return re
+	}
+	re, err := regexp.Compile(tok[1:])
+	if err != nil {
+		re = nil
+	}
+	regexCache.Store(tok, re)
+	return re
+}
+
+func matchRegexToken(tok, name string) bool {
+	re := tokenRegexp(tok)
+	return re != nil && re.MatchString(name)
+}
+
+// Представители для регулярных выражений. Имена, не упомянутые в правилах,
+// различаются только тем, под какие выражения они подходят, поэтому на
+// каждое достижимое сочетание выражений (включая «ни под одно») нужно своё
+// имя. Их ищет обход в ширину по произведению NFA всех выражений: состояние —
+// множества инструкций каждого выражения, сработавшие выражения и класс
+// предыдущего символа (для ^, $ и \b). Символы перебираются по одному
+// представителю на интервал, внутри которого ни одно выражение не различает
+// символы, так что найденные сочетания — все достижимые.
+
+const (
+	regexMaxStates = 20000 // предел обхода; при большем числе выражений выборка неполная
+	regexMaxLen    = 64
+	regexWitnesses = 2 // имён на сочетание: одно может совпасть с литералом из правил
+)
+
+var regionCache sync.Map // токены через \x00 -> [][]string
+
+// regexRegions — для набора выражений toks: по сочетанию выражений до
+// regexWitnesses имён, которые подходят ровно под это сочетание.
+func regexRegions(toks []string) [][]string {
+	toks = uniqueSorted(toks)
+	key := strings.Join(toks, "\x00")
+	if v, ok := regionCache.Load(key); ok {
+		return v.([][]string)
+	}
+	var progs []*syntax.Prog
+	for _, tok := range toks {
+		if tokenRegexp(tok) == nil {
+			continue
+		}
+		re, err := syntax.Parse(tok[1:], syntax.Perl)
+		if err != nil {
+			continue
+		}
+		prog, err := syntax.Compile(re.Simplify())
+		if err != nil {
+			continue
+		}
+		progs = append(progs, prog)
+	}
+	out := searchRegions(progs)
+	regionCache.Store(key, out)
+	return out
+}
+
+// regexState — состояние обхода после строки name.
+type regexState struct {
+	name    string
+	prev    rune       // последний символ, -1 в начале
+	threads [][]uint32 // ожидающие символа инструкции каждого выражения
+	matched []bool     // выражение уже нашло вхождение
+}
+
+func searchRegions(progs []*syntax.Prog) [][]string {
+	if len(progs) == 0 {
+		return nil
+	}
+	alphabet := regexAlphabet(progs)
+	start := regexState{prev: -1, threads: make([][]uint32, len(progs)), matched: make([]bool, len(progs))}
+	visits := map[string]int{}
+	found := map[string][]string{}
+	var order []string
+	queue := []regexState{start}
+	for n := 0; len(queue) > 0 && n < regexMaxStates; n++ {
+		st := queue[0]
+		queue = queue[1:]
+		if st.name != "" {
+			sig := regexSignature(progs, st)
+			if len(found[sig]) == 0 {
+				order = append(order, sig)
+			}
+			if len(found[sig]) < regexWitnesses {
+				found[sig] = append(found[sig], st.name)
+			}
+		}
+		if len(st.name) >= regexMaxLen {
+			continue
+		}
+		for _, c := range alphabet {
+			next := regexStep(progs, st, c)
+			k := next.key()
+			if visits[k] >= regexWitnesses {
+				continue
+			}
+			visits[k]++
+			queue = append(queue, next)
+		}
+	}
+	out := make([][]string, 0, len(order))
+	for _, sig := range order {
+		out = append(out, found[sig])
+	}
+	return out
+}
+
+// regexStep — состояние после символа c. Выражения не привязаны к началу
+// имени, поэтому начальная инструкция добавляется на каждой позиции.
+func regexStep(progs []*syntax.Prog, st regexState, c rune) regexState {
+	next := regexState{name: st.name + string(c), prev: c,
+		threads: make([][]uint32, len(progs)), matched: append([]bool(nil), st.matched...)}
+	ctx := syntax.EmptyOpContext(st.prev, c)
+	for k, prog := range progs {
+		pcs, match := regexClosure(prog, withStart(prog, st.threads[k]), ctx)
+		next.matched[k] = next.matched[k] || match
+		set := map[uint32]bool{}
+		for _, pc := range pcs {
+			inst := &prog.Inst[pc]
+			ok := false
+			switch inst.Op {
+			case syntax.InstRune, syntax.InstRune1:
+				ok = inst.MatchRune(c)
+			case syntax.InstRuneAny:
+				ok = true
+			case syntax.InstRuneAnyNotNL:
+				ok = c != '\n'
+			}
+			if ok && !set[inst.Out] {
+				set[inst.Out] = true
+				next.threads[k] = append(next.threads[k], inst.Out)
+			}
+		}
+		sort.Slice(next.threads[k], func(i, j int) bool { return next.threads[k][i] < next.threads[k][j] })
+	}
+	return next
+}
+
+func withStart(prog *syntax.Prog, pcs []uint32) []uint32 {
+	return append(append(make([]uint32, 0, len(pcs)+1), pcs...), uint32(prog.Start))
+}
+
+// regexClosure — инструкции, ждущие символа, достижимые из pcs без чтения
+// символа в контексте ctx; match — по пути встретился InstMatch.
+func regexClosure(prog *syntax.Prog, pcs []uint32, ctx syntax.EmptyOp) ([]uint32, bool) {
+	seen := map[uint32]bool{}
+	var out []uint32
+	match := false
+	stack := pcs
+	for len(stack) > 0 {
+		pc := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if seen[pc] {
+			continue
+		}
+		seen[pc] = true
+		inst := &prog.Inst[pc]
+		switch inst.Op {
+		case syntax.InstAlt, syntax.InstAltMatch:
+			stack = append(stack, inst.Out, inst.Arg)
+		case syntax.InstCapture, syntax.InstNop:
+			stack = append(stack, inst.Out)
+		case syntax.InstEmptyWidth:
+			if syntax.EmptyOp(inst.Arg)&^ctx == 0 {
+				stack = append(stack, inst.Out)
+			}
+		case syntax.InstMatch:
+			match = true
+		case syntax.InstFail:
+		default:
+			out = append(out, pc)
+		}
+	}
+	return out, match
+}
+
+// regexSignature — под какие выражения подходит имя st.name целиком.
+func regexSignature(progs []*syntax.Prog, st regexState) string {
+	sig := make([]byte, len(progs))
+	ctx := syntax.EmptyOpContext(st.prev, -1)
+	for k, prog := range progs {
+		_, match := regexClosure(prog, withStart(prog, st.threads[k]), ctx)
+		sig[k] = '0'
+		if st.matched[k] || match {
+			sig[k] = '1'
+		}
+	}
+	return string(sig)
+}
+
+// key — состояние без имени: строки с одинаковым ключом дальше ведут себя
+// одинаково. Для ^, $ и \b важен только класс предыдущего символа.
+func (st regexState) key() string {
+	var b strings.Builder
+	switch {
+	case st.prev == '\n':
+		b.WriteByte('n')
+	case syntax.IsWordChar(st.prev):
+		b.WriteByte('w')
+	default:
+		b.WriteByte('o')
+	}
+	for k, pcs := range st.threads {
+		if st.matched[k] {
+			b.WriteString("|*")
+			continue
+		}
+		b.WriteByte('|')
+		for _, pc := range pcs {
+			fmt.Fprintf(&b, "%d,", pc)
+		}
+	}
+	return b.String()
+}
+
+// regexAlphabet — по символу на интервал, внутри которого все инструкции
+// выражений (и классы для ^, $, \b) ведут себя одинаково. Из интервала
+// берётся буква или цифра, если она там есть, и такие символы идут первыми:
+// обход в ширину тогда находит читаемые имена.
+func regexAlphabet(progs []*syntax.Prog) []rune {
+	bounds := map[rune]bool{1: true, '\n': true, '\n' + 1: true,
+		'0': true, '9' + 1: true, 'A': true, 'Z' + 1: true, '_': true, '_' + 1: true, 'a': true, 'z' + 1: true}
+	addRange := func(lo, hi rune) {
+		bounds[lo] = true
+		bounds[hi+1] = true
+	}
+	for _, prog := range progs {
+		for _, inst := range prog.Inst {
+			if inst.Op != syntax.InstRune && inst.Op != syntax.InstRune1 {
+				continue
+			}
+			runes := inst.Rune
+			if len(runes) == 1 {
+				runes = []rune{runes[0], runes[0]}
+			}
+			fold := syntax.Flags(inst.Arg)&syntax.FoldCase != 0
+			for i := 0; i+1 < len(runes); i += 2 {
+				addRange(runes[i], runes[i+1])
+				if lo, hi := unicode.SimpleFold(runes[i]), unicode.SimpleFold(runes[i+1]); fold && lo <= hi {
+					addRange(lo, hi)
+				}
+			}
+		}
+	}
+	cuts := make([]rune, 0, len(bounds))
+	for r := range bounds {
+		if r >= 1 && r <= unicode.MaxRune {
+			cuts = append(cuts, r)
+		}
+	}
+	sort.Slice(cuts, func(i, j int) bool { return cuts[i] < cuts[j] })
+	out := make([]rune, 0, len(cuts))
+	for i, lo := range cuts {
+		hi := rune(unicode.MaxRune)
+		if i+1 < len(cuts) {
+			hi = cuts[i+1] - 1
+		}
+		out = append(out, readableRune(lo, hi))
+	}
+	sort.SliceStable(out, func(i, j int) bool { return isReadable(out[i]) && !isReadable(out[j]) })
+	return out
+}
+
+func isReadable(r rune) bool {
+	return r < 0x7f && (r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r))
+}
+
+func readableRune(lo, hi rune) rune {
+	for _, r := range "xa1_" {
+		if lo <= r && r <= hi {
+			return r
+		}
+	}
+	for r := lo; r <= hi && r < 0x7f; r++ {
+		if isReadable(r) {
+			return r
+		}
+	}
+	return lo
+}
+
+// hasRegex — в database или user правила есть регулярное выражение.
+func (r Rule) hasRegex() bool {
+	for _, tok := range append(append([]string{}, r.DBs...), r.Users...) {
+		if isRegexToken(tok) {
+			return true
+		}
+	}
+	return false
+}
+
+var infoRegexUnsupported = CheckInfo{
+	Code: "regexUnsupported", Severity: SeverityWarn,
+	Description: "Regular expression in database or user cannot be analysed (RE2 does not support it).",
+	Rationale:   "PostgreSQL regular expressions allow lookahead and backreferences; the analyser treats such a token as matching nothing, so overlaps, the matrix and assertions may miss what the rule accepts.",
+	Remediation: "Rewrite the expression without lookahead or backreferences, or list the names explicitly.",
+	DocsURL:     docsHBA,
+}
+
+// checkRegexTokens — выражения, которые анализ не может сопоставить.
+func checkRegexTokens(ctx *Context, r Rule) []Issue {
+	var issues []Issue
+	for _, f := range []struct {
+		name string
+		toks []string
+	}{{"database", r.DBs}, {"user", r.Users}} {
+		for _, tok := range f.toks {
+			if !isRegexToken(tok) || tokenRegexp(tok) != nil {
+				continue
+			}
+			_, err := regexp.Compile(tok[1:])
+			issues = append(issues, infoRegexUnsupported.NewIssue(r.Line, fmt.Sprintf(
+				"%s regular expression %q cannot be analysed (%v); it is treated as matching nothing, so results for this rule may be incomplete.",
+				f.name, tok, err)))
+		}
+	}
+	return issues
+}
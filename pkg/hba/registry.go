@@ -0,0 +1,224 @@
+package hba
+
+import (
+	"fmt"
+	"sort"
+)
+
+// CheckInfo — метаданные кода находки: что проверяется, почему это важно
+// и как исправить. По ним строится `-list-checks` и справочник в README.
+type CheckInfo struct {
+	Code        string   `json:"code"`
+	Severity    Severity `json:"severity"` // уровень по умолчанию
+	Description string   `json:"description"`
+	Rationale   string   `json:"rationale"`
+	Remediation string   `json:"remediation"`
+	DocsURL     string   `json:"docs_url,omitempty"`
+}
+
+// NewIssue — находка с кодом и уровнем по умолчанию из метаданных.
+func (ci CheckInfo) NewIssue(line int, message string) Issue {
+	return Issue{Severity: ci.Severity, Code: ci.Code, Line: line, Message: message}
+}
+
+// Check — подключаемая проверка. Одна проверка может выдавать несколько
+// кодов (например, анализ перекрытий); все они перечисляются в Codes.
+type Check interface {
+	Codes() []CheckInfo
+	Run(ctx *Context) []Issue
+}
+
+// RuleCheck — проверка отдельной строки. Registry прогоняет такие проверки
+// построчно (все проверки для строки 1, затем для строки 2, ...), чтобы
+// находки шли в порядке файла.
+type RuleCheck struct {
+	Info  []CheckInfo
+	Check func(ctx *Context, r Rule) []Issue
+}
+
+func (c RuleCheck) Codes() []CheckInfo { return c.Info }
+
+func (c RuleCheck) Run(ctx *Context) []Issue {
+	var issues []Issue
+	for _, r := range ctx.Rules {
+		issues = append(issues, c.checkRule(ctx, r)...)
+	}
+	return issues
+}
+
+// checkRule — находки по правилу r с файлом правила (Rule.File).
+func (c RuleCheck) checkRule(ctx *Context, r Rule) []Issue {
+	issues := c.Check(ctx, r)
+	for i := range issues {
+		issues[i].File = r.File
+	}
+	return issues
+}
+
+// Context — общий контекст прогона: правила, настройки и результаты,
+// которые нужны нескольким проверкам (анализ перекрытий считается один раз).
+type Context struct {
+	Rules  []Rule
+	Config Config
+
+	overlaps     []Issue
+	overlapsDone bool
+}
+
+// NewContext подставляет пороги по умолчанию для незаданных настроек.
+func NewContext(rules []Rule, cfg Config) *Context {
+	if cfg.WideV4 == 0 {
+		cfg.WideV4 = 16
+	}
+	if cfg.WideV6 == 0 {
+		cfg.WideV6 = 48
+	}
+	return &Context{Rules: rules, Config: cfg}
+}
+
+// Overlaps — находки CheckOverlapsWith, посчитанные один раз на прогон.
+func (ctx *Context) Overlaps() []Issue {
+	if !ctx.overlapsDone {
+		ctx.overlaps = CheckOverlapsWith(ctx.Rules, ctx.Config)
+		ctx.overlapsDone = true
+	}
+	return ctx.overlaps
+}
+
+// Registry — набор проверок в порядке регистрации.
+type Registry struct {
+	checks []Check
+	byCode map[string]CheckInfo
+}
+
+// NewRegistry — пустой реестр.
+func NewRegistry() *Registry {
+	return &Registry{byCode: map[string]CheckInfo{}}
+}
+
+// DefaultRegistry — встроенные проверки; CheckAll работает по нему.
+// Свои проверки добавляются через Register.
+var DefaultRegistry = NewRegistry()
+
+// Register добавляет проверку в DefaultRegistry.
+func Register(c Check) error {
+	return DefaultRegistry.Register(c)
+}
+
+// Register добавляет проверку. Коды должны быть уникальны в реестре.
+func (reg *Registry) Register(c Check) error {
+	for _, ci := range c.Codes() {
+		if ci.Code == "" {
+			return fmt.Errorf("check has an empty code")
+		}
+		if _, dup := reg.byCode[ci.Code]; dup {
+			return fmt.Errorf("duplicate check code: %s", ci.Code)
+		}
+	}
+	for _, ci := range c.Codes() {
+		reg.byCode[ci.Code] = ci
+	}
+	reg.checks = append(reg.checks, c)
+	return nil
+}
+
+// MustRegister — Register, паникующий при ошибке (для init встроенных проверок).
+func (reg *Registry) MustRegister(c Check) {
+	if err := reg.Register(c); err != nil {
+		panic(err)
+	}
+}
+
+// Lookup возвращает метаданные кода.
+func (reg *Registry) Lookup(code string) (CheckInfo, bool) {
+	ci, ok := reg.byCode[code]
+	return ci, ok
+}
+
+// Codes — метаданные всех кодов, по алфавиту.
+func (reg *Registry) Codes() []CheckInfo {
+	out := make([]CheckInfo, 0, len(reg.byCode))
+	for _, ci := range reg.byCode {
+		out = append(out, ci)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Code < out[j].Code })
+	return out
+}
+
+// Validate проверяет, что все коды из списка известны реестру.
+func (reg *Registry) Validate(codes []string) error {
+	for _, code := range codes {
+		if _, ok := reg.byCode[code]; !ok {
+			return fmt.Errorf("unknown check code: %s", code)
+		}
+	}
+	return nil
+}
+
+// Run прогоняет включённые проверки: сначала построчные (RuleCheck) в порядке
+// файла, затем остальные в порядке регистрации. Код включён, если он есть в
+// cfg.Enable (или Enable пуст) и его нет в cfg.Disable; проверка, у которой
+// все коды выключены, не запускается. cfg.Severity переопределяет уровни.
+// Находки под директивами cfg.Directives помечаются Suppressed.
+func (reg *Registry) Run(rules []Rule, cfg Config) []Issue {
+	ctx := NewContext(rules, cfg)
+	enabled := codeFilter(cfg)
+
+	var perRule []RuleCheck
+	var whole []Check
+	for _, c := range reg.checks {
+		active := false
+		for _, ci := range c.Codes() {
+			active = active || enabled(ci.Code)
+		}
+		if !active {
+			continue
+		}
+		if rc, ok := c.(RuleCheck); ok {
+			perRule = append(perRule, rc)
+		} else {
+			whole = append(whole, c)
+		}
+	}
+
+	var issues []Issue
+	keep := func(found []Issue) {
+		for _, is := range found {
+			if !enabled(is.Code) {
+				continue
+			}
+			if sev, ok := cfg.Severity[is.Code]; ok {
+				is.Severity = sev
+			}
+			issues = append(issues, is)
+		}
+	}
+	for _, r := range rules {
+		for _, rc := range perRule {
+			keep(rc.checkRule(ctx, r))
+		}
+	}
+	for _, c := range whole {
+		keep(c.Run(ctx))
+	}
+	if len(cfg.Directives) > 0 {
+		found := applySuppressions(issues, cfg.Directives, reg, enabled)
+		issues = issues[:0:0]
+		keep(found)
+	}
+	return issues
+}
+
+func codeFilter(cfg Config) func(string) bool {
+	only := map[string]bool{}
+	for _, c := range cfg.Enable {
+		only[c] = true
+	}
+	off := map[string]bool{}
+	for _, c := range cfg.Disable {
+		off[c] = true
+	}
+	return func(code string) bool {
+		return (len(only) == 0 || only[code]) && !off[code]
+	}
+}
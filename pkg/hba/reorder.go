@@ -0,0 +1,183 @@
+package hba
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ReorderMove — перенос правила Line непосредственно над правилом Before.
+// Shadowing — широкие более слабые правила, которые его затеняли.
+type ReorderMove struct {
+	Line      int   `json:"line"`
+	Before    int   `json:"before"`
+	Shadowing []int `json:"shadowing"`
+}
+
+// Reorder — предложение переставить строгие правила над затеняющими их
+// широкими (overlyBroadRule/shadowedByBroadRule). Changes — все классы
+// подключений, у которых после перестановки поменяется результат;
+// StillShadowed — затенённые правила, которые и на новом месте были бы недостижимы
+// (их перекрывает что-то ещё, например reject выше) — их не переносим.
+type Reorder struct {
+	Moves         []ReorderMove `json:"moves"`
+	Rules         []Rule        `json:"-"`
+	Changes       []Difference  `json:"changes"`
+	StillShadowed []int         `json:"still_shadowed,omitempty"`
+}
+
+// SuggestReorder строит минимальную перестановку: каждое затенённое строгое
+// правило поднимается ровно над самым верхним из затеняющих его широких
+// правил, остальные правила остаются на местах. Правила обрабатываются сверху
+// вниз, так что перенесённые сохраняют исходный взаимный порядок. Перенос,
+// после которого правило всё равно недостижимо, не предлагается.
+func SuggestReorder(rules []Rule, cfg Config) Reorder {
+	cfg.Strength = cfg.strength()
+	var re Reorder
+	order := append([]Rule(nil), rules...)
+	pos := func(line int) int {
+		for k, r := range order {
+			if r.Line == line {
+				return k
+			}
+		}
+		return -1
+	}
+
+	idx := newOverlapIndex()
+	for j, rj := range rules {
+		var shadowing []int
+		for _, i := range idx.candidates(rj) {
+			ri := rules[i]
+			if shadowsStricter(ri, rj, cfg) {
+				shadowing = append(shadowing, ri.Line)
+			}
+		}
+		idx.add(j, rj)
+		if len(shadowing) == 0 {
+			continue
+		}
+		target := pos(shadowing[0])
+		for _, line := range shadowing[1:] {
+			if k := pos(line); k < target {
+				target = k
+			}
+		}
+		from := pos(rj.Line)
+		moved := append([]Rule(nil), order[:target]...)
+		moved = append(moved, rj)
+		moved = append(moved, order[target:from]...)
+		moved = append(moved, order[from+1:]...)
+		if !reachable(moved, rj.Line, cfg.Roles) {
+			// перенос не помогает — правило перекрыто чем-то ещё
+			re.StillShadowed = append(re.StillShadowed, rj.Line)
+			continue
+		}
+		re.Moves = append(re.Moves, ReorderMove{Line: rj.Line, Before: order[target].Line, Shadowing: shadowing})
+		order = moved
+	}
+
+	re.Rules = order
+	if len(re.Moves) > 0 {
+		re.Changes = Compare(rules, order, cfg.Roles)
+	}
+	return re
+}
+
+// reachable — правило line выбирается первым хотя бы для одного класса подключений.
+func reachable(rules []Rule, line int, roles Roles) bool {
+	for _, cell := range NewSpace(roles, rules).Cells() {
+		if Evaluate(rules, cell.Sample(), roles).Line == line {
+			return true
+		}
+	}
+	return false
+}
+
+// shadowsStricter — та же пара, на которую срабатывает overlyBroadRule:
+// верхнее правило полностью покрывает нижнее и использует более слабый метод.
+func shadowsStricter(upper, lower Rule, cfg Config) bool {
+	return typeCovers(upper.Type, lower.Type) &&
+		upper.Addr.Covers(lower.Addr) &&
+		principalsCover(upper, lower, cfg.Roles) &&
+		cfg.Strength.optsNotStricter(upper.Opts, lower.Opts) &&
+		cfg.Strength.Weaker(upper, lower)
+}
+
+// Render применяет перестановку к исходному тексту: строка правила переносится
+// вместе с комментариями непосредственно над ней (без пустых строк между).
+// Остальные строки файла не трогаются.
+func (re Reorder) Render(source string) string {
+	lines := strings.Split(strings.TrimSuffix(source, "\n"), "\n")
+	type unit struct {
+		line  int // строка правила; 0 — не правило
+		lines []string
+	}
+	ruleLine := map[int]bool{}
+	for _, r := range re.Rules {
+		ruleLine[r.Line] = true
+	}
+	var units []unit
+	seenRule := false
+	for i, l := range lines {
+		if !ruleLine[i+1] {
+			units = append(units, unit{lines: []string{l}})
+			continue
+		}
+		u := unit{line: i + 1}
+		// комментарии вплотную над правилом переезжают вместе с ним,
+		// кроме шапки файла над первым правилом
+		for len(units) > 0 && units[len(units)-1].line == 0 && isCommentLine(units[len(units)-1].lines[0]) && seenRule {
+			u.lines = append(units[len(units)-1].lines, u.lines...)
+			units = units[:len(units)-1]
+		}
+		u.lines = append(u.lines, l)
+		units = append(units, u)
+		seenRule = true
+	}
+
+	find := func(line int) int {
+		for k, u := range units {
+			if u.line == line {
+				return k
+			}
+		}
+		return -1
+	}
+	for _, mv := range re.Moves {
+		from, to := find(mv.Line), find(mv.Before)
+		if from < 0 || to < 0 || from < to {
+			continue
+		}
+		u := units[from]
+		copy(units[to+1:from+1], units[to:from])
+		units[to] = u
+	}
+
+	var out []string
+	for _, u := range units {
+		out = append(out, u.lines...)
+	}
+	return strings.Join(out, "\n") + "\n"
+}
+
+func isCommentLine(l string) bool {
+	return strings.HasPrefix(strings.TrimSpace(l), "#")
+}
+
+// String — «line N -> above line M (shadowed by lines ...)».
+func (mv ReorderMove) String() string {
+	return fmt.Sprintf("move line %d above line %d (shadowed by broader weaker %s)",
+		mv.Line, mv.Before, joinLines(mv.Shadowing))
+}
+
+func joinLines(lines []int) string {
+	parts := make([]string, len(lines))
+	for i, l := range lines {
+		parts[i] = fmt.Sprint(l)
+	}
+	noun := "line "
+	if len(lines) > 1 {
+		noun = "lines "
+	}
+	return noun + strings.Join(parts, ", ")
+}
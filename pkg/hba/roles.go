@@ -0,0 +1,108 @@
+package hba
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Roles — каталог ролей кластера: кто в какие роли входит.
+// Нужен для семантики samerole/samegroup и +group; без каталога роль
+// считается членом только самой себя (как is_member_of_role в PostgreSQL).
+type Roles struct {
+	MemberOf   map[string][]string // роль -> роли, в которые она входит напрямую
+	Superusers map[string]bool     // роли с атрибутом SUPERUSER (для утверждений политики)
+}
+
+// roleFile — формат файла каталога:
+//
+//	{"roles": {"alice": {"member_of": ["admins"]}, "admins": {}, "postgres": {"superuser": true}}}
+type roleFile struct {
+	Roles map[string]struct {
+		MemberOf  []string `json:"member_of"`
+		Superuser bool     `json:"superuser"`
+	} `json:"roles"`
+}
+
+// ParseRoles читает JSON-каталог ролей (например, выгрузку pg_auth_members).
+func ParseRoles(r io.Reader) (Roles, error) {
+	var f roleFile
+	if err := json.NewDecoder(r).Decode(&f); err != nil {
+		return Roles{}, err
+	}
+	roles := Roles{MemberOf: map[string][]string{}, Superusers: map[string]bool{}}
+	for name, v := range f.Roles {
+		name = strings.ToLower(name)
+		if v.Superuser {
+			roles.Superusers[name] = true
+		}
+		parents := roles.MemberOf[name]
+		for _, p := range v.MemberOf {
+			parents = append(parents, strings.ToLower(p))
+		}
+		roles.MemberOf[name] = parents
+	}
+	return roles, nil
+}
+
+// IsMember сообщает, входит ли user в role (транзитивно; роль — член самой себя).
+func (c Roles) IsMember(user, role string) bool {
+	user = strings.ToLower(user)
+	role = strings.ToLower(role)
+	if user == role {
+		return true
+	}
+	seen := map[string]bool{user: true}
+	queue := []string{user}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for _, p := range c.MemberOf[cur] {
+			if p == role {
+				return true
+			}
+			if !seen[p] {
+				seen[p] = true
+				queue = append(queue, p)
+			}
+		}
+	}
+	return false
+}
+
+// IsSuperuser сообщает, отмечена ли роль в каталоге как суперпользователь.
+// Атрибут не наследуется через членство, как и в PostgreSQL.
+func (c Roles) IsSuperuser(user string) bool {
+	return c.Superusers[strings.ToLower(user)]
+}
+
+// SuperuserNames — суперпользователи каталога по алфавиту.
+func (c Roles) SuperuserNames() []string {
+	out := make([]string, 0, len(c.Superusers))
+	for name := range c.Superusers {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Names возвращает все роли, известные каталогу (и как члены, и как группы).
+func (c Roles) Names() []string {
+	set := map[string]bool{}
+	for name, parents := range c.MemberOf {
+		set[name] = true
+		for _, p := range parents {
+			set[p] = true
+		}
+	}
+	for name := range c.Superusers {
+		set[name] = true
+	}
+	out := make([]string, 0, len(set))
+	for name := range set {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,448 @@
+package hba
+
+import (
+	"net"
+	"net/netip"
+	"sort"
+	"strings"
+)
+
+// Space — разбиение множества всех возможных подключений на классы
+// эквивалентности: внутри класса любое подключение совпадает ровно с одним и тем
+// же набором правил (каждого из переданных файлов), а значит получает тот же
+// результат первого совпадения. Классы строятся из самих правил:
+//   - адреса — интервалы между границами CIDR, сгруппированные по набору правил;
+//   - (БД, пользователь) — представители из principalSample, сгруппированные так же;
+//   - транспорт — local/ssl/gss/plain.
+//
+// Результат класса считается через Simulate на представителе, поэтому все
+// семантические анализы (матрица, эквивалентность, diff) опираются на то же
+// ядро сопоставления, что и трассировка.
+type Space struct {
+	Principals []PrincipalClass
+	Addrs      []AddrClass
+	roles      Roles
+}
+
+// PrincipalClass — набор пар (БД, пользователь) с одинаковым поведением.
+// Класс всегда прямоугольный: любые Databases × Users.
+type PrincipalClass struct {
+	Replication bool
+	Databases   []string // подписи для вывода, см. principalLabel
+	Users       []string
+	sampleDB    string
+	sampleUser  string
+}
+
+// AddrClass — область адресов (возможно, несвязная) с одинаковым поведением.
+type AddrClass struct {
+	Prefixes []netip.Prefix
+	sample   netip.Addr
+}
+
+// Cell — один класс эквивалентности: транспорт × (БД, пользователь) × адреса.
+// Addr == nil для local.
+type Cell struct {
+	Transport Transport
+	Principal *PrincipalClass
+	Addr      *AddrClass
+}
+
+// Transports — все транспорты в порядке вывода.
+var Transports = []Transport{TransportLocal, TransportSSL, TransportGSS, TransportPlain}
+
+// NewSpace строит общее разбиение для одного или нескольких наборов правил.
+// Для сравнения файлов разбиение обязано быть общим, иначе классы не сопоставить.
+func NewSpace(roles Roles, rulesets ...[]Rule) *Space {
+	var all []Rule
+	for _, rs := range rulesets {
+		all = append(all, rs...)
+	}
+	return &Space{
+		Principals: principalClasses(roles, all),
+		Addrs:      addrClasses(all),
+		roles:      roles,
+	}
+}
+
+// Cells перечисляет все классы: сначала local, затем TCP-транспорты по адресам.
+func (s *Space) Cells() []Cell {
+	var cells []Cell
+	for _, t := range Transports {
+		for i := range s.Principals {
+			if t == TransportLocal {
+				cells = append(cells, Cell{Transport: t, Principal: &s.Principals[i]})
+				continue
+			}
+			for k := range s.Addrs {
+				cells = append(cells, Cell{Transport: t, Principal: &s.Principals[i], Addr: &s.Addrs[k]})
+			}
+		}
+	}
+	return cells
+}
+
+// Sample возвращает конкретное подключение-представителя класса.
+func (c Cell) Sample() Connection {
+	conn := Connection{
+		Transport:   c.Transport,
+		Database:    c.Principal.sampleDB,
+		User:        c.Principal.sampleUser,
+		Replication: c.Principal.Replication,
+	}
+	if c.Addr != nil {
+		conn.Addr = net.IP(c.Addr.sample.AsSlice())
+	}
+	return conn
+}
+
+// AddrStrings — адреса класса в виде CIDR для вывода.
+func (a *AddrClass) AddrStrings() []string {
+	if a == nil {
+		return nil
+	}
+	out := make([]string, 0, len(a.Prefixes))
+	for _, p := range a.Prefixes {
+		out = append(out, p.String())
+	}
+	return out
+}
+
+// Outcome — результат первого совпадения для подключения.
+// Line=0 — ни одно правило не подошло (неявный reject).
+type Outcome struct {
+	File    string `json:"file,omitempty"` // включённый файл правила, см. Rule.File
+	Line    int    `json:"line"`
+	Method  string `json:"method"`
+	Options string `json:"options,omitempty"`
+}
+
+// Evaluate — Simulate, сведённый к результату: метод и опции выбранного правила.
+func Evaluate(rules []Rule, c Connection, roles Roles) Outcome {
+	r, ok := Simulate(rules, c, roles)
+	if !ok {
+		return Outcome{Method: "reject"}
+	}
+	return Outcome{File: r.File, Line: r.Line, Method: r.Method, Options: formatOptions(r.Opts)}
+}
+
+// Same сравнивает результаты по существу (метод и опции), без номера строки.
+func (o Outcome) Same(p Outcome) bool {
+	return o.Method == p.Method && o.Options == p.Options
+}
+
+// Accepts — подключение будет аутентифицироваться (а не отвергнуто сразу).
+func (o Outcome) Accepts() bool {
+	return o.Method != "reject"
+}
+
+// formatOptions печатает опции в каноническом виде (ключи по алфавиту).
+func formatOptions(opts map[string]string) string {
+	keys := make([]string, 0, len(opts))
+	for k := range opts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, k+"="+opts[k])
+	}
+	return strings.Join(parts, " ")
+}
+
+// principalClasses группирует представителей (БД, пользователь) по набору
+// совпадающих правил и режет группы на прямоугольники БД × пользователи.
+func principalClasses(roles Roles, rules []Rule) []PrincipalClass {
+	type group struct {
+		repl  bool
+		byUsr map[string][]string // пользователь -> БД
+	}
+	groups := map[string]*group{}
+	var order []string
+	for _, c := range principalConns(roles, rules...) {
+		sig := make([]byte, 0, len(rules)+1)
+		if c.Replication {
+			sig = append(sig, 'R')
+		} else {
+			sig = append(sig, 'D')
+		}
+		for _, r := range rules {
+			if r.matchPrincipal(c, roles) {
+				sig = append(sig, '1')
+			} else {
+				sig = append(sig, '0')
+			}
+		}
+		key := string(sig)
+		g, ok := groups[key]
+		if !ok {
+			g = &group{repl: c.Replication, byUsr: map[string][]string{}}
+			groups[key] = g
+			order = append(order, key)
+		}
+		g.byUsr[c.User] = append(g.byUsr[c.User], c.Database)
+	}
+
+	// «(same as user)» отличается от «(other)», только если какое-то правило
+	// связывает БД с пользователем; иначе не дробим классы зря
+	coupled := false
+	for _, r := range rules {
+		for _, tok := range r.DBs {
+			if tok == "sameuser" || tok == "samerole" || tok == "samegroup" {
+				coupled = true
+			}
+		}
+	}
+
+	var out []PrincipalClass
+	for _, key := range order {
+		g := groups[key]
+		// пользователи с одинаковым набором БД образуют прямоугольник;
+		// сравниваем по подписям, чтобы «(same as user)» не слился с «(other)»
+		users := make([]string, 0, len(g.byUsr))
+		for user := range g.byUsr {
+			users = append(users, user)
+		}
+		sort.Strings(users)
+		rects := map[string]*PrincipalClass{}
+		var rorder []string
+		for _, user := range users {
+			dbs := g.byUsr[user]
+			sort.Strings(dbs)
+			labels := make([]string, 0, len(dbs))
+			for _, db := range dbs {
+				labels = append(labels, principalLabel(db, user, g.repl, coupled))
+			}
+			labels = uniqueSorted(labels)
+			dkey := strings.Join(labels, "\x01")
+			pc, ok := rects[dkey]
+			if !ok {
+				pc = &PrincipalClass{Replication: g.repl, Databases: labels, sampleDB: dbs[0], sampleUser: user}
+				rects[dkey] = pc
+				rorder = append(rorder, dkey)
+			}
+			pc.Users = append(pc.Users, userLabel(user))
+		}
+		for _, dkey := range rorder {
+			pc := rects[dkey]
+			pc.Users = uniqueSorted(pc.Users)
+			out = append(out, *pc)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		if a.Replication != b.Replication {
+			return !a.Replication
+		}
+		if x, y := strings.Join(a.Databases, ","), strings.Join(b.Databases, ","); x != y {
+			return x < y
+		}
+		return strings.Join(a.Users, ",") < strings.Join(b.Users, ",")
+	})
+	return out
+}
+
+// principalLabel — подпись БД для вывода: синтетические имена превращаем
+// в «(other)» и, если БД связана с пользователем, в «(same as user)».
+func principalLabel(db, user string, repl, coupled bool) string {
+	if repl {
+		return "(replication)"
+	}
+	if strings.HasPrefix(db, "\x00") {
+		if coupled && db == user {
+			return "(same as user)"
+		}
+		return "(other)"
+	}
+	return db
+}
+
+// userLabel — подпись пользователя для вывода.
+func userLabel(user string) string {
+	if strings.HasPrefix(user, "\x00") {
+		return "(other)"
+	}
+	return user
+}
+
+func uniqueSorted(in []string) []string {
+	sort.Strings(in)
+	out := in[:0]
+	for i, v := range in {
+		if i == 0 || v != in[i-1] {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// addrClasses режет оба адресных пространства на интервалы по границам CIDR
+// из правил и склеивает интервалы с одинаковым набором совпадающих правил.
+func addrClasses(rules []Rule) []AddrClass {
+	var hosts []Rule
+	for _, r := range rules {
+		if r.IsHost() {
+			hosts = append(hosts, r)
+		}
+	}
+	var out []AddrClass
+	index := map[string]int{}
+	for _, bits := range []int{32, 128} {
+		for _, iv := range familyIntervals(hosts, bits) {
+			ip := net.IP(iv[0].AsSlice())
+			sig := make([]byte, len(hosts))
+			for i, r := range hosts {
+				sig[i] = '0'
+				if r.Addr.Contains(ip) {
+					sig[i] = '1'
+				}
+			}
+			k, ok := index[string(sig)]
+			if !ok {
+				k = len(out)
+				index[string(sig)] = k
+				out = append(out, AddrClass{sample: iv[0]})
+			}
+			out[k].Prefixes = append(out[k].Prefixes, rangePrefixes(iv[0], iv[1])...)
+		}
+	}
+	for k := range out {
+		out[k].sample = out[k].niceSample()
+	}
+	return out
+}
+
+// niceSample выбирает представителя, который читается в отчётах: документационный
+// адрес, если он в области, иначе адрес хоста, а не сети. Любой адрес класса
+// даёт тот же результат, так что выбор влияет только на вывод.
+func (a *AddrClass) niceSample() netip.Addr {
+	for _, doc := range []netip.Addr{docAddr4, docAddr6} {
+		for _, p := range a.Prefixes {
+			if p.Contains(doc) {
+				return doc
+			}
+		}
+	}
+	p := a.Prefixes[0]
+	if p.Bits() < p.Addr().BitLen()-1 {
+		return p.Addr().Next()
+	}
+	return p.Addr()
+}
+
+// familyIntervals возвращает интервалы [lo, hi] семейства (32 или 128 бит),
+// на которые границы сетей правил режут адресное пространство.
+func familyIntervals(rules []Rule, bits int) [][2]netip.Addr {
+	lo, hi := familyBounds(bits)
+	cuts := map[netip.Addr]bool{lo: true}
+	for _, r := range rules {
+		for _, n := range r.Addr.Networks {
+			p, ok := toPrefix(n)
+			if !ok || p.Addr().BitLen() != bits {
+				continue
+			}
+			cuts[p.Addr()] = true
+			if next := lastAddr(p).Next(); next.IsValid() {
+				cuts[next] = true
+			}
+		}
+	}
+	points := make([]netip.Addr, 0, len(cuts))
+	for a := range cuts {
+		points = append(points, a)
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].Less(points[j]) })
+	out := make([][2]netip.Addr, 0, len(points))
+	for i, p := range points {
+		end := hi
+		if i+1 < len(points) {
+			end = points[i+1].Prev()
+		}
+		out = append(out, [2]netip.Addr{p, end})
+	}
+	return out
+}
+
+func familyBounds(bits int) (netip.Addr, netip.Addr) {
+	if bits == 32 {
+		return netip.AddrFrom4([4]byte{}), netip.AddrFrom4([4]byte{255, 255, 255, 255})
+	}
+	var max [16]byte
+	for i := range max {
+		max[i] = 0xff
+	}
+	return netip.AddrFrom16([16]byte{}), netip.AddrFrom16(max)
+}
+
+// toPrefix переводит net.IPNet правила в нормализованный netip.Prefix.
+func toPrefix(n *net.IPNet) (netip.Prefix, bool) {
+	ip := n.IP
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+	}
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return netip.Prefix{}, false
+	}
+	ones, _ := n.Mask.Size()
+	return netip.PrefixFrom(addr, ones).Masked(), true
+}
+
+// lastAddr — последний адрес префикса.
+func lastAddr(p netip.Prefix) netip.Addr {
+	b := p.Masked().Addr().AsSlice()
+	for i := p.Bits(); i < len(b)*8; i++ {
+		b[i/8] |= 0x80 >> (i % 8)
+	}
+	a, _ := netip.AddrFromSlice(b)
+	return a
+}
+
+// rangePrefixes раскладывает интервал [lo, hi] в минимальный список CIDR.
+func rangePrefixes(lo, hi netip.Addr) []netip.Prefix {
+	var out []netip.Prefix
+	for lo.IsValid() && !hi.Less(lo) {
+		bits := lo.BitLen()
+		for ; bits >= 0; bits-- {
+			if bits < lo.BitLen() {
+				p := netip.PrefixFrom(lo, bits)
+				if p.Masked().Addr() != lo || hi.Less(lastAddr(p)) {
+					break
+				}
+			}
+		}
+		p := netip.PrefixFrom(lo, bits+1)
+		out = append(out, p)
+		lo = lastAddr(p).Next()
+	}
+	return out
+}
+
+// mergePrefixes сортирует префиксы и склеивает соседние и пересекающиеся
+// в минимальный список CIDR.
+func mergePrefixes(in []netip.Prefix) []netip.Prefix {
+	ivs := make([][2]netip.Addr, 0, len(in))
+	for _, p := range in {
+		ivs = append(ivs, [2]netip.Addr{p.Masked().Addr(), lastAddr(p)})
+	}
+	sort.Slice(ivs, func(i, j int) bool { return ivs[i][0].Less(ivs[j][0]) })
+	var merged [][2]netip.Addr
+	for _, iv := range ivs {
+		if n := len(merged); n > 0 {
+			last := &merged[n-1]
+			next := last[1].Next()
+			if last[0].BitLen() == iv[0].BitLen() && (!next.IsValid() || !next.Less(iv[0])) {
+				if last[1].Less(iv[1]) {
+					last[1] = iv[1]
+				}
+				continue
+			}
+		}
+		merged = append(merged, iv)
+	}
+	var out []netip.Prefix
+	for _, iv := range merged {
+		out = append(out, rangePrefixes(iv[0], iv[1])...)
+	}
+	return out
+}
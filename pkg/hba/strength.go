@@ -0,0 +1,154 @@
+package hba
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+// Strength — настраиваемая шкала силы аутентификации. Сила правила —
+// вес метода плюс надбавки за опции (clientcert=verify-full, ldaptls=1, ...)
+// и за тип подключения (hostssl, hostgssenc). Одна шкала используется и для
+// перекрытий (overlyBroadRule/shadowedByBroadRule), и для «не строже ли
+// опции верхнего правила», и для диффа доступа.
+type Strength struct {
+	Methods map[string]int `json:"methods,omitempty"` // метод -> вес
+	Options map[string]int `json:"options,omitempty"` // "ключ=значение" -> надбавка
+	Types   map[string]int `json:"types,omitempty"`   // тип правила -> надбавка
+}
+
+// DefaultStrength — шкала по умолчанию. trust слабее всего; пароли открытым
+// текстом слабее md5; ident по TCP подделывается клиентом, поэтому почти не
+// защищает; ldap/pam/radius без TLS передают пароль открыто; SCRAM и peer —
+// надёжная аутентификация; gss/sspi/cert — на основе ключей.
+func DefaultStrength() Strength {
+	return Strength{
+		Methods: map[string]int{
+			"trust":         0,
+			"ident":         5,
+			"password":      10,
+			"ldap":          15,
+			"pam":           15,
+			"radius":        15,
+			"bsd":           15,
+			"md5":           20,
+			"scram-sha-256": 40,
+			"peer":          40,
+			"gss":           50,
+			"sspi":          50,
+			"cert":          60,
+		},
+		Options: map[string]int{
+			"clientcert=verify-ca":   10,
+			"clientcert=verify-full": 15,
+			"ldaptls=1":              10,
+			"ldapscheme=ldaps":       10,
+		},
+		Types: map[string]int{
+			"hostssl":    5,
+			"hostgssenc": 5,
+		},
+	}
+}
+
+// ParseStrength читает переопределения шкалы из JSON и накладывает их на
+// DefaultStrength: указанные веса заменяются, остальные остаются.
+//
+//	{"methods": {"ldap": 30}, "options": {"clientcert=verify-ca": 20}}
+func ParseStrength(r io.Reader) (Strength, error) {
+	var over Strength
+	if err := json.NewDecoder(r).Decode(&over); err != nil {
+		return Strength{}, err
+	}
+	return DefaultStrength().With(over), nil
+}
+
+// With возвращает шкалу s с весами из over поверх.
+func (s Strength) With(over Strength) Strength {
+	merge := func(base, top map[string]int) map[string]int {
+		out := make(map[string]int, len(base)+len(top))
+		for k, v := range base {
+			out[k] = v
+		}
+		for k, v := range top {
+			out[strings.ToLower(k)] = v
+		}
+		return out
+	}
+	return Strength{
+		Methods: merge(s.Methods, over.Methods),
+		Options: merge(s.Options, over.Options),
+		Types:   merge(s.Types, over.Types),
+	}
+}
+
+// Of — сила правила. Неизвестный метод весит 0: лучше лишнее
+// предупреждение, чем пропущенное ослабление.
+func (s Strength) Of(r Rule) int {
+	return s.Methods[r.Method] + s.Types[r.Type] + s.optionsBonus(r.Opts)
+}
+
+// Weaker — правило a слабее b по шкале. reject сравнивается отдельно
+// (это не аутентификация), поэтому для него всегда false.
+func (s Strength) Weaker(a, b Rule) bool {
+	if a.Method == "reject" || b.Method == "reject" {
+		return false
+	}
+	return s.Of(a) < s.Of(b)
+}
+
+// weakerOutcome — то же для результатов симуляции (без типа правила:
+// у сравниваемых результатов транспорт один и тот же).
+func (s Strength) weakerOutcome(a, b Outcome) bool {
+	if !a.Accepts() || !b.Accepts() {
+		return false
+	}
+	ao := parseOptions(strings.Fields(a.Options))
+	bo := parseOptions(strings.Fields(b.Options))
+	return s.Methods[a.Method]+s.optionsBonus(ao) < s.Methods[b.Method]+s.optionsBonus(bo)
+}
+
+func (s Strength) optionsBonus(opts map[string]string) int {
+	bonus := 0
+	for k, v := range opts {
+		bonus += s.Options[k+"="+strings.ToLower(v)]
+	}
+	return bonus
+}
+
+// optsNotStricter — опции верхнего правила не строже нижнего: по шкале
+// надбавка за опции не больше, а опции вне шкалы (map=, ldapserver=, ...)
+// совпадают — иначе верхнее правило может отвергнуть то, что пустило бы нижнее.
+func (s Strength) optsNotStricter(upper, lower map[string]string) bool {
+	if s.optionsBonus(upper) > s.optionsBonus(lower) {
+		return false
+	}
+	for k, v := range upper {
+		if s.ranksOption(k) {
+			continue
+		}
+		if lv, ok := lower[k]; !ok || lv != v {
+			return false
+		}
+	}
+	return true
+}
+
+// ranksOption — ключ опции участвует в шкале (хотя бы одно значение имеет вес).
+func (s Strength) ranksOption(key string) bool {
+	prefix := key + "="
+	for k := range s.Options {
+		if strings.HasPrefix(k, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// strength — шкала из конфигурации или шкала по умолчанию.
+func (c Config) strength() Strength {
+	if c.Strength.Methods == nil {
+		return DefaultStrength()
+	}
+	return c.Strength
+}
@@ -0,0 +1,220 @@
+package hba
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Directive — комментарий-директива в pg_hba.conf:
+//
+//	host all all 10.0.0.0/8 md5  # hba-check:ignore md5Deprecated reason="legacy app"
+//	# hba-check:ignore localAllAll reason="single-tenant box"
+//	local all all peer
+//	# hba-check:disable wideAddress,allDbAllUser
+//	...
+//	# hba-check:enable
+//
+// ignore действует на строку с правилом, в которой записан, или на ближайшее
+// правило ниже (между ними допустимы только комментарии). disable действует
+// до enable с теми же кодами (enable без кодов закрывает всё) или до конца
+// файла. Без кодов директива относится ко всем кодам. Директива действует
+// только на находки своего файла (File, как у Rule).
+type Directive struct {
+	File   string   `json:"file,omitempty"`
+	Line   int      `json:"line"`
+	Kind   string   `json:"kind"` // ignore, disable, enable
+	Codes  []string `json:"codes,omitempty"`
+	Reason string   `json:"reason,omitempty"`
+	Target int      `json:"target,omitempty"` // для ignore — строка правила
+	end    map[string]int
+}
+
+const directivePrefix = "hba-check:"
+
+// ParseDirectives находит директивы в исходном тексте одного файла;
+// LoadDirectives — с включёнными файлами.
+func ParseDirectives(r io.Reader) ([]Directive, error) {
+	var out []Directive
+	var pending []int // ignore-директивы, ждущие правило ниже
+	var open []int    // незакрытые disable
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		raw := scanner.Text()
+		isRule := strings.TrimSpace(stripComment(raw)) != ""
+		comment := strings.TrimSpace(strings.TrimPrefix(inlineComment(raw), "#"))
+
+		if isRule {
+			for _, k := range pending {
+				out[k].Target = lineNo
+			}
+			pending = nil
+		} else if strings.TrimSpace(raw) == "" {
+			pending = nil
+		}
+		if !strings.HasPrefix(comment, directivePrefix) {
+			continue
+		}
+
+		d, err := parseDirective(lineNo, strings.TrimPrefix(comment, directivePrefix))
+		if err != nil {
+			return nil, err
+		}
+		switch d.Kind {
+		case "ignore":
+			if isRule {
+				d.Target = lineNo
+			} else {
+				pending = append(pending, len(out))
+			}
+		case "disable":
+			d.end = map[string]int{}
+			open = append(open, len(out))
+		case "enable":
+			open = closeDisables(out, open, d)
+		}
+		out = append(out, d)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func parseDirective(line int, text string) (Directive, error) {
+	d := Directive{Line: line}
+	if i := strings.Index(text, "reason="); i >= 0 {
+		reason := strings.TrimSpace(text[i+len("reason="):])
+		if strings.HasPrefix(reason, `"`) {
+			end := strings.Index(reason[1:], `"`)
+			if end < 0 {
+				return Directive{}, fmt.Errorf("line %d: unterminated reason", line)
+			}
+			reason = reason[1 : end+1]
+		}
+		d.Reason = reason
+		text = text[:i]
+	}
+	fields := strings.Fields(strings.ReplaceAll(text, ",", " "))
+	if len(fields) == 0 {
+		return Directive{}, fmt.Errorf("line %d: empty hba-check directive", line)
+	}
+	d.Kind = fields[0]
+	switch d.Kind {
+	case "ignore", "disable", "enable":
+	default:
+		return Directive{}, fmt.Errorf("line %d: unknown hba-check directive %q", line, d.Kind)
+	}
+	d.Codes = fields[1:]
+	return d, nil
+}
+
+// closeDisables закрывает открытые disable на строке enable: без кодов —
+// все, с кодами — только эти коды в disable с явным списком.
+func closeDisables(ds []Directive, open []int, enable Directive) []int {
+	var still []int
+	for _, k := range open {
+		d := &ds[k]
+		if len(enable.Codes) == 0 {
+			d.end["*"] = enable.Line
+			continue
+		}
+		if len(d.Codes) == 0 {
+			still = append(still, k)
+			continue
+		}
+		for _, c := range enable.Codes {
+			if containsToken(d.Codes, c) {
+				if _, done := d.end[c]; !done {
+					d.end[c] = enable.Line
+				}
+			}
+		}
+		if len(d.end) < len(d.Codes) {
+			still = append(still, k)
+		}
+	}
+	return still
+}
+
+// covers — директива подавляет находку.
+func (d Directive) covers(is Issue) bool {
+	if is.File != d.File {
+		return false
+	}
+	if len(d.Codes) > 0 && !containsToken(d.Codes, is.Code) {
+		return false
+	}
+	switch d.Kind {
+	case "ignore":
+		return d.Target != 0 && is.Line == d.Target
+	case "disable":
+		end, ok := d.end[is.Code]
+		if !ok {
+			end, ok = d.end["*"]
+		}
+		return is.Line > d.Line && (!ok || is.Line < end)
+	}
+	return false
+}
+
+var infoUnusedSuppression = CheckInfo{
+	Code: "unusedSuppression", Severity: SeverityWarn,
+	Description: "hba-check:ignore/disable comment that suppresses nothing.",
+	Rationale:   "Stale suppressions hide future findings on lines that were since fixed or moved.",
+	Remediation: "Remove the comment or fix its codes.",
+}
+
+// suppressionCheck только объявляет код unusedSuppression: сами находки
+// формирует Registry.Run после всех проверок, когда видно, что подавлено.
+type suppressionCheck struct{}
+
+func (suppressionCheck) Codes() []CheckInfo   { return []CheckInfo{infoUnusedSuppression} }
+func (suppressionCheck) Run(*Context) []Issue { return nil }
+
+// applySuppressions помечает подавленные находки (они остаются в списке с
+// Suppressed=true) и добавляет unusedSuppression для директив, которые ничего
+// не подавили или ссылаются на неизвестные коды. Директива только для
+// выключенных кодов неиспользуемой не считается.
+func applySuppressions(issues []Issue, ds []Directive, reg *Registry, enabled func(string) bool) []Issue {
+	used := make([]bool, len(ds))
+	for i := range issues {
+		for k, d := range ds {
+			if d.covers(issues[i]) {
+				issues[i].Suppressed = true
+				issues[i].SuppressReason = d.Reason
+				used[k] = true
+				break
+			}
+		}
+	}
+	for k, d := range ds {
+		if d.Kind == "enable" {
+			continue
+		}
+		live := len(d.Codes) == 0
+		for _, c := range d.Codes {
+			live = live || enabled(c)
+			if _, ok := reg.Lookup(c); !ok {
+				issues = append(issues, d.unused(fmt.Sprintf("Suppression refers to unknown check code %s.", c)))
+			}
+		}
+		switch {
+		case d.Kind == "ignore" && d.Target == 0:
+			issues = append(issues, d.unused("hba-check:ignore is not followed by a rule."))
+		case !used[k] && live:
+			issues = append(issues, d.unused(fmt.Sprintf("hba-check:%s no longer matches any finding.", d.Kind)))
+		}
+	}
+	return issues
+}
+
+// unused — находка unusedSuppression на строке директивы.
+func (d Directive) unused(message string) Issue {
+	is := infoUnusedSuppression.NewIssue(d.Line, message)
+	is.File = d.File
+	return is
+}
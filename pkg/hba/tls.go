@@ -0,0 +1,274 @@
+package hba
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+)
+
+var (
+	infoTLSProtocolWeak = CheckInfo{
+		Code: "tlsProtocolWeak", Severity: SeverityWarn,
+		Description: "ssl_min_protocol_version allows TLS older than 1.2 for hostssl rules.",
+		Rationale:   "TLS 1.0 and 1.1 are deprecated (RFC 8996); a downgraded client session protects the password and data poorly.",
+		Remediation: "Set ssl_min_protocol_version = 'TLSv1.2' (or TLSv1.3).",
+		DocsURL:     docsSSL,
+	}
+	infoTLSCiphersWeak = CheckInfo{
+		Code: "tlsCiphersWeak", Severity: SeverityWarn,
+		Description: "ssl_ciphers enables anonymous, NULL, export or otherwise weak cipher suites.",
+		Rationale:   "Weak suites let an attacker read or tamper with hostssl sessions; anonymous suites give no server authentication at all.",
+		Remediation: "Use the default 'HIGH:MEDIUM:+3DES:!aNULL' or a stricter list; never enable aNULL, eNULL, EXPORT, LOW, RC4, DES or MD5.",
+		DocsURL:     docsSSL,
+	}
+	infoTLSFileUnreadable = CheckInfo{
+		Code: "tlsFileUnreadable", Severity: SeverityError,
+		Description: "ssl_cert_file, ssl_key_file or ssl_ca_file is missing or is a directory.",
+		Rationale:   "With ssl=on the server refuses to start (or to reload TLS) without them, so hostssl rules give no access.",
+		Remediation: "Fix the path in postgresql.conf or install the file readable by the server.",
+		DocsURL:     docsSSL,
+	}
+	infoTLSKeyPermissions = CheckInfo{
+		Code: "tlsKeyPermissions", Severity: SeverityError,
+		Description: "ssl_key_file is accessible by group or others.",
+		Rationale:   "The server refuses a private key with such permissions; if it did not, other local users could read it.",
+		Remediation: "chmod 0600 the key (0640 is allowed only when it is owned by root).",
+		DocsURL:     docsSSL,
+	}
+	infoTLSCAMissing = CheckInfo{
+		Code: "tlsCAMissing", Severity: SeverityError,
+		Description: "Rule requires a client certificate but ssl_ca_file is not set.",
+		Rationale:   "Without trusted root certificates the server cannot verify any client certificate, so the rule rejects everyone.",
+		Remediation: "Set ssl_ca_file to the CA that issues client certificates.",
+		DocsURL:     docsCert,
+	}
+)
+
+// tlsProtocols — значения ssl_min_protocol_version по возрастанию; пустое
+// значение — любая версия.
+var tlsProtocols = []string{"", "tlsv1", "tlsv1.1", "tlsv1.2", "tlsv1.3"}
+
+// weakCipherTokens — элементы строки OpenSSL, которые включают небезопасные
+// наборы (в нижнем регистре).
+var weakCipherTokens = map[string]bool{
+	"null": true, "enull": true, "anull": true, "adh": true, "aecdh": true,
+	"export": true, "exp": true, "low": true, "rc4": true, "des": true, "md5": true,
+	"complementofall": true,
+}
+
+// WeakCiphers — элементы ssl_ciphers, добавляющие слабые наборы: anonymous,
+// NULL, export, LOW, RC4, DES, MD5, а также ALL без !aNULL. Элементы с
+// '!' или '-' исключают наборы, с '+' только переставляют их — такие не
+// считаются.
+func WeakCiphers(ciphers string) []string {
+	var out []string
+	fields := strings.FieldsFunc(ciphers, func(c rune) bool {
+		return c == ':' || c == ',' || c == ' '
+	})
+	anullRemoved := false
+	for _, f := range fields {
+		if strings.EqualFold(f, "!aNULL") || strings.EqualFold(f, "!ADH") {
+			anullRemoved = true
+		}
+	}
+	for _, f := range fields {
+		if f == "" || strings.ContainsAny(f[:1], "!-+") {
+			continue
+		}
+		for _, part := range strings.Split(strings.ToLower(f), "+") {
+			if weakCipherTokens[part] || part == "all" && !anullRemoved {
+				out = append(out, f)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// tlsDependents — hostssl-правила, которые что-то разрешают: только они
+// зависят от параметров TLS сервера.
+func tlsDependents(rules []Rule) []Rule {
+	var out []Rule
+	for _, r := range rules {
+		if r.Type == "hostssl" && r.Method != "reject" {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// requiresClientCert — правило проверяет сертификат клиента: метод cert
+// или clientcert со значением, отличным от отключающего.
+func requiresClientCert(r Rule) bool {
+	if r.Method == "cert" {
+		return true
+	}
+	v, ok := r.Opts["clientcert"]
+	if !ok {
+		return false
+	}
+	switch strings.ToLower(v) {
+	case "0", "no-verify":
+		return false
+	}
+	return true
+}
+
+// clientCertDependents — правила из deps, которым нужен ssl_ca_file.
+func clientCertDependents(deps []Rule) []Rule {
+	var out []Rule
+	for _, r := range deps {
+		if requiresClientCert(r) {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// dependentIssue — находка о параметре сервера, привязанная к первому
+// зависящему от него правилу; остальные правила — в Related.
+func dependentIssue(info CheckInfo, deps []Rule, message string) Issue {
+	is := info.NewIssue(deps[0].Line, message)
+	is.File = deps[0].File
+	hasFiles := false
+	for _, r := range deps[1:] {
+		is.Related = append(is.Related, r.Line)
+		is.RelatedFiles = append(is.RelatedFiles, r.File)
+		hasFiles = hasFiles || r.File != ""
+	}
+	if !hasFiles {
+		is.RelatedFiles = nil
+	}
+	return is
+}
+
+// dependents — «hostssl rule line 3 depends» / «hostssl rules line 3,
+// line 5 and 2 more depend» для сообщений.
+func dependents(deps []Rule, what string) string {
+	if len(deps) == 1 {
+		return fmt.Sprintf("%s rule %s depends", what, deps[0].ref())
+	}
+	refs := make([]string, 0, 3)
+	for _, r := range deps {
+		if len(refs) == cap(refs) {
+			break
+		}
+		refs = append(refs, r.ref())
+	}
+	list := strings.Join(refs, ", ")
+	if more := len(deps) - len(refs); more > 0 {
+		list += fmt.Sprintf(" and %d more", more)
+	}
+	return fmt.Sprintf("%s rules %s depend", what, list)
+}
+
+// tlsConfigCheck — параметры TLS из postgresql.conf, от которых зависят
+// hostssl-правила. Выполняется, только если postgresql.conf прочитан
+// (Config.Server) и ssl включён.
+type tlsConfigCheck struct{}
+
+func (tlsConfigCheck) Codes() []CheckInfo {
+	return []CheckInfo{infoTLSProtocolWeak, infoTLSCiphersWeak, infoTLSFileUnreadable, infoTLSKeyPermissions, infoTLSCAMissing}
+}
+
+func (tlsConfigCheck) Run(ctx *Context) []Issue {
+	server := ctx.Config.Server
+	if server == nil || !ctx.Config.SSLOn {
+		return nil
+	}
+	deps := tlsDependents(ctx.Rules)
+	if len(deps) == 0 {
+		return nil
+	}
+	var issues []Issue
+
+	proto := server.Get("ssl_min_protocol_version")
+	if proto.File == "" && ctx.Config.PGVersion > 0 && ctx.Config.PGVersion < 13 {
+		// до 13 по умолчанию разрешён TLSv1
+		proto.Value = "TLSv1"
+	}
+	level := -1
+	for i, p := range tlsProtocols {
+		if strings.EqualFold(proto.Value, p) {
+			level = i
+		}
+	}
+	if level < 3 {
+		issues = append(issues, dependentIssue(infoTLSProtocolWeak, deps, fmt.Sprintf(
+			"ssl_min_protocol_version = '%s' (%s) allows TLS older than 1.2; %s on it.",
+			proto.Value, proto.Origin(), dependents(deps, "hostssl"))))
+	}
+
+	// ssl_ciphers не действует на TLSv1.3
+	ciphers := server.Get("ssl_ciphers")
+	if weak := WeakCiphers(ciphers.Value); len(weak) > 0 && level < 4 {
+		issues = append(issues, dependentIssue(infoTLSCiphersWeak, deps, fmt.Sprintf(
+			"ssl_ciphers (%s) enables weak suites: %s; %s on it.",
+			ciphers.Origin(), strings.Join(weak, ", "), dependents(deps, "hostssl"))))
+	}
+
+	certDeps := clientCertDependents(deps)
+	files := []struct {
+		name string
+		deps []Rule
+		what string
+	}{
+		{"ssl_cert_file", deps, "hostssl"},
+		{"ssl_key_file", deps, "hostssl"},
+		{"ssl_ca_file", certDeps, "client certificate"},
+	}
+	for _, f := range files {
+		s := server.Get(f.name)
+		if len(f.deps) == 0 {
+			continue
+		}
+		if s.Value == "" && f.name != "ssl_ca_file" {
+			issues = append(issues, dependentIssue(infoTLSFileUnreadable, f.deps, fmt.Sprintf(
+				"%s is empty (%s); %s on it.", f.name, s.Origin(), dependents(f.deps, f.what))))
+			continue
+		}
+		if s.Value == "" {
+			issues = append(issues, dependentIssue(infoTLSCAMissing, f.deps, fmt.Sprintf(
+				"ssl_ca_file is not set (%s): client certificates cannot be verified; %s on it.",
+				s.Origin(), dependents(f.deps, f.what))))
+			continue
+		}
+		// читает файлы сервер, а не запускающий проверку пользователь: отказ
+		// в доступе ничего не говорит о сервере, ошибка — только нет файла
+		st, err := os.Stat(s.Value)
+		if os.IsNotExist(err) || err == nil && st.IsDir() {
+			problem := "is a directory"
+			if err != nil {
+				problem = "does not exist"
+			}
+			issues = append(issues, dependentIssue(infoTLSFileUnreadable, f.deps, fmt.Sprintf(
+				"%s %s (%s) %s; %s on it.",
+				f.name, s.Value, s.Origin(), problem, dependents(f.deps, f.what))))
+			continue
+		}
+		if err == nil && f.name == "ssl_key_file" && runtime.GOOS != "windows" {
+			if msg := keyPermissionProblem(st); msg != "" {
+				issues = append(issues, dependentIssue(infoTLSKeyPermissions, f.deps, fmt.Sprintf(
+					"ssl_key_file %s has mode %04o: %s; %s on it.",
+					s.Value, st.Mode().Perm(), msg, dependents(f.deps, f.what))))
+			}
+		}
+	}
+	return issues
+}
+
+// keyPermissionProblem повторяет проверку сервера: ключ, принадлежащий
+// root, может быть 0640, любой другой — только 0600.
+func keyPermissionProblem(st os.FileInfo) string {
+	mode := st.Mode().Perm()
+	if mode&0o037 != 0 {
+		return "group write/execute or any access for others is not allowed"
+	}
+	if mode&0o040 != 0 {
+		if root, known := ownedByRoot(st); known && !root {
+			return "group read is allowed only for keys owned by root"
+		}
+	}
+	return ""
+}
@@ -0,0 +1,94 @@
+package hba
+
+import (
+	"fmt"
+	"strings"
+)
+
+// StepStatus — итог проверки одного правила в трассировке.
+type StepStatus string
+
+const (
+	StepMatch    StepStatus = "match"    // правило подошло и выбрано
+	StepMismatch StepStatus = "mismatch" // правило не подошло
+	StepSkipped  StepStatus = "skipped"  // правило ниже выбранного, сервер его не смотрит
+)
+
+// TraceStep — результат сверки подключения с одной строкой pg_hba.
+type TraceStep struct {
+	File      string     `json:"file,omitempty"` // включённый файл правила, см. Rule.File
+	Line      int        `json:"line"`
+	Rule      string     `json:"rule"`
+	Status    StepStatus `json:"status"`
+	Criterion Criterion  `json:"criterion,omitempty"`
+	Reason    string     `json:"reason,omitempty"`
+}
+
+// Trace — полный путь вычисления: каждое правило по порядку и итог.
+// MatchedLine=0 означает неявный reject (ни одно правило не подошло).
+type Trace struct {
+	Connection  Connection  `json:"connection"`
+	Steps       []TraceStep `json:"steps"`
+	MatchedFile string      `json:"matched_file,omitempty"`
+	MatchedLine int         `json:"matched_line"`
+	Method      string      `json:"method"`
+}
+
+// TraceConnection проходит правила сверху вниз тем же ядром, что и Simulate,
+// и для каждого несовпавшего правила фиксирует первый не прошедший критерий.
+func TraceConnection(rules []Rule, c Connection, roles Roles) Trace {
+	t := Trace{Connection: c, Method: "reject"}
+	for _, r := range rules {
+		step := TraceStep{File: r.File, Line: r.Line, Rule: strings.Join(strings.Fields(stripComment(r.Raw)), " ")}
+		switch {
+		case t.MatchedLine != 0:
+			step.Status = StepSkipped
+			step.Reason = fmt.Sprintf("not evaluated: %s already matched",
+				Rule{File: t.MatchedFile, Line: t.MatchedLine}.ref())
+		default:
+			if crit := r.mismatch(c, roles); crit != "" {
+				step.Status = StepMismatch
+				step.Criterion = crit
+				step.Reason = r.explain(c, crit)
+			} else {
+				step.Status = StepMatch
+				t.MatchedFile, t.MatchedLine = r.File, r.Line
+				t.Method = r.Method
+			}
+		}
+		t.Steps = append(t.Steps, step)
+	}
+	return t
+}
+
+// String рендерит трассировку в текстовом виде для терминала.
+func (t Trace) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "connection: %s\n", t.Connection)
+	for _, s := range t.Steps {
+		pos := linePos(s.File, s.Line)
+		switch s.Status {
+		case StepMatch:
+			fmt.Fprintf(&b, "%s MATCH %s\n", pos, s.Rule)
+		case StepMismatch:
+			fmt.Fprintf(&b, "%s no    %s: %s: %s\n", pos, s.Rule, s.Criterion, s.Reason)
+		default:
+			fmt.Fprintf(&b, "%s skip  %s\n", pos, s.Rule)
+		}
+	}
+	if t.MatchedLine == 0 {
+		b.WriteString("result: no rule matched, implicit reject\n")
+	} else {
+		fmt.Fprintf(&b, "result: %s method=%s\n", linePos(t.MatchedFile, t.MatchedLine), t.Method)
+	}
+	return b.String()
+}
+
+// linePos — «line=N» или «file=F line=N» для правил из включённых файлов,
+// как в выводе основного режима.
+func linePos(file string, line int) string {
+	if file != "" {
+		return fmt.Sprintf("file=%s line=%d", file, line)
+	}
+	return fmt.Sprintf("line=%d", line)
+}
@@ -1,5 +1,7 @@
 package hba
 
+import "fmt"
+
 // Severity фиксирует уровень проблемы, чтобы CLI мог выйти с ошибкой на ERROR.
 type Severity string
 
@@ -12,16 +14,45 @@ const (
 // Issue — единичная найденная проблема/предупреждение по строке pg_hba.
 // Code без пробелов, чтобы удобно парсить/фильтровать в скриптах.
 type Issue struct {
-	Severity Severity // уровень: ERROR/WARN/INFO
-	Code     string   // машинно-читаемый код проблемы
-	Line     int      // номер строки в файле
-	Message  string   // человекочитаемое описание
+	Severity Severity `json:"severity"`          // уровень: ERROR/WARN/INFO
+	Code     string   `json:"code"`              // машинно-читаемый код проблемы
+	File     string   `json:"file,omitempty"`    // включённый файл (include); пусто — проверяемый файл
+	Line     int      `json:"line"`              // номер строки в файле
+	Message  string   `json:"message"`           // человекочитаемое описание
+	Related  []int    `json:"related,omitempty"` // строки других правил, участвующих в находке (перекрытия)
+	// RelatedFiles — файлы правил из Related (параллельно), если среди них
+	// есть правила из включённых файлов.
+	RelatedFiles []string    `json:"related_files,omitempty"`
+	Example      *Connection `json:"example,omitempty"` // подключение-доказательство для находок о перекрытии
+	// Suppressed — находка подавлена комментарием hba-check:ignore/disable;
+	// в текстовом выводе и коде выхода не учитывается.
+	Suppressed     bool   `json:"suppressed,omitempty"`
+	SuppressReason string `json:"suppress_reason,omitempty"`
+	// Baselined — находка записана в базовой линии (-baseline) как известная.
+	Baselined bool `json:"baselined,omitempty"`
+}
+
+// Hidden — находка подавлена или есть в базовой линии: в текстовый вывод
+// и код выхода она не попадает.
+func (is Issue) Hidden() bool {
+	return is.Suppressed || is.Baselined
+}
+
+// withExample прикрепляет подключение-доказательство и дописывает его в сообщение.
+func (is Issue) withExample(c *Connection) Issue {
+	if c == nil {
+		return is
+	}
+	is.Example = c
+	is.Message = fmt.Sprintf("%s Example: %s.", is.Message, c)
+	return is
 }
 
 // Rule — нормализованное представление строки pg_hba.conf
 // (без комментариев и пустых строк). Минимальный набор полей
 // для всех реализованных проверок.
 type Rule struct {
+	File   string            // включённый файл (LoadHBA); пусто — основной файл
 	Line   int               // номер строки в оригинальном файле
 	Raw    string            // исходная строка (для отладки)
 	Type   string            // type: local/host/hostssl/...
@@ -32,6 +63,15 @@ type Rule struct {
 	Opts   map[string]string // параметры auth-options
 }
 
+// ref — ссылка на правило в сообщениях: «line N», для включённого файла —
+// «line N of файл».
+func (r Rule) ref() string {
+	if r.File != "" {
+		return fmt.Sprintf("line %d of %s", r.Line, r.File)
+	}
+	return fmt.Sprintf("line %d", r.Line)
+}
+
 func (r Rule) HasDB(token string) bool {
 	return containsToken(r.DBs, token)
 }
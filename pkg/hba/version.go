@@ -0,0 +1,218 @@
+package hba
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Feature — возможность pg_hba.conf, доступная не во всех версиях PostgreSQL.
+// Since — первая мажорная версия с поддержкой (0 — всегда была), Removed —
+// первая версия без неё (0 — не удалена), Deprecated — версия, с которой
+// возможность объявлена устаревшей. Setting — булев параметр
+// postgresql.conf, без которого синтаксис значит другое (user@db — обычное
+// имя роли без db_user_namespace): такая возможность считается
+// использованной, только если параметр включён в ServerConfig.
+type Feature struct {
+	Name       string `json:"name"`
+	Since      int    `json:"since,omitempty"`
+	Removed    int    `json:"removed,omitempty"`
+	Deprecated int    `json:"deprecated,omitempty"`
+	Setting    string `json:"setting,omitempty"`
+	Hint       string `json:"hint"`
+	used       func(r Rule) bool
+}
+
+// Supported — возможность есть в версии v.
+func (f Feature) Supported(v int) bool {
+	return v >= f.Since && (f.Removed == 0 || v < f.Removed)
+}
+
+// Features — известные различия синтаксиса между версиями.
+var Features = []Feature{
+	{Name: "scram-sha-256 method", Since: 10, Hint: "use md5 on older servers",
+		used: func(r Rule) bool { return r.Method == "scram-sha-256" }},
+	{Name: "ldapscheme option", Since: 11, Hint: "use ldaptls=1 or ldapurl=ldaps://",
+		used: func(r Rule) bool { _, ok := r.Opts["ldapscheme"]; return ok }},
+	{Name: "hostgssenc/hostnogssenc rule types", Since: 12, Hint: "use host or hostssl",
+		used: func(r Rule) bool { return r.Type == "hostgssenc" || r.Type == "hostnogssenc" }},
+	{Name: "clientcert=verify-ca/verify-full", Since: 12, Hint: "use clientcert=1",
+		used: func(r Rule) bool {
+			v := strings.ToLower(optValue(r.Opts["clientcert"]))
+			return v == "verify-ca" || v == "verify-full"
+		}},
+	{Name: "clientcert=1/0/no-verify", Removed: 14, Hint: "use clientcert=verify-ca instead of 1; drop clientcert=0/no-verify",
+		used: func(r Rule) bool {
+			v := strings.ToLower(optValue(r.Opts["clientcert"]))
+			return v == "1" || v == "0" || v == "no-verify"
+		}},
+	{Name: "clientname option", Since: 14, Hint: "remove clientname (CN is matched)",
+		used: func(r Rule) bool { _, ok := r.Opts["clientname"]; return ok }},
+	{Name: "regular expressions in database/user", Since: 16, Hint: "list the names explicitly or use +group",
+		used: func(r Rule) bool { return r.hasRegex() }},
+	{Name: "include/include_if_exists/include_dir", Since: 16, Hint: "inline the included rules"},
+	{Name: "db_user_namespace user names (user@db)", Removed: 17, Setting: "db_user_namespace",
+		Hint: "rename roles and drop db_user_namespace from postgresql.conf",
+		used: func(r Rule) bool {
+			for _, tok := range r.Users {
+				if !isRegexToken(tok) && strings.Index(tok, "@") > 0 {
+					return true
+				}
+			}
+			return false
+		}},
+	{Name: "md5 method", Deprecated: 18, Hint: "migrate passwords to scram-sha-256",
+		used: func(r Rule) bool { return r.Method == "md5" }},
+}
+
+// includeFeature — запись Features для include-директив.
+func includeFeature() Feature {
+	for _, f := range Features {
+		if strings.HasPrefix(f.Name, "include") {
+			return f
+		}
+	}
+	return Feature{}
+}
+
+// ParseVersion разбирает мажорную версию: "16", "16.2", "9.6" (→ 9).
+func ParseVersion(s string) (int, error) {
+	major := strings.SplitN(strings.TrimSpace(s), ".", 2)[0]
+	v, err := strconv.Atoi(major)
+	if err != nil || v < 9 {
+		return 0, fmt.Errorf("invalid PostgreSQL version: %q", s)
+	}
+	return v, nil
+}
+
+// FeatureUse — использование возможности в строке файла.
+type FeatureUse struct {
+	File    string // включённый файл, см. Rule.File
+	Line    int
+	Feature Feature
+}
+
+// FeaturesUsed — все версионно-зависимые возможности по файлам (сначала
+// основной) и строкам.
+func FeaturesUsed(rules []Rule, includes []Include) []FeatureUse {
+	var out []FeatureUse
+	for _, r := range rules {
+		for _, f := range Features {
+			if f.used != nil && f.used(r) {
+				out = append(out, FeatureUse{File: r.File, Line: r.Line, Feature: f})
+			}
+		}
+	}
+	inc := includeFeature()
+	for _, in := range includes {
+		out = append(out, FeatureUse{File: in.File, Line: in.Line, Feature: inc})
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].File != out[j].File {
+			return out[i].File < out[j].File
+		}
+		return out[i].Line < out[j].Line
+	})
+	return out
+}
+
+// enabledBy — включён ли Setting возможности на сервере; known — есть
+// postgresql.conf, по которому это можно сказать. Возможности без Setting
+// всегда включены.
+func (f Feature) enabledBy(server *ServerConfig) (on, known bool) {
+	if f.Setting == "" {
+		return true, true
+	}
+	if server == nil {
+		return false, false
+	}
+	on, _ = parseConfBool(server.Get(f.Setting).Value)
+	return on, true
+}
+
+// unsupportedMessage — почему возможность недоступна в версии v.
+func (f Feature) unsupportedMessage(v int) string {
+	if v < f.Since {
+		return fmt.Sprintf("%s requires PostgreSQL %d+, target is %d; %s.", f.Name, f.Since, v, f.Hint)
+	}
+	return fmt.Sprintf("%s was removed in PostgreSQL %d, target is %d; %s.", f.Name, f.Removed, v, f.Hint)
+}
+
+var infoUnsupportedFeature = CheckInfo{
+	Code: "unsupportedFeature", Severity: SeverityError,
+	Description: "Syntax not supported by the target PostgreSQL version (-pg-version).",
+	Rationale:   "The server refuses to load pg_hba.conf with unknown syntax and keeps the old rules (or fails to start).",
+	Remediation: "Rewrite the line for the target version or raise the target.",
+	DocsURL:     docsHBA,
+}
+
+// versionCheck — возможности, которых нет в cfg.PGVersion (0 — версия не задана).
+type versionCheck struct{}
+
+func (versionCheck) Codes() []CheckInfo { return []CheckInfo{infoUnsupportedFeature} }
+
+func (versionCheck) Run(ctx *Context) []Issue {
+	v := ctx.Config.PGVersion
+	if v == 0 {
+		return nil
+	}
+	var issues []Issue
+	for _, u := range FeaturesUsed(ctx.Rules, ctx.Config.Includes) {
+		if on, _ := u.Feature.enabledBy(ctx.Config.Server); !on {
+			continue
+		}
+		if !u.Feature.Supported(v) {
+			is := infoUnsupportedFeature.NewIssue(u.Line, u.Feature.unsupportedMessage(v))
+			is.File = u.File
+			issues = append(issues, is)
+		}
+	}
+	return issues
+}
+
+// UpgradeItem — что нужно поменять в строке при переходе между версиями.
+// Required — без изменения файл не загрузится на новой версии; иначе —
+// рекомендация (возможность устарела).
+type UpgradeItem struct {
+	File     string `json:"file,omitempty"`
+	Line     int    `json:"line"`
+	Feature  string `json:"feature"`
+	Message  string `json:"message"`
+	Required bool   `json:"required"`
+}
+
+// UpgradeReport перечисляет изменения, нужные для переноса файла с версии
+// from на версию to (в обе стороны): возможности, которые перестают
+// поддерживаться, и те, что становятся устаревшими. Возможности, зависящие
+// от параметра сервера (Feature.Setting), без postgresql.conf не проверить —
+// о них только рекомендация.
+func UpgradeReport(rules []Rule, includes []Include, from, to int) []UpgradeItem {
+	var out []UpgradeItem
+	for _, u := range FeaturesUsed(rules, includes) {
+		f := u.Feature
+		switch {
+		case f.Setting != "" && !f.Supported(to):
+			out = append(out, UpgradeItem{File: u.File, Line: u.Line, Feature: f.Name,
+				Message: fmt.Sprintf("if %s is on, %s", f.Setting, f.unsupportedMessage(to))})
+		case !f.Supported(to):
+			out = append(out, UpgradeItem{File: u.File, Line: u.Line, Feature: f.Name, Required: true,
+				Message: f.unsupportedMessage(to)})
+		case f.Deprecated != 0 && from < f.Deprecated && to >= f.Deprecated:
+			out = append(out, UpgradeItem{File: u.File, Line: u.Line, Feature: f.Name,
+				Message: fmt.Sprintf("%s is deprecated since PostgreSQL %d; %s.", f.Name, f.Deprecated, f.Hint)})
+		}
+	}
+	return out
+}
+
+func (it UpgradeItem) String() string {
+	kind := "advisory"
+	if it.Required {
+		kind = "required"
+	}
+	if it.File != "" {
+		return fmt.Sprintf("%s: line %d: %s: %s", it.File, it.Line, kind, it.Message)
+	}
+	return fmt.Sprintf("line %d: %s: %s", it.Line, kind, it.Message)
+}
@@ -0,0 +1,104 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+
+	"go_hba_rules/pkg/hba"
+)
+
+const assertPolicy = `{"assertions": [
+  {"name": "replication only for repl from 10.10.10.0/28", "match": {"replication": true}, "allow": {"users": ["repl"], "addresses": ["10.10.10.0/28"]}},
+  {"name": "superusers never over the network", "match": {"superuser": true, "transports": ["ssl", "gss", "plain"]}, "deny": true},
+  {"name": "billing only via hostssl + cert", "match": {"databases": ["billing"]}, "allow": {"transports": ["ssl"], "methods": ["cert"]}}
+]}`
+
+func TestPolicyAssertions(t *testing.T) {
+	policy, err := hba.ParsePolicy(strings.NewReader(assertPolicy), hba.DefaultRegistry)
+	if err != nil {
+		t.Fatalf("parse policy: %v", err)
+	}
+	roles, err := hba.ParseRoles(strings.NewReader(`{"roles": {"postgres": {"superuser": true}, "repl": {}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	check := func(input string) []hba.Issue {
+		cfg := hba.Config{SSLOn: true, Roles: roles, Enable: []string{"policyViolation"}}
+		policy.For("pg_hba.conf").Apply(&cfg)
+		return hba.CheckAll(parseRules(t, input), cfg)
+	}
+
+	compliant := `host all postgres all reject
+host replication repl 10.10.10.0/28 scram-sha-256
+hostssl billing all 10.0.0.0/8 cert
+host billing all all reject
+host all all 10.0.0.0/8 scram-sha-256
+`
+	if issues := check(compliant); len(issues) != 0 {
+		t.Fatalf("compliant file must pass: %v", issues)
+	}
+
+	// текстово "безобидные" правила, нарушающие утверждения по семантике
+	issues := check(`host replication all 10.10.10.0/24 scram-sha-256
+host all +postgres 10.0.0.0/8 scram-sha-256
+hostssl all all 10.0.0.0/8 cert
+host all all 10.0.0.0/8 scram-sha-256
+`)
+	for _, want := range []struct {
+		line int
+		name string
+	}{
+		{1, "replication only for repl"},
+		{2, "superusers never over the network"},
+		{4, "billing only via hostssl + cert"},
+	} {
+		found := false
+		for _, is := range issues {
+			if is.Code == "policyViolation" && is.Line == want.line && strings.Contains(is.Message, want.name) && is.Example != nil {
+				found = true
+			}
+		}
+		if !found {
+			t.Fatalf("expected violation of %q at line %d: %v", want.name, want.line, issues)
+		}
+	}
+	if hasCodeAt(issues, "policyViolation", 3) {
+		t.Fatalf("hostssl cert for billing is allowed: %v", issues)
+	}
+}
+
+func TestPolicyAssertionValidation(t *testing.T) {
+	for _, bad := range []string{
+		`{"assertions": [{"match": {}, "deny": true}]}`,
+		`{"assertions": [{"name": "x", "match": {}}]}`,
+		`{"assertions": [{"name": "x", "match": {"addresses": ["nope"]}, "deny": true}]}`,
+		`{"assertions": [{"name": "x", "match": {"transports": ["tcp"]}, "deny": true}]}`,
+	} {
+		if _, err := hba.ParsePolicy(strings.NewReader(bad), hba.DefaultRegistry); err == nil {
+			t.Fatalf("expected error for %s", bad)
+		}
+	}
+}
+
+func TestSuperuserAssertionNeedsCatalog(t *testing.T) {
+	policy, err := hba.ParsePolicy(strings.NewReader(assertPolicy), hba.DefaultRegistry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// без каталога ролей суперпользователей нет: утверждение не должно проходить молча
+	cfg := hba.Config{SSLOn: true, Enable: []string{"policyViolation"}}
+	policy.For("pg_hba.conf").Apply(&cfg)
+	if err := cfg.Assertions[1].CheckRoles(cfg.Roles); err == nil {
+		t.Fatal("superuser assertion without a catalog must be rejected")
+	}
+	issues := hba.CheckAll(parseRules(t, "host all all 0.0.0.0/0 trust\n"), cfg)
+	found := false
+	for _, is := range issues {
+		if is.Code == "policyViolation" && is.Line == 0 && strings.Contains(is.Message, "cannot be checked") {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("expected an unverifiable assertion issue: %v", issues)
+	}
+}
@@ -0,0 +1,62 @@
+package tests
+
+import (
+	"bytes"
+	"testing"
+
+	"go_hba_rules/pkg/hba"
+)
+
+const legacyHBA = `host all all 0.0.0.0/0 trust
+host app app 10.0.0.0/24 md5
+`
+
+func TestBaselineSurvivesLineShift(t *testing.T) {
+	cfg := hba.Config{SSLOn: true}
+	rules := parseRules(t, legacyHBA)
+	var buf bytes.Buffer
+	if err := hba.NewBaseline(hba.CheckAll(rules, cfg), rules).Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	baseline, err := hba.ParseBaseline(&buf)
+	if err != nil {
+		t.Fatalf("parse baseline: %v", err)
+	}
+
+	// вставка строк сверху сдвигает номера, но не отпечатки
+	shifted := parseRules(t, "# header\nlocal db9 u9 scram-sha-256\n\n"+legacyHBA+"local new new md5\n")
+	issues := hba.CheckAll(shifted, cfg)
+	if stale := baseline.Apply(issues, shifted); len(stale) != 0 {
+		t.Fatalf("no baseline entry should go stale: %v", stale)
+	}
+	for _, is := range issues {
+		switch {
+		case is.Line == 4 || is.Line == 5:
+			if !is.Baselined {
+				t.Fatalf("known issue must be baselined: %+v", is)
+			}
+		case is.Line == 6:
+			if is.Baselined {
+				t.Fatalf("new rule must not be baselined: %+v", is)
+			}
+		}
+	}
+	if !hasCodeAt(issues, "md5Deprecated", 6) {
+		t.Fatalf("expected new md5Deprecated at line 6: %v", issues)
+	}
+}
+
+func TestBaselineReportsFixedIssues(t *testing.T) {
+	rules := parseRules(t, legacyHBA)
+	baseline := hba.NewBaseline(hba.CheckAll(rules, hba.Config{SSLOn: true}), rules)
+
+	fixed := parseRules(t, "host all all 0.0.0.0/0 trust\nhost app app 10.0.0.0/24 scram-sha-256\n")
+	stale := baseline.Apply(hba.CheckAll(fixed, hba.Config{SSLOn: true}), fixed)
+	found := false
+	for _, e := range stale {
+		found = found || (e.Code == "md5Deprecated" && e.Rule == "host app app 10.0.0.0/24 md5")
+	}
+	if !found {
+		t.Fatalf("fixed md5Deprecated must be reported stale: %v", stale)
+	}
+}
@@ -0,0 +1,90 @@
+package tests
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"go_hba_rules/pkg/hba"
+)
+
+func gapClasses(gaps []hba.CatchAllGap) []hba.ConnClass {
+	var out []hba.ConnClass
+	for _, g := range gaps {
+		out = append(out, g.Class)
+	}
+	return out
+}
+
+func TestCatchAllGaps(t *testing.T) {
+	cases := []struct {
+		name  string
+		input string
+		want  []hba.ConnClass
+	}{
+		{"empty file", ``, []hba.ConnClass{hba.ClassLocal, hba.ClassIPv4, hba.ClassIPv6, hba.ClassReplication}},
+		{"ipv4 only", `local all all peer
+host all all 0.0.0.0/0 reject
+`, []hba.ConnClass{hba.ClassIPv6, hba.ClassReplication}},
+		{"hostssl reject leaves plain open", `local all all peer
+hostssl all all 0.0.0.0/0 reject
+host all all ::/0 reject
+`, []hba.ConnClass{hba.ClassIPv4, hba.ClassReplication}},
+		{"accepting rules close classes too", `local all all peer
+local replication all reject
+host all all all scram-sha-256
+host replication all all reject
+`, nil},
+		{"local replication only", `local all all peer
+host all all all reject
+host replication all all reject
+`, []hba.ConnClass{hba.ClassReplication}},
+	}
+	for _, tc := range cases {
+		gaps := hba.CatchAllGaps(parseRules(t, tc.input), hba.Roles{})
+		if got := gapClasses(gaps); !reflect.DeepEqual(got, tc.want) {
+			t.Fatalf("%s: classes %v, want %v", tc.name, got, tc.want)
+		}
+		for _, g := range gaps {
+			if len(g.Fix) == 0 {
+				t.Fatalf("%s: %s gap without fix", tc.name, g.Class)
+			}
+		}
+	}
+
+	gaps := hba.CatchAllGaps(parseRules(t, "local all all peer\nhost all all all reject\nhost replication all all reject\n"), hba.Roles{})
+	if want := []string{"local replication all reject"}; !reflect.DeepEqual(gaps[0].Fix, want) {
+		t.Fatalf("replication fix %v, want %v", gaps[0].Fix, want)
+	}
+	if !gaps[0].Example.Replication || gaps[0].Example.Transport != hba.TransportLocal {
+		t.Fatalf("example must be a local replication connection: %+v", gaps[0].Example)
+	}
+
+	// на больших файлах анализ не строит полное разбиение
+	big := hba.CatchAllGaps(syntheticTenants(5000), hba.Roles{})
+	if got := gapClasses(big); !reflect.DeepEqual(got, []hba.ConnClass{hba.ClassLocal, hba.ClassReplication}) {
+		t.Fatalf("synthetic tenants: classes %v", got)
+	}
+}
+
+func TestMissingCatchAllRejectCheck(t *testing.T) {
+	f, err := os.Open("../testdata/prod_strict.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rules, err := hba.ParseHBA(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found []hba.Issue
+	for _, is := range hba.CheckAll(rules, hba.Config{SSLOn: true}) {
+		if is.Code == "missingCatchAllReject" {
+			found = append(found, is)
+		}
+	}
+	// IPv4 и IPv6 закрыты, репликация — нет
+	if len(found) != 1 || found[0].Line != 0 || found[0].Example == nil || !found[0].Example.Replication {
+		t.Fatalf("expected one replication finding for prod_strict.conf: %+v", found)
+	}
+}
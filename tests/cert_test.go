@@ -0,0 +1,202 @@
+package tests
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go_hba_rules/pkg/hba"
+)
+
+var certNow = time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  crypto.Signer
+	pem  string
+}
+
+// issue выпускает сертификат; parent == nil — самоподписанный.
+func issue(t *testing.T, tmpl *x509.Certificate, key crypto.Signer, parent *testCert) testCert {
+	t.Helper()
+	if key == nil {
+		k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key = k
+	}
+	tmpl.SerialNumber = big.NewInt(time.Now().UnixNano())
+	if tmpl.NotBefore.IsZero() {
+		tmpl.NotBefore = certNow.AddDate(-1, 0, 0)
+	}
+	if tmpl.NotAfter.IsZero() {
+		tmpl.NotAfter = certNow.AddDate(1, 0, 0)
+	}
+	signer, parentCert := key, tmpl
+	if parent != nil {
+		signer, parentCert = parent.key, parent.cert
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parentCert, key.Public(), signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testCert{c, key, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))}
+}
+
+func caTemplate(cn string) *x509.Certificate {
+	return &x509.Certificate{Subject: pkix.Name{CommonName: cn}, IsCA: true, BasicConstraintsValid: true,
+		KeyUsage: x509.KeyUsageCertSign}
+}
+
+func certIssues(t *testing.T, root string, files map[string]string, cfg hba.Config, hbaText string) map[string][]hba.Issue {
+	t.Helper()
+	files["postgresql.conf"] = "ssl = on\nssl_ca_file = 'root.crt'\n"
+	writeFiles(t, root, files)
+	if err := os.Chmod(filepath.Join(root, "server.key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	server, err := hba.LoadPGConf(filepath.Join(root, "postgresql.conf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Apply(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	cfg.Now = certNow
+	out := map[string][]hba.Issue{}
+	for _, is := range hba.CheckAll(parseRules(t, hbaText), cfg) {
+		if strings.HasPrefix(is.Code, "cert") {
+			out[is.Code] = append(out[is.Code], is)
+		}
+	}
+	return out
+}
+
+func TestCertificateChecks(t *testing.T) {
+	rootCA := issue(t, caTemplate("Root CA"), nil, nil)
+	inter := issue(t, caTemplate("Intermediate CA"), nil, &rootCA)
+	leaf := issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "db"},
+		DNSNames: []string{"db.example.com"}, IPAddresses: []net.IP{net.ParseIP("10.0.0.5")},
+		NotAfter: certNow.AddDate(0, 0, 10)}, nil, &inter)
+	weakKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCA := issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "Client CA"}, IsCA: true,
+		BasicConstraintsValid: true, KeyUsage: x509.KeyUsageCertSign, NotAfter: certNow.AddDate(0, 0, -1)}, weakKey, nil)
+
+	hbaText := `hostssl all app 10.0.1.0/24 scram-sha-256
+hostssl all ops 10.0.2.0/24 cert
+host all all 0.0.0.0/0 reject
+`
+	// в ssl_cert_file только лист: издатель может быть и корнем клиентов,
+	// и забытым промежуточным CA
+	issues := certIssues(t, t.TempDir(), map[string]string{
+		"server.crt": leaf.pem, "server.key": "key", "root.crt": rootCA.pem + clientCA.pem,
+	}, hba.Config{ServerHostname: "db.example.org"}, hbaText)
+	want := map[string]int{"certExpiring": 1, "certExpired": 2, "certWeakKey": 2, "certChainUnverified": 1, "certHostnameMismatch": 1}
+	if len(issues) != len(want) {
+		t.Fatalf("issues: %+v", issues)
+	}
+	for code, line := range want {
+		if len(issues[code]) != 1 || issues[code][0].Line != line {
+			t.Fatalf("%s must be reported once at line %d: %+v", code, line, issues[code])
+		}
+	}
+	// сертификат сервера нужен обоим hostssl-правилам, CA — только правилу с cert
+	if is := issues["certExpiring"][0]; len(is.Related) != 1 || is.Related[0] != 2 || !strings.Contains(is.Message, "in 10 days") {
+		t.Fatalf("certExpiring: %+v", is)
+	}
+	if is := issues["certExpired"][0]; is.Related != nil || !strings.Contains(is.Message, "CN=Client CA") {
+		t.Fatalf("certExpired: %+v", is)
+	}
+	if is := issues["certChainUnverified"][0]; is.Severity != hba.SeverityInfo || !strings.Contains(is.Message, "Intermediate CA") {
+		t.Fatalf("missing issuer must be named: %+v", is)
+	}
+
+	// полная цепочка (до промежуточного CA и до корня), имя из SAN, окно
+	// предупреждения короче срока
+	for _, serverCrt := range []string{leaf.pem + inter.pem, leaf.pem + inter.pem + rootCA.pem} {
+		issues = certIssues(t, t.TempDir(), map[string]string{
+			"server.crt": serverCrt, "server.key": "key", "root.crt": rootCA.pem,
+		}, hba.Config{ServerHostname: "10.0.0.5", CertExpiryDays: 7}, hbaText)
+		if len(issues) != 0 {
+			t.Fatalf("valid chain: %+v", issues)
+		}
+	}
+
+	// ssl_ca_file (CA клиентов) не достраивает цепочку сервера
+	issues = certIssues(t, t.TempDir(), map[string]string{
+		"server.crt": leaf.pem, "server.key": "key", "root.crt": inter.pem,
+	}, hba.Config{CertExpiryDays: 7}, hbaText)
+	if len(issues["certChainUnverified"]) != 1 || len(issues) != 1 {
+		t.Fatalf("ssl_ca_file must not complete the server chain: %+v", issues)
+	}
+
+	// лист и корень без промежуточного CA — звена точно не хватает
+	issues = certIssues(t, t.TempDir(), map[string]string{
+		"server.crt": leaf.pem + rootCA.pem, "server.key": "key", "root.crt": rootCA.pem,
+	}, hba.Config{CertExpiryDays: 7}, hbaText)
+	if is := issues["certChainIncomplete"]; len(is) != 1 || len(issues) != 1 || is[0].Severity != hba.SeverityError {
+		t.Fatalf("certChainIncomplete: %+v", issues)
+	}
+
+	// без правил с сертификатом клиента ssl_ca_file не читается
+	issues = certIssues(t, t.TempDir(), map[string]string{
+		"server.crt": leaf.pem + inter.pem, "server.key": "key", "root.crt": clientCA.pem,
+	}, hba.Config{CertExpiryDays: 7}, "hostssl all app 10.0.1.0/24 scram-sha-256\n")
+	if len(issues) != 0 {
+		t.Fatalf("ssl_ca_file without clientcert rules: %+v", issues)
+	}
+
+	// файл без сертификатов
+	issues = certIssues(t, t.TempDir(), map[string]string{
+		"server.crt": "not a certificate\n", "server.key": "key", "root.crt": rootCA.pem,
+	}, hba.Config{}, hbaText)
+	if len(issues["certInvalid"]) != 1 || len(issues) != 1 {
+		t.Fatalf("certInvalid: %+v", issues)
+	}
+}
+
+func TestCertificateSignedByPrivateRoot(t *testing.T) {
+	// обычная схема PostgreSQL: лист подписан частным корнем, в ssl_cert_file
+	// только лист, корень у клиентов в root.crt — ошибки нет
+	rootCA := issue(t, caTemplate("Private Root CA"), nil, nil)
+	leaf := issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "db"}, DNSNames: []string{"db.example.com"}}, nil, &rootCA)
+	issues := certIssues(t, t.TempDir(), map[string]string{
+		"server.crt": leaf.pem, "server.key": "key", "root.crt": rootCA.pem,
+	}, hba.Config{ServerHostname: "db.example.com"}, "hostssl all app 10.0.1.0/24 scram-sha-256\n")
+	if len(issues) != 1 || len(issues["certChainUnverified"]) != 1 || issues["certChainUnverified"][0].Severity != hba.SeverityInfo {
+		t.Fatalf("leaf signed by a private root: %+v", issues)
+	}
+}
+
+func TestCertificateHostnameFromCN(t *testing.T) {
+	// без DNS-имён в SAN libpq сравнивает CN, в том числе с «*.»
+	wildcard := issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "*.example.com"}}, nil, nil)
+	for host, ok := range map[string]bool{"db.example.com": true, "a.b.example.com": false, "example.com": false} {
+		issues := certIssues(t, t.TempDir(), map[string]string{
+			"server.crt": wildcard.pem, "server.key": "key", "root.crt": wildcard.pem,
+		}, hba.Config{ServerHostname: host}, "hostssl all app 10.0.1.0/24 scram-sha-256\n")
+		if got := len(issues["certHostnameMismatch"]) == 0; got != ok {
+			t.Fatalf("%s: match=%v, want %v: %+v", host, got, ok, issues)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package tests
+
+import (
+	"testing"
+
+	"go_hba_rules/pkg/hba"
+)
+
+func TestCleartextMethods(t *testing.T) {
+	for _, m := range []string{"password", "ldap", "pam", "radius", "bsd"} {
+		if !hba.CleartextMethod(m) {
+			t.Fatalf("%s sends the cleartext password", m)
+		}
+	}
+	for _, m := range []string{"scram-sha-256", "md5", "cert", "gss", "peer", "trust"} {
+		if hba.CleartextMethod(m) {
+			t.Fatalf("%s does not send the cleartext password", m)
+		}
+	}
+
+	rules := parseRules(t, `host all all 10.0.0.0/24 ldap ldapserver=ldap ldapbasedn=dc=x ldaptls=1
+hostnossl all all 10.0.0.0/24 pam
+host all all 10.0.0.0/24 radius radiusservers=r radiussecrets=s
+hostssl all all 10.0.0.0/24 bsd
+hostgssenc all all 10.0.0.0/24 pam
+local all all pam
+`)
+	on := hba.CheckAll(rules, hba.Config{SSLOn: true})
+	for _, line := range []int{1, 2, 3} {
+		if !hasCodeAt(on, "passwordNoTLS", line) {
+			t.Fatalf("line %d: expected passwordNoTLS: %v", line, on)
+		}
+	}
+	for _, line := range []int{4, 5, 6} {
+		if hasCodeAt(on, "passwordNoTLS", line) || hasCodeAt(on, "passwordWithTLS", line) {
+			t.Fatalf("line %d: encrypted or local path must not be flagged: %v", line, on)
+		}
+	}
+
+	off := hba.CheckAll(rules, hba.Config{SSLOn: false})
+	if !hasCodeAt(off, "passwordNoSSL", 3) || hasCodeAt(off, "passwordNoSSL", 6) {
+		t.Fatalf("ssl=off: expected passwordNoSSL for network radius only: %v", off)
+	}
+}
+
+func TestLDAPNoTLS(t *testing.T) {
+	issues := hba.CheckAll(parseRules(t, `hostssl all all 10.0.0.0/24 ldap ldapserver=ldap ldapbasedn=dc=x
+hostssl all all 10.0.0.0/24 ldap ldapserver=ldap ldapbasedn=dc=x ldaptls=1
+hostssl all all 10.0.0.0/24 ldap ldapserver=ldap ldapbasedn=dc=x ldapscheme=ldaps
+hostssl all all 10.0.0.0/24 ldap ldapurl="ldaps://ldap/dc=x?uid"
+hostssl all all 10.0.0.0/24 ldap ldapurl="ldap://ldap/dc=x?uid"
+`), hba.Config{SSLOn: true, Enable: []string{"ldapNoTLS"}})
+	for line, want := range map[int]bool{1: true, 2: false, 3: false, 4: false, 5: true} {
+		if hasCodeAt(issues, "ldapNoTLS", line) != want {
+			t.Fatalf("line %d: ldapNoTLS expected %v: %v", line, want, issues)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package tests
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"go_hba_rules/pkg/hba"
+)
+
+func TestDiffAccessClassifiesChanges(t *testing.T) {
+	old := parseRules(t, `hostssl billing app 10.2.0.0/16 scram-sha-256
+hostssl reports bob 10.3.0.0/16 md5
+host all all 0.0.0.0/0 reject
+`)
+	changed := parseRules(t, `hostssl billing app 10.2.0.0/16 trust
+hostssl reports carol 10.4.0.0/16 scram-sha-256
+host all all 0.0.0.0/0 reject
+`)
+	diff := hba.DiffAccess(old, changed, hba.Roles{})
+	if !diff.Broadens {
+		t.Fatalf("expected broadening diff")
+	}
+
+	kinds := map[string]hba.AccessChange{}
+	for _, r := range diff.Regions {
+		for _, c := range r.Changes {
+			if c.Transport != hba.TransportSSL {
+				continue
+			}
+			kinds[r.Region+" "+string(c.Kind)] = c
+		}
+	}
+	if c, ok := kinds["10.2.0.0/16 changed"]; !ok || !c.Broadens || c.Old.Method != "scram-sha-256" || c.New.Method != "trust" {
+		t.Fatalf("expected scram->trust change for 10.2.0.0/16, got %+v", kinds)
+	}
+	if c, ok := kinds["10.3.0.0/16 lost"]; !ok || c.Broadens || c.Example.User != "bob" {
+		t.Fatalf("expected bob to lose access from 10.3.0.0/16, got %+v", kinds)
+	}
+	if c, ok := kinds["10.4.0.0/16 gained"]; !ok || !c.Broadens || c.Example.User != "carol" {
+		t.Fatalf("expected carol to gain access from 10.4.0.0/16, got %+v", kinds)
+	}
+}
+
+func TestDiffAccessNarrowingDoesNotBroaden(t *testing.T) {
+	old := parseRules(t, "host all all 10.0.0.0/8 md5\n")
+	changed := parseRules(t, "host all all 10.0.0.0/8 scram-sha-256\n")
+	diff := hba.DiffAccess(old, changed, hba.Roles{})
+	if diff.Broadens || len(diff.Regions) != 1 {
+		t.Fatalf("expected one non-broadening region, got %+v", diff)
+	}
+}
+
+func TestDiffAccessNoChangesIsEmptyArray(t *testing.T) {
+	rules := parseRules(t, "host all all 10.0.0.0/8 scram-sha-256\n")
+	out, err := json.Marshal(hba.DiffAccess(rules, rules, hba.Roles{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), `"regions":[]`) {
+		t.Fatalf("regions must be an empty array: %s", out)
+	}
+}
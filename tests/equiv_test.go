@@ -0,0 +1,79 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+
+	"go_hba_rules/pkg/hba"
+)
+
+func parseRules(t *testing.T, input string) []hba.Rule {
+	t.Helper()
+	rules, err := hba.ParseHBA(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	return rules
+}
+
+func TestEquivalentRefactor(t *testing.T) {
+	old := parseRules(t, `hostssl all app 10.0.0.0/24 scram-sha-256
+host all all 0.0.0.0/0 reject
+`)
+	refactored := parseRules(t, `hostssl all app 10.0.0.0/25 scram-sha-256
+hostssl all app 10.0.0.128/25 scram-sha-256
+host all all 0.0.0.0/0 reject
+`)
+	if diffs := hba.Compare(old, refactored, hba.Roles{}); len(diffs) != 0 {
+		t.Fatalf("expected files to be equivalent, got %v", diffs)
+	}
+}
+
+func TestCompareReportsCounterexample(t *testing.T) {
+	old := parseRules(t, `host all all 10.0.0.0/8 trust
+host all all 0.0.0.0/0 md5
+`)
+	changed := parseRules(t, `host all all 10.0.0.0/16 trust
+host all all 0.0.0.0/0 md5
+`)
+	diffs := hba.Compare(old, changed, hba.Roles{})
+	if len(diffs) == 0 {
+		t.Fatalf("expected differences")
+	}
+	for _, d := range diffs {
+		if d.Old.Line != 1 || d.New.Line != 2 || d.New.Method != "md5" {
+			t.Fatalf("unexpected outcomes: %s", d)
+		}
+		if ip := d.Example.Addr.To4(); ip == nil || ip[0] != 10 {
+			t.Fatalf("example must be inside 10.0.0.0/8: %s", d)
+		}
+		if o, _ := hba.Simulate(old, d.Example, hba.Roles{}); o.Line != 1 {
+			t.Fatalf("old file must choose line 1 for %s, got %d", d.Example, o.Line)
+		}
+		if n, _ := hba.Simulate(changed, d.Example, hba.Roles{}); n.Line != 2 {
+			t.Fatalf("new file must choose line 2 for %s, got %d", d.Example, n.Line)
+		}
+	}
+}
+
+func TestCompareSeesNamesMatchingSeveralRegexes(t *testing.T) {
+	a := parseRules(t, "host /^app all 0.0.0.0/0 reject\nhost /x$ all 0.0.0.0/0 trust\nhost all all 0.0.0.0/0 md5\n")
+	b := parseRules(t, "host /x$ all 0.0.0.0/0 trust\nhost /^app all 0.0.0.0/0 reject\nhost all all 0.0.0.0/0 md5\n")
+	diffs := hba.Compare(a, b, hba.Roles{})
+	if len(diffs) == 0 {
+		t.Fatalf("a database matching both /^app and /x$ is rejected by one file and trusted by the other")
+	}
+	for _, d := range diffs {
+		db := d.Example.Database
+		if !strings.HasPrefix(db, "app") || !strings.HasSuffix(db, "x") || d.Old.Method != "reject" || d.New.Method != "trust" {
+			t.Fatalf("unexpected difference: %s", d)
+		}
+	}
+
+	// без общих имён у выражений порядок не важен
+	c := parseRules(t, "host /^app all 0.0.0.0/0 reject\nhost /^db all 0.0.0.0/0 trust\n")
+	d := parseRules(t, "host /^db all 0.0.0.0/0 trust\nhost /^app all 0.0.0.0/0 reject\n")
+	if diffs := hba.Compare(c, d, hba.Roles{}); len(diffs) != 0 {
+		t.Fatalf("disjoint regexes: %v", diffs)
+	}
+}
@@ -0,0 +1,51 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+
+	"go_hba_rules/pkg/hba"
+)
+
+func TestOverlapCounterexamples(t *testing.T) {
+	input := `host all all 10.0.0.0/16 reject
+host all all 0.0.0.0/0 md5
+hostssl mydb app 10.1.0.0/24 scram-sha-256
+host mydb app 10.0.0.5/32 scram-sha-256
+`
+	rules, err := hba.ParseHBA(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	issues := hba.CheckOverlaps(rules)
+
+	for _, is := range issues {
+		if is.Example == nil {
+			t.Fatalf("overlap issue without example: %+v", is)
+		}
+		if !strings.Contains(is.Message, "Example: ") {
+			t.Fatalf("example should be rendered in message: %q", is.Message)
+		}
+	}
+
+	// строка 3 затенена строкой 2: пример обязан дойти до строки 2 и подходить под 3.
+	var shadowed *hba.Issue
+	for i, is := range issues {
+		if is.Code == "shadowedByBroadRule" && is.Line == 3 {
+			shadowed = &issues[i]
+		}
+	}
+	if shadowed == nil {
+		t.Fatalf("expected shadowedByBroadRule on line 3, got %+v", issues)
+	}
+	ex := *shadowed.Example
+	if ex.Database != "mydb" || ex.User != "app" || ex.Transport != hba.TransportSSL {
+		t.Fatalf("unexpected example %+v", ex)
+	}
+	if r, ok := hba.Simulate(rules, ex, hba.Roles{}); !ok || r.Line != 2 {
+		t.Fatalf("example must reach line 2, got %v %d", ok, r.Line)
+	}
+	if !rules[2].Matches(ex, hba.Roles{}) {
+		t.Fatalf("example must also match the shadowed rule: %+v", ex)
+	}
+}
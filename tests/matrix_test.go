@@ -0,0 +1,77 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"go_hba_rules/pkg/hba"
+)
+
+func TestBuildMatrix(t *testing.T) {
+	input := `local all postgres peer
+hostssl billing app 10.0.0.0/24 scram-sha-256
+host all all 10.0.0.0/8 reject
+`
+	rules, err := hba.ParseHBA(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	m := hba.BuildMatrix(rules, hba.Roles{})
+
+	find := func(tr hba.Transport, db, user, addr string) *hba.MatrixRow {
+		for i, r := range m.Rows {
+			if r.Transport != tr || !contains(r.Databases, db) || !contains(r.Users, user) {
+				continue
+			}
+			if addr == "" || contains(r.Addresses, addr) {
+				return &m.Rows[i]
+			}
+		}
+		return nil
+	}
+
+	if r := find(hba.TransportLocal, "billing", "postgres", ""); r == nil || r.Method != "peer" {
+		t.Fatalf("expected local postgres -> peer, got %+v", r)
+	}
+	if r := find(hba.TransportSSL, "billing", "app", "10.0.0.0/24"); r == nil || r.Line != 2 {
+		t.Fatalf("expected ssl billing/app from 10.0.0.0/24 -> line 2, got %+v", r)
+	}
+	if r := find(hba.TransportPlain, "billing", "app", "10.0.0.0/8"); r == nil || r.Method != "reject" || r.Line != 3 {
+		t.Fatalf("expected plain billing/app from 10.0.0.0/8 -> reject line 3, got %+v", r)
+	}
+	if r := find(hba.TransportPlain, "(other)", "(other)", "::/0"); r == nil || r.Line != 0 {
+		t.Fatalf("expected IPv6 to fall through to implicit reject, got %+v", r)
+	}
+
+	var csvBuf, mdBuf, jsonBuf bytes.Buffer
+	if err := m.WriteCSV(&csvBuf); err != nil {
+		t.Fatalf("csv: %v", err)
+	}
+	if !strings.HasPrefix(csvBuf.String(), "transport,replication,databases,users,addresses,line,method,options\n") {
+		t.Fatalf("unexpected csv header: %q", csvBuf.String())
+	}
+	if err := m.WriteMarkdown(&mdBuf); err != nil {
+		t.Fatalf("md: %v", err)
+	}
+	if got := strings.Count(mdBuf.String(), "\n"); got != len(m.Rows)+2 {
+		t.Fatalf("expected %d markdown lines, got %d", len(m.Rows)+2, got)
+	}
+	if err := m.WriteJSON(&jsonBuf); err != nil {
+		t.Fatalf("json: %v", err)
+	}
+	var back hba.Matrix
+	if err := json.Unmarshal(jsonBuf.Bytes(), &back); err != nil || len(back.Rows) != len(m.Rows) {
+		t.Fatalf("json round-trip failed: %v", err)
+	}
+}
+
+func contains(list []string, v string) bool {
+	for _, x := range list {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
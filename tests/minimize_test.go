@@ -0,0 +1,69 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+
+	"go_hba_rules/pkg/hba"
+)
+
+func TestMinimizePreservesSemanticsAndComments(t *testing.T) {
+	input := `# header
+local all postgres peer
+# first half
+hostssl billing app 10.0.0.0/25 scram-sha-256
+hostssl billing app 10.0.0.128/25 scram-sha-256 # second half
+# reports
+hostssl reports app 10.0.0.0/24 scram-sha-256
+# duplicate
+hostssl billing app 10.0.0.5/32 scram-sha-256
+host all all 0.0.0.0/0 reject
+# dead
+host all bob 10.1.0.0/16 md5
+`
+	rules := parseRules(t, input)
+	m := hba.Minimize(rules, hba.Roles{})
+	if !hba.Equivalent(rules, m.Rules, hba.Roles{}) {
+		t.Fatalf("minimized rules are not equivalent: %v", hba.Compare(rules, m.Rules, hba.Roles{}))
+	}
+	if len(m.Rules) != 3 {
+		t.Fatalf("expected 3 rules, got %d: %+v", len(m.Rules), m.Changes)
+	}
+
+	kinds := map[string]bool{}
+	for _, c := range m.Changes {
+		kinds[c.Kind] = true
+	}
+	for _, k := range []string{"unreachable", "mergedNetworks", "mergedDatabases"} {
+		if !kinds[k] {
+			t.Fatalf("expected %s change, got %+v", k, m.Changes)
+		}
+	}
+
+	out := m.Render(input)
+	for _, want := range []string{"# header", "# first half", "# second half", "# reports",
+		"hostssl billing,reports app 10.0.0.0/24 scram-sha-256", "host all all 0.0.0.0/0 reject"} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("expected %q in output:\n%s", want, out)
+		}
+	}
+	for _, gone := range []string{"# duplicate", "# dead", "10.1.0.0/16"} {
+		if strings.Contains(out, gone) {
+			t.Fatalf("unexpected %q in output:\n%s", gone, out)
+		}
+	}
+
+	reparsed := parseRules(t, out)
+	if !hba.Equivalent(rules, reparsed, hba.Roles{}) {
+		t.Fatalf("rendered file is not equivalent to the input:\n%s", out)
+	}
+}
+
+func TestMinimizeKeepsSamenetReachableRules(t *testing.T) {
+	rules := parseRules(t, `host all all samenet md5
+host all all 10.0.0.0/8 md5
+`)
+	if m := hba.Minimize(rules, hba.Roles{}); len(m.Rules) != 2 {
+		t.Fatalf("rule below samenet must survive, got %+v", m.Changes)
+	}
+}
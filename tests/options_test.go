@@ -0,0 +1,62 @@
+package tests
+
+import (
+	"testing"
+
+	"go_hba_rules/pkg/hba"
+)
+
+func TestMethodOptions(t *testing.T) {
+	cases := []struct {
+		name string
+		line string
+		code string // "" — правило корректно
+	}{
+		{"ldap simple bind", `hostssl all all 10.0.0.0/24 ldap ldapserver=ldap.example.net ldapprefix="cn=" ldapsuffix=",dc=example,dc=net"`, ""},
+		{"ldap search+bind", `hostssl all all 10.0.0.0/24 ldap ldapserver=ldap.example.net ldapbasedn="dc=example,dc=net" ldapsearchattribute=uid`, ""},
+		{"ldap url", `hostssl all all 10.0.0.0/24 ldap ldapurl="ldaps://ldap.example.net:636/dc=example,dc=net?uid?sub"`, ""},
+		{"ldap mixed", `hostssl all all 10.0.0.0/24 ldap ldapserver=ldap.example.net ldapprefix="cn=" ldapbasedn="dc=example,dc=net"`, "ldapMixedBind"},
+		{"ldap no mode", `hostssl all all 10.0.0.0/24 ldap ldapserver=ldap.example.net`, "ldapMissingMode"},
+		{"ldap no server", `hostssl all all 10.0.0.0/24 ldap ldapbasedn="dc=example,dc=net"`, "ldapMissingServer"},
+		{"ldap attr+filter", `hostssl all all 10.0.0.0/24 ldap ldapserver=x ldapbasedn=dc=x ldapsearchattribute=uid ldapsearchfilter="(uid=$username)"`, "ldapSearchAttrFilter"},
+		{"ldap bad url", `hostssl all all 10.0.0.0/24 ldap ldapurl="http://ldap.example.net/dc=x"`, "ldapInvalidURL"},
+		{"ldap bad scheme", `hostssl all all 10.0.0.0/24 ldap ldapserver=x ldapbasedn=dc=x ldapscheme=ldapx`, "optionInvalidValue"},
+		{"ldap bad port", `hostssl all all 10.0.0.0/24 ldap ldapserver=x ldapbasedn=dc=x ldapport=99999`, "optionInvalidValue"},
+		{"radius ok", `hostssl all all 10.0.0.0/24 radius radiusservers="r1,r2" radiussecrets=s radiusports="1812,1813"`, ""},
+		{"radius secrets", `hostssl all all 10.0.0.0/24 radius radiusservers="r1,r2,r3" radiussecrets="s1,s2"`, "radiusListMismatch"},
+		{"radius identifiers", `hostssl all all 10.0.0.0/24 radius radiusservers="r1,r2" radiussecrets=s radiusidentifiers="a,b,c"`, "radiusListMismatch"},
+		{"radius missing", `hostssl all all 10.0.0.0/24 radius radiusservers=r1`, "radiusMissingOption"},
+		{"clientname ok", `hostssl all all 10.0.0.0/24 cert clientname=DN`, ""},
+		{"clientname bad", `hostssl all all 10.0.0.0/24 cert clientname=UID`, "clientnameInvalid"},
+		{"clientname host", `host all all 10.0.0.0/24 scram-sha-256 clientname=CN`, "clientnameInvalid"},
+		{"cert verify-ca", `hostssl all all 10.0.0.0/24 cert clientcert=verify-ca`, "clientcertCertMethod"},
+		{"pam ok", `hostssl all all 10.0.0.0/24 pam pamservice=postgresql`, ""},
+		{"pam path", `hostssl all all 10.0.0.0/24 pam pamservice=/etc/pam.d/postgresql`, "pamOptionInvalid"},
+		{"wrong method", `hostssl all all 10.0.0.0/24 scram-sha-256 ldapserver=x`, "optionWrongMethod"},
+		{"unknown", `hostssl all all 10.0.0.0/24 scram-sha-256 ldapsrever=x`, "unknownOption"},
+	}
+	var optionCodes []string
+	for _, ci := range hba.DefaultRegistry.Codes() {
+		switch ci.Code {
+		case "unknownOption", "optionWrongMethod", "optionInvalidValue", "ldapMissingServer", "ldapMissingMode",
+			"ldapMixedBind", "ldapSearchAttrFilter", "ldapInvalidURL", "radiusMissingOption", "radiusListMismatch",
+			"clientnameInvalid", "clientcertCertMethod", "pamOptionInvalid":
+			optionCodes = append(optionCodes, ci.Code)
+		}
+	}
+	if len(optionCodes) != 13 {
+		t.Fatalf("option codes are not registered: %v", optionCodes)
+	}
+	for _, tc := range cases {
+		issues := hba.CheckAll(parseRules(t, tc.line+"\n"), hba.Config{SSLOn: true, Enable: optionCodes})
+		if tc.code == "" {
+			if len(issues) != 0 {
+				t.Errorf("%s: expected no option issues, got %v", tc.name, issues)
+			}
+			continue
+		}
+		if !hasCodeAt(issues, tc.code, 1) {
+			t.Errorf("%s: expected %s, got %v", tc.name, tc.code, issues)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package tests
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"go_hba_rules/pkg/hba"
+)
+
+// syntheticTenants генерирует многоарендный pg_hba: у каждого арендатора своя БД,
+// пользователь и подсеть /24, плюс общие правила для администраторов и мониторинга.
+func syntheticTenants(n int) []hba.Rule {
+	var b strings.Builder
+	b.WriteString("local all postgres peer\n")
+	b.WriteString("hostssl all +admins 10.255.0.0/24 scram-sha-256 clientcert=verify-full\n")
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, "hostssl tenant_%d tenant_%d 10.%d.%d.0/24 scram-sha-256\n", i, i, i/256%256, i%256)
+		if i%10 == 0 {
+			fmt.Fprintf(&b, "hostssl tenant_%d monitor 10.254.%d.0/24 scram-sha-256\n", i, i%256)
+		}
+	}
+	b.WriteString("host all all 0.0.0.0/0 reject\n")
+	b.WriteString("host all all ::/0 reject\n")
+	rules, err := hba.ParseHBA(strings.NewReader(b.String()))
+	if err != nil {
+		panic(err)
+	}
+	return rules
+}
+
+func TestOverlapsOnLargeFile(t *testing.T) {
+	rules := syntheticTenants(5000)
+	// дубликат арендатора под catch-all reject ловится через индексы
+	dup := rules[2]
+	dup.Line = rules[len(rules)-1].Line + 1
+	rules = append(rules, dup)
+
+	issues := hba.CheckOverlaps(rules)
+	if !hasCodeAt(issues, "redundantRule", dup.Line) {
+		t.Fatalf("expected redundantRule for duplicated tenant rule")
+	}
+	for _, is := range issues {
+		if is.Code == "shadowedByReject" && is.Line != dup.Line {
+			t.Fatalf("catch-all reject must shadow only the rule below it: %+v", is)
+		}
+	}
+}
+
+func benchmarkOverlaps(b *testing.B, n int) {
+	rules := syntheticTenants(n)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		hba.CheckOverlaps(rules)
+	}
+}
+
+func BenchmarkCheckOverlaps1k(b *testing.B)  { benchmarkOverlaps(b, 1000) }
+func BenchmarkCheckOverlaps5k(b *testing.B)  { benchmarkOverlaps(b, 5000) }
+func BenchmarkCheckOverlaps20k(b *testing.B) { benchmarkOverlaps(b, 20000) }
@@ -39,3 +39,88 @@ host all all 10.0.0.0/16 scram-sha-256
 		}
 	}
 }
+
+func TestPartialOverlapOnlyWhenOutcomeDiffers(t *testing.T) {
+	input := `host mydb,otherdb app,admin 10.0.0.0/24 md5
+host all all 10.0.1.0/24 reject
+host all all 10.0.0.0/24 scram-sha-256
+host all all 10.0.0.0/16 scram-sha-256
+host mydb app 10.0.0.0/8 md5
+`
+	rules, err := hba.ParseHBA(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	issues := hba.CheckOverlaps(rules)
+
+	var partial []hba.Issue
+	for _, is := range issues {
+		if is.Code == "partialOverlap" {
+			partial = append(partial, is)
+		}
+	}
+	// строка 3: пересекается только с 1 (md5).
+	// строка 4: пересекается с 1 (md5) и 2 (reject) — одна агрегированная находка;
+	// с 3 результат одинаков, поэтому она не упоминается.
+	// строка 5: пересекается с 2 (reject), 3 и 4 (scram); с 1 результат одинаков.
+	if len(partial) != 3 || partial[0].Line != 3 || partial[1].Line != 4 || partial[2].Line != 5 {
+		t.Fatalf("expected aggregated partialOverlap for lines 3, 4 and 5, got %+v", partial)
+	}
+	if got := partial[1].Related; len(got) != 2 || got[0] != 1 || got[1] != 2 {
+		t.Fatalf("expected related lines [1 2], got %v", got)
+	}
+	msg := partial[1].Message
+	for _, want := range []string{"line 1 [db=mydb,otherdb user=app,admin addr=10.0.0.0/24 method=md5]", "line 2 [db=all user=all addr=10.0.1.0/24 method=reject]"} {
+		if !strings.Contains(msg, want) {
+			t.Fatalf("message %q should contain %q", msg, want)
+		}
+	}
+	if got := partial[2].Related; len(got) != 3 || got[0] != 2 || got[1] != 3 || got[2] != 4 {
+		t.Fatalf("expected related lines [2 3 4], got %v", got)
+	}
+}
+
+func TestPartialOverlapExampleWithIncludedRules(t *testing.T) {
+	rules, err := hba.ParseHBA(strings.NewReader("host all all 10.0.0.0/24 scram-sha-256\nhost all all 10.0.0.0/8 md5\nhost all all 0.0.0.0/0 scram-sha-256\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// вторая строка пришла из включённого файла, где она тоже первая
+	rules[1].File, rules[1].Line = "extra.conf", 1
+	for _, is := range hba.CheckOverlaps(rules) {
+		if is.Code != "partialOverlap" || is.Line != 3 {
+			continue
+		}
+		// 10.0.0.0/24 перехватывает первая строка основного файла
+		if is.Example == nil || !strings.HasPrefix(is.Example.Addr.String(), "10.") || strings.HasPrefix(is.Example.Addr.String(), "10.0.0.") {
+			t.Fatalf("example must reach extra.conf line 1, not the main file's line 1: %+v", is.Example)
+		}
+		return
+	}
+	t.Fatalf("expected partialOverlap at line 3")
+}
+
+func TestRegexRejectShadowsLiteralRule(t *testing.T) {
+	rules := parseRules(t, "host /^tenant_ all 10.0.0.0/8 reject\nhost tenant_1 bob 10.1.0.0/16 md5\n")
+	if issues := hba.CheckOverlaps(rules); !hasCodeAt(issues, "shadowedByReject", 2) {
+		t.Fatalf("regex reject must shadow line 2: %v", issues)
+	}
+}
+
+func TestHostsslRejectAboveHostIsPartial(t *testing.T) {
+	rules := parseRules(t, "hostssl all all 10.0.0.0/8 reject\nhost all all 10.0.0.0/8 scram-sha-256\nhostnogssenc all all 10.0.0.0/8 md5\n")
+	issues := hba.CheckOverlaps(rules)
+	// plain и GSS по-прежнему доходят до строки 2
+	if hasCodeAt(issues, "shadowedByReject", 2) || !hasCodeAt(issues, "partialOverlap", 2) {
+		t.Fatalf("hostssl reject must only partially overlap the host rule: %v", issues)
+	}
+	for _, is := range issues {
+		if is.Code == "partialOverlap" && is.Line == 2 && (is.Example == nil || is.Example.Transport != hba.TransportSSL) {
+			t.Fatalf("example must be an SSL connection: %+v", is)
+		}
+	}
+	// hostnogssenc пересекается с hostssl по SSL и с host по plain
+	if !hasCodeAt(issues, "partialOverlap", 3) {
+		t.Fatalf("hostnogssenc rule below hostssl reject: %v", issues)
+	}
+}
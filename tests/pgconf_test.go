@@ -0,0 +1,158 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go_hba_rules/pkg/hba"
+)
+
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestParsePGConf(t *testing.T) {
+	settings, err := hba.ParsePGConf(strings.NewReader(`# comment
+listen_addresses = '*'		# all interfaces
+ssl on
+unix_socket_directories = '/var/run/postgresql, /tmp'
+search_path = '"$user", ''public'''
+include_dir 'conf.d'
+`), "postgresql.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"listen_addresses":        "*",
+		"ssl":                     "on",
+		"unix_socket_directories": "/var/run/postgresql, /tmp",
+		"search_path":             `"$user", 'public'`,
+		"include_dir":             "conf.d",
+	}
+	if len(settings) != len(want) {
+		t.Fatalf("settings: %+v", settings)
+	}
+	for _, s := range settings {
+		if want[s.Name] != s.Value || s.File != "postgresql.conf" {
+			t.Fatalf("unexpected setting %+v", s)
+		}
+	}
+	if settings[1].Line != 3 {
+		t.Fatalf("ssl must come from line 3: %+v", settings[1])
+	}
+
+	for _, bad := range []string{"ssl =", "ssl = 'on", "ssl = on off", "= on"} {
+		if _, err := hba.ParsePGConf(strings.NewReader(bad), "x.conf"); err == nil {
+			t.Fatalf("%q: expected syntax error", bad)
+		}
+	}
+}
+
+func TestLoadPGConfIncludesAndAutoConf(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"etc/postgresql.conf": `ssl = off
+password_encryption = md5
+data_directory = '../data'
+hba_file = 'custom_hba.conf'
+include 'tls.conf'
+include_if_exists 'missing.conf'
+include_dir 'conf.d'
+`,
+		"etc/tls.conf":              "ssl = on\n",
+		"etc/conf.d/10-listen.conf": "listen_addresses = '10.0.0.1,localhost'\n",
+		"etc/conf.d/20-pw.conf":     "password_encryption = 'scram-sha-256'\n",
+		"etc/conf.d/.hidden.conf":   "ssl = off\n",
+		"etc/conf.d/notes.txt":      "ssl = off\n",
+		"data/postgresql.auto.conf": "# Do not edit this file manually!\nlisten_addresses = '*'\n",
+	})
+	c, err := hba.LoadPGConf(filepath.Join(root, "etc/postgresql.conf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if on, err := c.SSL(); err != nil || !on {
+		t.Fatalf("ssl from include must win: %v %v", on, err)
+	}
+	if s := c.Get("ssl"); s.File != filepath.Join(root, "etc/tls.conf") || s.Line != 1 {
+		t.Fatalf("ssl origin: %+v", s)
+	}
+	if got := c.PasswordEncryption(); got != "scram-sha-256" {
+		t.Fatalf("include_dir must be read in order: %s", got)
+	}
+	// postgresql.auto.conf из каталога данных переопределяет всё остальное
+	if got := c.ListenAddresses(); len(got) != 1 || got[0] != "*" {
+		t.Fatalf("auto.conf must override listen_addresses: %v", got)
+	}
+	if got := c.Get("listen_addresses").File; got != filepath.Join(root, "data", hba.AutoConfFileName) {
+		t.Fatalf("listen_addresses origin: %s", got)
+	}
+	if got := c.Get("hba_file").Value; got != filepath.Join(root, "data/custom_hba.conf") {
+		t.Fatalf("relative hba_file is relative to the data directory: %s", got)
+	}
+	if s := c.Get("ident_file"); s.Value != filepath.Join(root, "etc/pg_ident.conf") || s.File != "" {
+		t.Fatalf("default ident_file is next to postgresql.conf: %+v", s)
+	}
+	if got := c.UnixSocketDirectories(); len(got) != 1 || got[0] != "/tmp" {
+		t.Fatalf("default unix_socket_directories: %v", got)
+	}
+
+	var cfg hba.Config
+	if err := c.Apply(&cfg); err != nil || !cfg.SSLOn || cfg.Server != c {
+		t.Fatalf("apply: %+v %v", cfg, err)
+	}
+}
+
+func TestLoadPGConfErrors(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"missing.conf": "include 'nope.conf'\n",
+		"loop.conf":    "include 'loop.conf'\n",
+		"badbool.conf": "ssl = maybe\n",
+	})
+	for _, name := range []string{"missing.conf", "loop.conf"} {
+		if _, err := hba.LoadPGConf(filepath.Join(root, name)); err == nil {
+			t.Fatalf("%s: expected error", name)
+		}
+	}
+	c, err := hba.LoadPGConf(filepath.Join(root, "badbool.conf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Apply(&hba.Config{}); err == nil || !strings.Contains(err.Error(), "badbool.conf:1") {
+		t.Fatalf("invalid ssl must be reported with its origin: %v", err)
+	}
+}
+
+func TestSSLSourceInMessages(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{"postgresql.conf": "port = 5432\n"})
+	c, err := hba.LoadPGConf(filepath.Join(root, "postgresql.conf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := hba.Config{SSLOn: true}
+	if err := c.Apply(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	issues := hba.CheckAll(parseRules(t, "hostssl all app 10.0.0.0/24 scram-sha-256\n"), cfg)
+	var msg string
+	for _, is := range issues {
+		if is.Code == "hostsslNoSSL" {
+			msg = is.Message
+		}
+	}
+	if !strings.Contains(msg, "default; not set in postgresql.conf") {
+		t.Fatalf("hostsslNoSSL must explain where ssl=off comes from: %q", msg)
+	}
+}
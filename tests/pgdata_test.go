@@ -0,0 +1,245 @@
+package tests
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go_hba_rules/pkg/hba"
+)
+
+func TestLoadHBAFollowsIncludes(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"pg_hba.conf": `local all postgres peer
+include_dir hba.d
+include_if_exists missing.conf
+host all all 0.0.0.0/0 reject
+`,
+		"hba.d/20-b.conf": "hostssl b b 10.0.2.0/24 scram-sha-256\n",
+		"hba.d/10-a.conf": "# tenant a\nhostssl a a 10.0.1.0/24 scram-sha-256\ninclude ../nested.conf\n",
+		"hba.d/skip.txt":  "host all all 0.0.0.0/0 trust\n",
+		"nested.conf":     "hostssl n n 10.0.3.0/24 md5\n",
+		"pg_ident.conf":   "base root postgres\ninclude_dir ident.d\n",
+		"ident.d/x.conf":  "corp alice alice\n",
+		"ident.d/.y.conf": "hidden bob bob\n",
+	})
+	rules, includes, err := hba.LoadHBA(filepath.Join(root, "pg_hba.conf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	type pos struct {
+		file string
+		line int
+	}
+	want := []pos{
+		{"", 1},
+		{filepath.Join(root, "hba.d/10-a.conf"), 2},
+		{filepath.Join(root, "nested.conf"), 1},
+		{filepath.Join(root, "hba.d/20-b.conf"), 1},
+		{"", 4},
+	}
+	if len(rules) != len(want) {
+		t.Fatalf("rules: %+v", rules)
+	}
+	for i, w := range want {
+		if rules[i].File != w.file || rules[i].Line != w.line {
+			t.Fatalf("rule %d: got %s:%d, want %s:%d", i, rules[i].File, rules[i].Line, w.file, w.line)
+		}
+	}
+	// директивы в порядке обхода: вложенная — сразу за include_dir
+	if len(includes) != 3 || includes[1].File != filepath.Join(root, "hba.d/10-a.conf") || includes[2].Kind != "include_if_exists" {
+		t.Fatalf("includes: %+v", includes)
+	}
+
+	ident, err := hba.LoadIdent(filepath.Join(root, "pg_ident.conf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ident.Has("base") || !ident.Has("corp") || ident.Has("hidden") {
+		t.Fatalf("ident maps: %+v", ident.Maps)
+	}
+
+	// находки во включённых файлах несут File; сообщения ссылаются на файл
+	issues := hba.CheckAll(rules, hba.Config{SSLOn: true, Enable: []string{"md5Deprecated", "shadowedByReject"}})
+	if len(issues) != 1 || issues[0].File != filepath.Join(root, "nested.conf") || issues[0].Line != 1 {
+		t.Fatalf("md5Deprecated must point into nested.conf: %+v", issues)
+	}
+
+	if _, _, err := hba.LoadHBA(filepath.Join(root, "nested.conf.missing")); err == nil {
+		t.Fatal("missing file must be an error")
+	}
+	writeFiles(t, root, map[string]string{"loop.conf": "include loop.conf\n"})
+	if _, _, err := hba.LoadHBA(filepath.Join(root, "loop.conf")); err == nil {
+		t.Fatal("include loop must be an error")
+	}
+}
+
+func TestIncludedIssuesKeepTheirFile(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"pg_hba.conf": "# hba-check:ignore md5Deprecated\nhost all all 10.0.0.0/24 md5\ninclude other.conf\n",
+		"other.conf":  "\nhost all all 10.0.0.0/24 md5\n",
+	})
+	rules, _, err := hba.LoadHBA(filepath.Join(root, "pg_hba.conf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	directives, err := hba.LoadDirectives(filepath.Join(root, "pg_hba.conf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	issues := hba.CheckAll(rules, hba.Config{SSLOn: true, Directives: directives,
+		Enable: []string{"md5Deprecated", "redundantRule"}})
+	var main, other, redundant *hba.Issue
+	for i, is := range issues {
+		switch {
+		case is.Code == "redundantRule":
+			redundant = &issues[i]
+		case is.File == "":
+			main = &issues[i]
+		default:
+			other = &issues[i]
+		}
+	}
+	// обе находки на строке 2, но подавлена только в основном файле
+	if main == nil || !main.Suppressed || other == nil || other.Suppressed || other.Line != 2 {
+		t.Fatalf("suppression must not leak into included files: %+v", issues)
+	}
+	if redundant == nil || !strings.HasPrefix(redundant.Message, "Rule is redundant due to line 2.") {
+		t.Fatalf("redundantRule: %+v", redundant)
+	}
+
+	// отпечатки различают одинаковые строки разных файлов
+	b := hba.NewBaseline(issues, rules)
+	if len(b.Entries) != 2 {
+		t.Fatalf("baseline entries: %+v", b.Entries)
+	}
+	if stale := b.Apply(issues, rules); len(stale) != 0 {
+		t.Fatalf("stale: %+v", stale)
+	}
+}
+
+func TestDirectivesInIncludedFiles(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"pg_hba.conf": "# hba-check:disable md5Deprecated\nhost all all 10.0.0.0/24 md5\ninclude other.conf\n",
+		"other.conf":  "host all app 10.0.1.0/24 md5 # hba-check:ignore md5Deprecated\n# hba-check:ignore trustNetwork\nhost all ops 10.0.2.0/24 md5\n",
+	})
+	path := filepath.Join(root, "pg_hba.conf")
+	rules, _, err := hba.LoadHBA(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	directives, err := hba.LoadDirectives(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := filepath.Join(root, "other.conf")
+	if len(directives) != 3 || directives[0].File != "" || directives[1].File != other || directives[1].Target != 1 {
+		t.Fatalf("directives: %+v", directives)
+	}
+	issues := hba.CheckAll(rules, hba.Config{SSLOn: true, Directives: directives,
+		Enable: []string{"md5Deprecated", "trustNetwork", "unusedSuppression"}})
+	suppressed := map[string]bool{}
+	var unused []hba.Issue
+	for _, is := range issues {
+		switch is.Code {
+		case "md5Deprecated":
+			suppressed[fmt.Sprintf("%s:%d", is.File, is.Line)] = is.Suppressed
+		case "unusedSuppression":
+			unused = append(unused, is)
+		}
+	}
+	// disable основного файла не доходит до other.conf, ignore в other.conf
+	// действует на свою строку 1, а не на строку 1 основного файла
+	want := map[string]bool{":2": true, other + ":1": true, other + ":3": false}
+	if !reflect.DeepEqual(suppressed, want) {
+		t.Fatalf("suppressed: %v, want %v", suppressed, want)
+	}
+	if len(unused) != 1 || unused[0].File != other || unused[0].Line != 2 {
+		t.Fatalf("unusedSuppression must point into other.conf: %+v", unused)
+	}
+
+	writeFiles(t, root, map[string]string{"other.conf": "# hba-check:silence\n"})
+	if _, err := hba.LoadDirectives(path); err == nil || !strings.Contains(err.Error(), "other.conf") {
+		t.Fatalf("expected an error naming other.conf, got %v", err)
+	}
+}
+
+func TestDiscoverPGConf(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		// каталог данных с postgresql.conf
+		"inplace/postgresql.conf": "ssl = on\n",
+		"inplace/PG_VERSION":      "15\n",
+		"inplace/pg_hba.conf":     "local all all peer\n",
+		// раскладка Debian: конфигурация в etc/<версия>/<кластер>
+		"etc/16/main/postgresql.conf": "data_directory = '" + filepath.Join(root, "var/16/main") + "'\nhba_file = '" + filepath.Join(root, "etc/16/main/pg_hba.conf") + "'\n",
+		"var/16/main/PG_VERSION":      "16\n",
+		// postmaster.opts указывает config_file явно
+		"custom/data/postmaster.opts": `/usr/lib/postgresql/17/bin/postgres "-D" "` + filepath.Join(root, "custom/data") + `" "-c" "config_file=` + filepath.Join(root, "custom/conf/pg.conf") + `"` + "\n",
+		"custom/conf/pg.conf":         "ssl = off\n",
+	})
+
+	c, err := hba.LoadDataDir(filepath.Join(root, "inplace"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Version != 15 || c.Get("hba_file").Value != filepath.Join(root, "inplace/pg_hba.conf") {
+		t.Fatalf("in-place data directory: %+v", c)
+	}
+	cfg := hba.Config{}
+	if err := c.Apply(&cfg); err != nil || !cfg.SSLOn || cfg.PGVersion != 15 {
+		t.Fatalf("apply must take ssl and version from the server: %+v %v", cfg, err)
+	}
+
+	old := hba.DebianConfRoot
+	hba.DebianConfRoot = filepath.Join(root, "etc")
+	defer func() { hba.DebianConfRoot = old }()
+	c, err = hba.LoadDataDir(filepath.Join(root, "var/16/main"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Path != filepath.Join(root, "etc/16/main/postgresql.conf") || c.Version != 16 ||
+		c.Get("hba_file").Value != filepath.Join(root, "etc/16/main/pg_hba.conf") {
+		t.Fatalf("debian layout: %+v", c)
+	}
+
+	path, err := hba.DiscoverPGConf(filepath.Join(root, "custom/data"))
+	if err != nil || path != filepath.Join(root, "custom/conf/pg.conf") {
+		t.Fatalf("postmaster.opts config_file: %s %v", path, err)
+	}
+
+	if _, err := hba.DiscoverPGConf(filepath.Join(root, "nowhere")); err == nil {
+		t.Fatal("expected an error for a directory without configuration")
+	}
+}
+
+func TestSubcommandsSeeIncludedRules(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"a.conf":   "include inc.conf\nhost all all 0.0.0.0/0 reject\n",
+		"inc.conf": "host all all 10.0.0.0/8 trust\n",
+	})
+	rules, _, err := hba.LoadHBA(filepath.Join(root, "a.conf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// без включённого файла остаётся только reject — доступ другой
+	if hba.Equivalent(rules, parseRules(t, "host all all 0.0.0.0/0 reject\n"), hba.Roles{}) {
+		t.Fatal("included trust rule must make the files differ")
+	}
+	conn := hba.Connection{Transport: hba.TransportPlain, Database: "x", User: "y", Addr: net.ParseIP("10.1.1.1")}
+	trace := hba.TraceConnection(rules, conn, hba.Roles{})
+	inc := filepath.Join(root, "inc.conf")
+	if trace.Method != "trust" || trace.MatchedFile != inc || trace.MatchedLine != 1 {
+		t.Fatalf("trace must match the included rule: %+v", trace)
+	}
+	if !strings.Contains(trace.String(), "result: file="+inc+" line=1 method=trust") {
+		t.Fatalf("trace text: %s", trace)
+	}
+}
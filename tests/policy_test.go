@@ -0,0 +1,87 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go_hba_rules/pkg/hba"
+)
+
+const testPolicy = `{
+  "severity": {"md5Deprecated": "error"},
+  "thresholds": {"default": {"wide4": 8}, "hostssl": {"wide4": 24}},
+  "overrides": [{"paths": ["dev/**"], "disable": ["md5Deprecated"], "severity": {"wideAddress": "INFO"}}]
+}`
+
+func TestPolicyDiscoveryAndOverrides(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"dev/eu", "prod"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(root, hba.PolicyFileName), []byte(testPolicy), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	found, ok := hba.FindPolicy(filepath.Join(root, "dev", "eu"))
+	if !ok || found != filepath.Join(root, hba.PolicyFileName) {
+		t.Fatalf("expected policy in %s, got %q", root, found)
+	}
+	policy, err := hba.LoadPolicy(found, hba.DefaultRegistry)
+	if err != nil {
+		t.Fatalf("load policy: %v", err)
+	}
+
+	rules := parseRules(t, `host app app 10.0.0.0/12 md5
+hostssl app app 10.1.0.0/20 scram-sha-256
+`)
+	run := func(file string) []hba.Issue {
+		cfg := hba.Config{SSLOn: true}
+		policy.For(file).Apply(&cfg)
+		return hba.CheckAll(rules, cfg)
+	}
+
+	prod := run(filepath.Join(root, "prod", "pg_hba.conf"))
+	if !hasSeverity(prod, "md5Deprecated", hba.SeverityError) {
+		t.Fatalf("prod: md5Deprecated must be ERROR: %v", prod)
+	}
+	if hasCodeAt(prod, "wideAddress", 1) {
+		t.Fatalf("prod: /12 is not wide with default wide4=8: %v", prod)
+	}
+	if !hasCodeAt(prod, "wideAddress", 2) {
+		t.Fatalf("prod: /20 is wide for hostssl with wide4=24: %v", prod)
+	}
+
+	dev := run(filepath.Join(root, "dev", "eu", "pg_hba.conf"))
+	if hasCode(dev, "md5Deprecated") {
+		t.Fatalf("dev: md5Deprecated must be disabled: %v", dev)
+	}
+	if !hasSeverity(dev, "wideAddress", hba.SeverityInfo) {
+		t.Fatalf("dev: wideAddress must be INFO: %v", dev)
+	}
+}
+
+func TestPolicyRejectsUnknownCodes(t *testing.T) {
+	for _, bad := range []string{
+		`{"disable": ["noSuchCode"]}`,
+		`{"severity": {"trustNetwork": "fatal"}}`,
+		`{"thresholds": {"hostssl_typo": {"wide4": 8}}}`,
+		`{"severety": {}}`,
+	} {
+		if _, err := hba.ParsePolicy(strings.NewReader(bad), hba.DefaultRegistry); err == nil {
+			t.Fatalf("expected error for %s", bad)
+		}
+	}
+}
+
+func hasSeverity(issues []hba.Issue, code string, sev hba.Severity) bool {
+	for _, is := range issues {
+		if is.Code == code && is.Severity == sev {
+			return true
+		}
+	}
+	return false
+}
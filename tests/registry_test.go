@@ -0,0 +1,73 @@
+package tests
+
+import (
+	"testing"
+
+	"go_hba_rules/pkg/hba"
+)
+
+func TestDisableAndEnableCodes(t *testing.T) {
+	rules := parseRules(t, "host all all 0.0.0.0/0 trust\n")
+
+	issues := hba.CheckAll(rules, hba.Config{SSLOn: true, Disable: []string{"trustNetwork"}})
+	if hasCode(issues, "trustNetwork") || !hasCode(issues, "wideAddress") {
+		t.Fatalf("disabled code must be skipped, others kept: %v", issues)
+	}
+
+	issues = hba.CheckAll(rules, hba.Config{SSLOn: true, Enable: []string{"trustNetwork"}})
+	if len(issues) != 1 || issues[0].Code != "trustNetwork" {
+		t.Fatalf("expected only trustNetwork, got %v", issues)
+	}
+}
+
+var infoNoLDAP = hba.CheckInfo{
+	Code:        "internalNoLDAP",
+	Severity:    hba.SeverityError,
+	Description: "LDAP is banned by internal policy.",
+	Remediation: "Use cert.",
+}
+
+func TestCustomCheckInRegistry(t *testing.T) {
+	reg := hba.NewRegistry()
+	err := reg.Register(hba.RuleCheck{
+		Info: []hba.CheckInfo{infoNoLDAP},
+		Check: func(ctx *hba.Context, r hba.Rule) []hba.Issue {
+			if r.Method == "ldap" {
+				return []hba.Issue{infoNoLDAP.NewIssue(r.Line, "LDAP is not allowed.")}
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	if err := reg.Register(hba.RuleCheck{Info: []hba.CheckInfo{infoNoLDAP}}); err == nil {
+		t.Fatalf("expected duplicate code error")
+	}
+
+	rules := parseRules(t, `hostssl all app 10.0.0.0/24 scram-sha-256
+hostssl all bob 10.0.0.0/24 ldap ldapserver=ldap.example.com
+`)
+	issues := reg.Run(rules, hba.Config{SSLOn: true})
+	if len(issues) != 1 || issues[0].Code != "internalNoLDAP" || issues[0].Line != 2 || issues[0].Severity != hba.SeverityError {
+		t.Fatalf("unexpected issues: %v", issues)
+	}
+}
+
+func TestBuiltinChecksHaveMetadata(t *testing.T) {
+	if err := hba.Register(hba.RuleCheck{Info: []hba.CheckInfo{{Code: "trustNetwork"}}}); err == nil {
+		t.Fatalf("registering a built-in code twice must fail")
+	}
+	codes := hba.DefaultRegistry.Codes()
+	if len(codes) == 0 {
+		t.Fatalf("no built-in checks registered")
+	}
+	for _, ci := range codes {
+		if ci.Severity == "" || ci.Description == "" || ci.Rationale == "" || ci.Remediation == "" {
+			t.Fatalf("incomplete metadata for %s: %+v", ci.Code, ci)
+		}
+	}
+	if _, ok := hba.DefaultRegistry.Lookup("partialOverlap"); !ok {
+		t.Fatalf("overlap codes must be registered")
+	}
+}
@@ -0,0 +1,67 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+
+	"go_hba_rules/pkg/hba"
+)
+
+func TestSuggestReorderUnshadowsStricterRule(t *testing.T) {
+	input := `# header
+local all postgres peer
+
+# everyone from the office
+host all all 10.0.0.0/8 md5
+# billing needs client certs
+hostssl billing app 10.1.2.0/24 cert
+host all all 0.0.0.0/0 reject
+`
+	rules := parseRules(t, input)
+	re := hba.SuggestReorder(rules, hba.Config{})
+	if len(re.Moves) != 1 || re.Moves[0].Line != 7 || re.Moves[0].Before != 5 {
+		t.Fatalf("expected to move line 7 above line 5, got %+v", re.Moves)
+	}
+	if len(re.Changes) == 0 {
+		t.Fatalf("expected changed connections")
+	}
+	for _, d := range re.Changes {
+		if d.Old.Method != "md5" || d.New.Method != "cert" || d.Transport != hba.TransportSSL {
+			t.Fatalf("unexpected change: %s", d)
+		}
+	}
+
+	out := re.Render(input)
+	if !strings.Contains(out, "# billing needs client certs\nhostssl billing app 10.1.2.0/24 cert\n# everyone from the office\n") {
+		t.Fatalf("rule must move with its comment above line 5:\n%s", out)
+	}
+	if !strings.HasPrefix(out, "# header\nlocal all postgres peer\n") {
+		t.Fatalf("header must stay in place:\n%s", out)
+	}
+
+	// перенос блока из двух строк: две удалённые и две добавленные (плюс заголовок +++)
+	patch := hba.UnifiedDiff("a/pg_hba.conf", "b/pg_hba.conf", input, out)
+	if !strings.HasPrefix(patch, "--- a/pg_hba.conf\n+++ b/pg_hba.conf\n@@ -1,8 +1,8 @@\n") ||
+		strings.Count(patch, "\n+") != 3 || strings.Count(patch, "\n-") != 2 {
+		t.Fatalf("unexpected patch:\n%s", patch)
+	}
+}
+
+func TestSuggestReorderSkipsPointlessMoves(t *testing.T) {
+	rules := parseRules(t, `host all all 0.0.0.0/0 reject
+host all all 10.0.0.0/8 md5
+host all all 10.1.0.0/16 scram-sha-256
+`)
+	re := hba.SuggestReorder(rules, hba.Config{})
+	if len(re.Moves) != 0 || len(re.StillShadowed) != 1 || re.StillShadowed[0] != 3 {
+		t.Fatalf("expected no moves and line 3 still shadowed, got %+v", re)
+	}
+}
+
+func TestSuggestReorderBelowRegexRule(t *testing.T) {
+	rules := parseRules(t, "host /^tenant_ all 10.0.0.0/8 md5\nhostssl tenant_1 bob 10.1.0.0/16 cert\n")
+	re := hba.SuggestReorder(rules, hba.Config{})
+	if len(re.Moves) != 1 || re.Moves[0].Line != 2 || re.Moves[0].Before != 1 {
+		t.Fatalf("expected to move line 2 above the regex rule, got %+v", re.Moves)
+	}
+}
@@ -0,0 +1,53 @@
+package tests
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"go_hba_rules/pkg/hba"
+)
+
+func TestAllDoesNotShadowReplication(t *testing.T) {
+	input := `host all all 0.0.0.0/0 reject
+host replication repl 10.0.0.5/32 scram-sha-256
+host mydb app 10.0.0.5/32 scram-sha-256
+`
+	rules, err := hba.ParseHBA(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	issues := hba.CheckOverlaps(rules)
+
+	for _, is := range issues {
+		if is.Line == 2 && is.Code == "shadowedByReject" {
+			t.Fatalf("replication rule must not be shadowed by all: %+v", is)
+		}
+	}
+	if !hasCodeAt(issues, "replicationNotCoveredByAll", 2) {
+		t.Fatalf("expected replicationNotCoveredByAll, got %+v", issues)
+	}
+	if !hasCodeAt(issues, "shadowedByReject", 3) {
+		t.Fatalf("expected shadowedByReject for regular rule, got %+v", issues)
+	}
+}
+
+func TestSimulateReplicationClass(t *testing.T) {
+	input := `host all all 10.0.0.0/8 scram-sha-256
+host replication repl 10.0.0.5/32 md5
+`
+	rules, err := hba.ParseHBA(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	ip := net.ParseIP("10.0.0.5")
+
+	r, ok := hba.Simulate(rules, hba.Connection{Transport: hba.TransportSSL, User: "repl", Addr: ip, Replication: true}, hba.Roles{})
+	if !ok || r.Line != 2 {
+		t.Fatalf("replication connection should reach line 2, got %v %d", ok, r.Line)
+	}
+	r, ok = hba.Simulate(rules, hba.Connection{Transport: hba.TransportSSL, Database: "replication", User: "repl", Addr: ip}, hba.Roles{})
+	if !ok || r.Line != 1 {
+		t.Fatalf("regular connection should reach line 1, got %v %d", ok, r.Line)
+	}
+}
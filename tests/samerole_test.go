@@ -0,0 +1,77 @@
+package tests
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"go_hba_rules/pkg/hba"
+)
+
+func TestSameuserCoversPerUserDatabase(t *testing.T) {
+	input := `host sameuser all 10.0.0.0/16 scram-sha-256
+host alice alice 10.0.0.5/32 scram-sha-256
+host alice bob 10.0.0.5/32 scram-sha-256
+`
+	rules, err := hba.ParseHBA(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	issues := hba.CheckOverlaps(rules)
+
+	if !hasCodeAt(issues, "redundantRule", 2) {
+		t.Fatalf("expected redundantRule for alice/alice, got %+v", issues)
+	}
+	for _, is := range issues {
+		if is.Line == 3 {
+			t.Fatalf("alice/bob does not intersect sameuser, got %+v", is)
+		}
+	}
+}
+
+func TestSameroleUsesCatalog(t *testing.T) {
+	f, err := os.Open("../testdata/roles.json")
+	if err != nil {
+		t.Fatalf("open roles: %v", err)
+	}
+	defer f.Close()
+	roles, err := hba.ParseRoles(f)
+	if err != nil {
+		t.Fatalf("parse roles: %v", err)
+	}
+	if !roles.IsMember("alice", "analysts") || roles.IsMember("bob", "analysts") {
+		t.Fatalf("unexpected membership")
+	}
+
+	input := `host samerole all 10.0.0.0/16 md5
+host analysts alice 10.0.0.5/32 scram-sha-256
+host analysts bob 10.0.0.5/32 scram-sha-256
+host developers +developers 10.0.0.0/24 scram-sha-256
+`
+	rules, err := hba.ParseHBA(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	issues := hba.CheckOverlapsWith(rules, hba.Config{Roles: roles})
+
+	if !hasCodeAt(issues, "shadowedByBroadRule", 2) {
+		t.Fatalf("expected alice/analysts shadowed by samerole, got %+v", issues)
+	}
+	for _, is := range issues {
+		if is.Line == 3 {
+			t.Fatalf("bob is not in analysts, no overlap expected, got %+v", is)
+		}
+	}
+	if !hasCodeAt(issues, "shadowedByBroadRule", 4) {
+		t.Fatalf("expected +developers on developers shadowed by samerole, got %+v", issues)
+	}
+}
+
+func hasCodeAt(issues []hba.Issue, code string, line int) bool {
+	for _, is := range issues {
+		if is.Code == code && is.Line == line {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,60 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+
+	"go_hba_rules/pkg/hba"
+)
+
+func TestStrengthRanksOptionsAndTransport(t *testing.T) {
+	rules := parseRules(t, `host all all 10.0.0.0/8 scram-sha-256
+hostssl all all 10.1.0.0/16 scram-sha-256 clientcert=verify-full
+`)
+	issues := hba.CheckOverlaps(rules)
+	if !hasCodeAt(issues, "overlyBroadRule", 1) || !hasCodeAt(issues, "shadowedByBroadRule", 2) {
+		t.Fatalf("scram over hostssl scram+verify-full must be overly broad, got %v", issues)
+	}
+}
+
+func TestStrengthIdentIsNotStrong(t *testing.T) {
+	rules := parseRules(t, `host all all 10.0.0.0/8 md5
+host all all 10.1.0.0/16 ident
+`)
+	issues := hba.CheckOverlaps(rules)
+	if hasCode(issues, "overlyBroadRule") || !hasCodeAt(issues, "shadowedRule", 2) {
+		t.Fatalf("md5 over ident is not a weakening by default, got %v", issues)
+	}
+
+	st, err := hba.ParseStrength(strings.NewReader(`{"methods": {"ident": 45}}`))
+	if err != nil {
+		t.Fatalf("parse strength: %v", err)
+	}
+	issues = hba.CheckOverlapsWith(rules, hba.Config{Strength: st})
+	if !hasCodeAt(issues, "overlyBroadRule", 1) {
+		t.Fatalf("override must make ident stronger than md5, got %v", issues)
+	}
+	if st.Methods["scram-sha-256"] != hba.DefaultStrength().Methods["scram-sha-256"] {
+		t.Fatalf("overrides must keep the rest of the default scale")
+	}
+}
+
+func TestStricterClientcertDoesNotCover(t *testing.T) {
+	rules := parseRules(t, `hostssl all all 10.0.0.0/8 scram-sha-256 clientcert=verify-full
+hostssl all all 10.1.0.0/16 scram-sha-256 clientcert=verify-ca
+`)
+	for _, is := range hba.CheckOverlaps(rules) {
+		switch is.Code {
+		case "shadowedRule", "redundantRule", "shadowedByBroadRule":
+			t.Fatalf("verify-full above verify-ca must not count as covering: %v", is)
+		}
+	}
+}
+
+func TestDiffAccessFlagsDroppedClientcert(t *testing.T) {
+	old := parseRules(t, "hostssl all all 10.0.0.0/8 scram-sha-256 clientcert=verify-full\n")
+	changed := parseRules(t, "hostssl all all 10.0.0.0/8 scram-sha-256\n")
+	if diff := hba.DiffAccess(old, changed, hba.Roles{}); !diff.Broadens {
+		t.Fatalf("dropping clientcert must broaden access, got %+v", diff)
+	}
+}
@@ -0,0 +1,70 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+
+	"go_hba_rules/pkg/hba"
+)
+
+const suppressedHBA = `# hba-check:ignore localAllAll reason="single-tenant box"
+local all all peer
+host app app 10.0.0.0/8 md5  # hba-check:ignore md5Deprecated
+# hba-check:disable trustNetwork
+host app app 192.168.1.0/24 trust
+# hba-check:enable
+host app app 192.168.2.0/24 trust
+# hba-check:ignore wideAddress
+hostssl app app 192.168.3.0/24 scram-sha-256
+`
+
+func TestInlineSuppressions(t *testing.T) {
+	ds, err := hba.ParseDirectives(strings.NewReader(suppressedHBA))
+	if err != nil {
+		t.Fatalf("parse directives: %v", err)
+	}
+	rules := parseRules(t, suppressedHBA)
+	issues := hba.CheckAll(rules, hba.Config{SSLOn: true, Directives: ds})
+
+	suppressed := func(code string, line int) (bool, string) {
+		for _, is := range issues {
+			if is.Code == code && is.Line == line {
+				return is.Suppressed, is.SuppressReason
+			}
+		}
+		t.Fatalf("no %s at line %d: %v", code, line, issues)
+		return false, ""
+	}
+	if ok, reason := suppressed("localAllAll", 2); !ok || reason != "single-tenant box" {
+		t.Fatalf("localAllAll on line 2 must be suppressed with reason, got %v %q", ok, reason)
+	}
+	if ok, _ := suppressed("md5Deprecated", 3); !ok {
+		t.Fatalf("same-line ignore must suppress md5Deprecated")
+	}
+	if ok, _ := suppressed("trustNetwork", 5); !ok {
+		t.Fatalf("trustNetwork inside disable block must be suppressed")
+	}
+	if ok, _ := suppressed("trustNetwork", 7); ok {
+		t.Fatalf("trustNetwork after enable must not be suppressed")
+	}
+	if !hasCodeAt(issues, "unusedSuppression", 8) {
+		t.Fatalf("ignore wideAddress on a /24 matches nothing and must be reported: %v", issues)
+	}
+	if hasCodeAt(issues, "unusedSuppression", 1) || hasCodeAt(issues, "unusedSuppression", 4) {
+		t.Fatalf("used suppressions must not be reported: %v", issues)
+	}
+}
+
+func TestDirectiveErrors(t *testing.T) {
+	if _, err := hba.ParseDirectives(strings.NewReader("# hba-check:silence all\n")); err == nil {
+		t.Fatalf("unknown directive must fail")
+	}
+	ds, err := hba.ParseDirectives(strings.NewReader("local all all peer # hba-check:ignore noSuchCode\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	issues := hba.CheckAll(parseRules(t, "local all all peer\n"), hba.Config{Directives: ds})
+	if !hasCodeAt(issues, "unusedSuppression", 1) {
+		t.Fatalf("unknown code in directive must be reported: %v", issues)
+	}
+}
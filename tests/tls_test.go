@@ -0,0 +1,129 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go_hba_rules/pkg/hba"
+)
+
+func tlsIssues(t *testing.T, root, conf, hbaText string) map[string]hba.Issue {
+	t.Helper()
+	writeFiles(t, root, map[string]string{"postgresql.conf": conf})
+	server, err := hba.LoadPGConf(filepath.Join(root, "postgresql.conf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cfg hba.Config
+	if err := server.Apply(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	cfg.Enable = []string{"tlsProtocolWeak", "tlsCiphersWeak", "tlsFileUnreadable", "tlsKeyPermissions", "tlsCAMissing"}
+	out := map[string]hba.Issue{}
+	for _, is := range hba.CheckAll(parseRules(t, hbaText), cfg) {
+		if _, dup := out[is.Code]; dup {
+			t.Fatalf("duplicate %s: %+v", is.Code, is)
+		}
+		out[is.Code] = is
+	}
+	return out
+}
+
+func TestTLSConfigChecks(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{"server.crt": "cert", "tls/server.key": "key"})
+	if err := os.Chmod(filepath.Join(root, "tls/server.key"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	issues := tlsIssues(t, root, `ssl = on
+ssl_min_protocol_version = 'TLSv1'
+ssl_ciphers = 'ALL:!eNULL:RC4:!LOW'
+ssl_key_file = 'tls/server.key'
+`, `local all all peer
+hostssl all app 10.0.1.0/24 scram-sha-256
+hostssl all all 10.0.0.0/8 reject
+hostssl all ops 10.0.2.0/24 cert
+host all all 0.0.0.0/0 reject
+`)
+	want := map[string]int{"tlsProtocolWeak": 2, "tlsCiphersWeak": 2, "tlsKeyPermissions": 2, "tlsCAMissing": 4}
+	if len(issues) != len(want) {
+		t.Fatalf("issues: %+v", issues)
+	}
+	for code, line := range want {
+		if issues[code].Line != line {
+			t.Fatalf("%s must point at line %d: %+v", code, line, issues[code])
+		}
+	}
+	// все зависящие hostssl-правила, кроме reject, перечислены в Related
+	if got := issues["tlsProtocolWeak"].Related; !reflect.DeepEqual(got, []int{4}) {
+		t.Fatalf("related: %v", got)
+	}
+	if issues["tlsCAMissing"].Related != nil {
+		t.Fatalf("only the cert rule needs ssl_ca_file: %+v", issues["tlsCAMissing"])
+	}
+	if msg := issues["tlsCiphersWeak"].Message; !strings.Contains(msg, "ALL, RC4") {
+		t.Fatalf("weak suites must be named: %q", msg)
+	}
+	if msg := issues["tlsProtocolWeak"].Message; !strings.Contains(msg, "postgresql.conf:2") {
+		t.Fatalf("origin of the setting: %q", msg)
+	}
+}
+
+func TestTLSConfigFilesAndDefaults(t *testing.T) {
+	root := t.TempDir()
+	// сертификата нет, ключ по умолчанию в каталоге данных с правами 0600
+	writeFiles(t, root, map[string]string{"server.key": "key", "ca.crt": "ca"})
+	if err := os.Chmod(filepath.Join(root, "server.key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	issues := tlsIssues(t, root, "ssl = on\nssl_ca_file = 'ca.crt'\n",
+		"hostssl all app 10.0.1.0/24 scram-sha-256 clientcert=verify-full\n")
+	if len(issues) != 1 {
+		t.Fatalf("defaults are strong, only the certificate is missing: %+v", issues)
+	}
+	is := issues["tlsFileUnreadable"]
+	if is.Line != 1 || !strings.Contains(is.Message, filepath.Join(root, "server.crt")) ||
+		!strings.Contains(is.Message, "(default)") {
+		t.Fatalf("missing certificate: %+v", is)
+	}
+
+	// ssl_ca_file — каталог; сертификат без прав на чтение у проверяющего —
+	// не ошибка: его читает сервер
+	writeFiles(t, root, map[string]string{"server.crt": "crt", "ca.d/readme": ""})
+	if err := os.Chmod(filepath.Join(root, "server.crt"), 0o000); err != nil {
+		t.Fatal(err)
+	}
+	issues = tlsIssues(t, root, "ssl = on\nssl_ca_file = 'ca.d'\n",
+		"hostssl all app 10.0.1.0/24 scram-sha-256 clientcert=verify-full\n")
+	if len(issues) != 1 || !strings.Contains(issues["tlsFileUnreadable"].Message, "postgresql.conf:2) is a directory") {
+		t.Fatalf("directory as ssl_ca_file: %+v", issues)
+	}
+
+	// ssl=off или нет hostssl-правил — проверять нечего
+	if issues := tlsIssues(t, root, "ssl = off\nssl_min_protocol_version = 'TLSv1'\n",
+		"hostssl all app 10.0.1.0/24 scram-sha-256\n"); len(issues) != 0 {
+		t.Fatalf("ssl=off: %+v", issues)
+	}
+	if issues := tlsIssues(t, root, "ssl = on\nssl_min_protocol_version = 'TLSv1'\n",
+		"host all app 10.0.1.0/24 scram-sha-256\n"); len(issues) != 0 {
+		t.Fatalf("no hostssl rules: %+v", issues)
+	}
+}
+
+func TestWeakCiphers(t *testing.T) {
+	for ciphers, want := range map[string][]string{
+		"HIGH:MEDIUM:+3DES:!aNULL":   nil,
+		"ALL:!aNULL":                 nil,
+		"DEFAULT:!ADH:+RC4":          nil,
+		"ALL":                        {"ALL"},
+		"HIGH:aNULL:EXPORT":          {"aNULL", "EXPORT"},
+		"ECDHE+AESGCM:kRSA+RC4:-LOW": {"kRSA+RC4"},
+	} {
+		if got := hba.WeakCiphers(ciphers); !reflect.DeepEqual(got, want) {
+			t.Fatalf("%s: got %v, want %v", ciphers, got, want)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package tests
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"go_hba_rules/pkg/hba"
+)
+
+func TestTraceConnection(t *testing.T) {
+	input := `local all all peer
+hostssl mydb app 10.0.0.0/24 scram-sha-256
+host otherdb app 10.0.0.0/24 scram-sha-256
+host mydb admin 10.0.0.0/24 scram-sha-256
+host mydb app 192.168.0.0/16 md5
+host mydb app 10.0.0.0/16 md5
+host all all 0.0.0.0/0 reject
+`
+	rules, err := hba.ParseHBA(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	conn := hba.Connection{Transport: hba.TransportPlain, Database: "mydb", User: "app", Addr: net.ParseIP("10.0.0.7")}
+	trace := hba.TraceConnection(rules, conn, hba.Roles{})
+
+	if trace.MatchedLine != 6 || trace.Method != "md5" {
+		t.Fatalf("expected line 6 md5, got line %d %s", trace.MatchedLine, trace.Method)
+	}
+	want := []struct {
+		status hba.StepStatus
+		crit   hba.Criterion
+	}{
+		{hba.StepMismatch, hba.CriterionType},
+		{hba.StepMismatch, hba.CriterionEncryption},
+		{hba.StepMismatch, hba.CriterionDatabase},
+		{hba.StepMismatch, hba.CriterionUser},
+		{hba.StepMismatch, hba.CriterionAddress},
+		{hba.StepMatch, ""},
+		{hba.StepSkipped, ""},
+	}
+	if len(trace.Steps) != len(want) {
+		t.Fatalf("expected %d steps, got %d", len(want), len(trace.Steps))
+	}
+	for i, w := range want {
+		s := trace.Steps[i]
+		if s.Status != w.status || s.Criterion != w.crit {
+			t.Fatalf("step %d: expected %s/%s, got %s/%s (%s)", i, w.status, w.crit, s.Status, s.Criterion, s.Reason)
+		}
+	}
+
+	if r, ok := hba.Simulate(rules, conn, hba.Roles{}); !ok || r.Line != trace.MatchedLine {
+		t.Fatalf("Simulate disagrees with trace: %v %d", ok, r.Line)
+	}
+}
+
+func TestTraceImplicitReject(t *testing.T) {
+	rules, err := hba.ParseHBA(strings.NewReader("hostssl all all 10.0.0.0/8 scram-sha-256\n"))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	trace := hba.TraceConnection(rules, hba.Connection{Transport: hba.TransportLocal, Database: "db", User: "u"}, hba.Roles{})
+	if trace.MatchedLine != 0 || trace.Method != "reject" {
+		t.Fatalf("expected implicit reject, got %+v", trace)
+	}
+	if !strings.Contains(trace.String(), "implicit reject") {
+		t.Fatalf("text output should mention implicit reject:\n%s", trace.String())
+	}
+}
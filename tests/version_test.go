@@ -0,0 +1,162 @@
+package tests
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go_hba_rules/pkg/hba"
+)
+
+const versionedHBA = `include_if_exists extra.conf
+hostgssenc all all 10.0.0.0/8 scram-sha-256
+hostssl all /^app_ 10.0.0.0/8 scram-sha-256 clientcert=1
+hostssl all all 10.0.0.0/8 md5
+`
+
+func TestRegexTokensAndIncludes(t *testing.T) {
+	rules := parseRules(t, versionedHBA)
+	if len(rules) != 3 || rules[0].Line != 2 {
+		t.Fatalf("include line must not be parsed as a rule: %+v", rules)
+	}
+	includes, err := hba.ParseIncludes(strings.NewReader(versionedHBA))
+	if err != nil || len(includes) != 1 || includes[0].Kind != "include_if_exists" || includes[0].Path != "extra.conf" {
+		t.Fatalf("unexpected includes: %+v, %v", includes, err)
+	}
+
+	addr := net.ParseIP("10.1.2.3")
+	app := hba.Connection{Transport: hba.TransportSSL, Database: "db", User: "app_billing", Addr: addr}
+	if r, ok := hba.Simulate(rules, app, hba.Roles{}); !ok || r.Line != 3 {
+		t.Fatalf("app_billing must match the regex rule at line 3, got %+v", r)
+	}
+	other := hba.Connection{Transport: hba.TransportSSL, Database: "db", User: "bob", Addr: addr}
+	if r, ok := hba.Simulate(rules, other, hba.Roles{}); !ok || r.Line != 4 {
+		t.Fatalf("bob must fall through to line 4, got %+v", r)
+	}
+
+	// семантика видит пользователей, подходящих под выражение, без явного упоминания
+	var buf strings.Builder
+	if err := hba.BuildMatrix(rules, hba.Roles{}).WriteCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "app_") {
+		t.Fatalf("matrix must contain a sample user for the regex:\n%s", buf.String())
+	}
+}
+
+func TestVersionChecks(t *testing.T) {
+	rules := parseRules(t, versionedHBA)
+	includes, _ := hba.ParseIncludes(strings.NewReader(versionedHBA))
+	run := func(v int) []hba.Issue {
+		return hba.CheckAll(rules, hba.Config{SSLOn: true, PGVersion: v, Includes: includes,
+			Enable: []string{"unsupportedFeature", "clientcertInvalid"}})
+	}
+
+	old := run(11)
+	for _, line := range []int{1, 2, 3} {
+		if !hasCodeAt(old, "unsupportedFeature", line) {
+			t.Fatalf("pg 11: expected unsupportedFeature at line %d: %v", line, old)
+		}
+	}
+	if hasCode(old, "clientcertInvalid") {
+		t.Fatalf("pg 11: clientcert=1 is valid: %v", old)
+	}
+
+	recent := run(16)
+	if len(recent) != 1 || recent[0].Line != 3 || !strings.Contains(recent[0].Message, "removed in PostgreSQL 14") {
+		t.Fatalf("pg 16: only clientcert=1 must be flagged: %v", recent)
+	}
+	if issues := run(0); len(issues) != 1 || issues[0].Code != "clientcertInvalid" {
+		t.Fatalf("without -pg-version: only the old clientcertInvalid check: %v", issues)
+	}
+}
+
+func TestUpgradeReport(t *testing.T) {
+	rules := parseRules(t, versionedHBA)
+	includes, _ := hba.ParseIncludes(strings.NewReader(versionedHBA))
+
+	items := hba.UpgradeReport(rules, includes, 13, 18)
+	var required, advisory []int
+	for _, it := range items {
+		if it.Required {
+			required = append(required, it.Line)
+		} else {
+			advisory = append(advisory, it.Line)
+		}
+	}
+	if len(required) != 1 || required[0] != 3 {
+		t.Fatalf("13 -> 18: clientcert=1 must be required: %v", items)
+	}
+	if len(advisory) != 1 || advisory[0] != 4 {
+		t.Fatalf("13 -> 18: md5 deprecation must be advisory: %v", items)
+	}
+
+	down := hba.UpgradeReport(rules, includes, 16, 12)
+	if len(down) != 2 || down[0].Line != 1 || down[1].Line != 3 {
+		t.Fatalf("16 -> 12: include and regex must be required: %v", down)
+	}
+
+	if _, err := hba.ParseVersion("16.2"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := hba.ParseVersion("sixteen"); err == nil {
+		t.Fatalf("expected error for a non-numeric version")
+	}
+}
+
+func TestUserAtDBNeedsNamespaceSetting(t *testing.T) {
+	const text = "host all alice@example.com 10.0.0.0/8 scram-sha-256\n"
+	rules := parseRules(t, text)
+	cfg := hba.Config{PGVersion: 17, Enable: []string{"unsupportedFeature"}}
+	// без db_user_namespace «@» — обычный символ имени роли
+	if issues := hba.CheckAll(rules, cfg); hasCode(issues, "unsupportedFeature") {
+		t.Fatalf("user@db without db_user_namespace: %v", issues)
+	}
+
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{"postgresql.conf": "db_user_namespace = on\n"})
+	server, err := hba.LoadPGConf(filepath.Join(root, "postgresql.conf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Server = server
+	if issues := hba.CheckAll(rules, cfg); !hasCodeAt(issues, "unsupportedFeature", 1) {
+		t.Fatalf("db_user_namespace = on: expected unsupportedFeature: %v", issues)
+	}
+
+	// без postgresql.conf отчёт о переходе только рекомендует проверить параметр
+	items := hba.UpgradeReport(rules, nil, 16, 17)
+	if len(items) != 1 || items[0].Required || !strings.Contains(items[0].Message, "if db_user_namespace is on") {
+		t.Fatalf("16 -> 17: user@db must be advisory: %v", items)
+	}
+}
+
+func TestRegexUnsupported(t *testing.T) {
+	rules := parseRules(t, "host all /^(?!admin) 10.0.0.0/8 scram-sha-256\nhost /^app_ all 10.0.0.0/8 scram-sha-256\n")
+	issues := hba.CheckAll(rules, hba.Config{Enable: []string{"regexUnsupported"}})
+	if len(issues) != 1 || issues[0].Line != 1 || !strings.Contains(issues[0].Message, `"/^(?!admin)"`) {
+		t.Fatalf("lookahead must be reported, RE2-compatible expression not: %v", issues)
+	}
+}
+
+func TestFeaturesUsedGroupedByFile(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"pg_hba.conf": "include extra.conf\nhost all /^app_ 10.0.0.0/8 scram-sha-256\nhost all all 10.0.0.0/8 md5\n",
+		"extra.conf":  "\n\nhostgssenc all all 10.0.0.0/8 scram-sha-256\n",
+	})
+	rules, includes, err := hba.LoadHBA(filepath.Join(root, "pg_hba.conf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, u := range hba.FeaturesUsed(rules, includes) {
+		got = append(got, fmt.Sprintf("%s:%d", filepath.Base(u.File), u.Line))
+	}
+	want := []string{".:1", ".:2", ".:2", ".:3", "extra.conf:3", "extra.conf:3"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}